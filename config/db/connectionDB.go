@@ -14,6 +14,12 @@ var Client *mongo.Client
 var LoanCollection *mongo.Collection
 var UserCollection *mongo.Collection
 var LogCollection *mongo.Collection
+var PaymentCollection *mongo.Collection
+var RevokedTokenCollection *mongo.Collection
+var LoginAttemptCollection *mongo.Collection
+var OutboxCollection *mongo.Collection
+var RoleCollection *mongo.Collection
+var APIKeyCollection *mongo.Collection
 func ConnectDB(connectionString string) {
 
     clientOptions := options.Client().ApplyURI(connectionString)
@@ -36,4 +42,10 @@ func ConnectDB(connectionString string) {
     UserCollection = client.Database("loan_tracker_api").Collection("users")
     LoanCollection = client.Database("loan_tracker_api").Collection("loans")
     LogCollection = client.Database("loan_tracker_api").Collection("logs")
+    PaymentCollection = client.Database("loan_tracker_api").Collection("payments")
+    RevokedTokenCollection = client.Database("loan_tracker_api").Collection("revoked_tokens")
+    LoginAttemptCollection = client.Database("loan_tracker_api").Collection("login_attempts")
+    OutboxCollection = client.Database("loan_tracker_api").Collection("outbox")
+    RoleCollection = client.Database("loan_tracker_api").Collection("roles")
+    APIKeyCollection = client.Database("loan_tracker_api").Collection("api_keys")
 }
@@ -15,10 +15,84 @@ func InitiEnvConfigs() {
 type envConfigs struct {
 	LocalServerPort string `mapstructure:"LOCAL_SERVER_PORT"`
 	MongoURI        string `mapstructure:"MONGODB_URL"`
-	JwtSecret 	 string `mapstructure:"JWT_SECRET"`
-	JwtRefreshSecret string `mapstructure:"JWT_REFRESH_TOKEN_SECRET"`
+	// tokens are signed with the RS256 or EdDSA keys in JwtKeysDir; see infrastracture.NewKeySet
+	JwtKeysDir      string `mapstructure:"JWT_KEYS_DIR"`
+	JwtSigningKeyID string `mapstructure:"JWT_SIGNING_KEY_ID"`
 	AccessTokenExpiryHour  int    `mapstructure:"ACCESS_TOKEN_EXPIRY_HOUR"`
 	RefreshTokenExpiryHour int    `mapstructure:"REFRESH_TOKEN_EXPIRY_HOUR"`
+	// TokenRevocationStore selects where revoked access tokens are kept: "mongo" (default) or "memory"
+	TokenRevocationStore string `mapstructure:"TOKEN_REVOCATION_STORE"`
+	// RequireAdmin2FA blocks the admin routes for admins that have not enrolled in two-factor authentication
+	RequireAdmin2FA bool `mapstructure:"REQUIRE_ADMIN_2FA"`
+	// DevMode allows development fallbacks for settings production must configure explicitly
+	DevMode bool `mapstructure:"DEV_MODE"`
+
+	// Google sign-in; the endpoints default to Google's own and only need setting to point at
+	// another OpenID Connect server. GoogleRedirectURL defaults to PUBLIC_BASE_URL + /auth/google/callback
+	GoogleClientID     string `mapstructure:"GOOGLE_CLIENT_ID"`
+	GoogleClientSecret string `mapstructure:"GOOGLE_CLIENT_SECRET"`
+	GoogleRedirectURL  string `mapstructure:"GOOGLE_REDIRECT_URL"`
+	GoogleIssuer       string `mapstructure:"GOOGLE_ISSUER"`
+	GoogleAuthURL      string `mapstructure:"GOOGLE_AUTH_URL"`
+	GoogleTokenURL     string `mapstructure:"GOOGLE_TOKEN_URL"`
+
+	// failed login throttling; zero values fall back to the defaults in infrastracture/login_throttle.go
+	LoginLockoutThreshold     int `mapstructure:"LOGIN_LOCKOUT_THRESHOLD"`
+	LoginIPLockoutThreshold   int `mapstructure:"LOGIN_IP_LOCKOUT_THRESHOLD"`
+	LoginLockoutMinutes       int `mapstructure:"LOGIN_LOCKOUT_MINUTES"`
+	LoginAttemptWindowMinutes int `mapstructure:"LOGIN_ATTEMPT_WINDOW_MINUTES"`
+
+	// MailerBackend is "smtp", "file" or "memory"; required unless DEV_MODE is set
+	MailerBackend string `mapstructure:"MAILER_BACKEND"`
+	SMTPHost      string `mapstructure:"SMTP_HOST"`
+	SMTPPort      int    `mapstructure:"SMTP_PORT"`
+	SMTPUsername  string `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword  string `mapstructure:"SMTP_PASSWORD"`
+	MailFrom      string `mapstructure:"MAIL_FROM"`
+	MailOutboxDir string `mapstructure:"MAIL_OUTBOX_DIR"`
+
+	// BlobStoreBackend is "local" (the default) or "s3"; S3 settings also work with MinIO
+	BlobStoreBackend string `mapstructure:"BLOB_STORE_BACKEND"`
+	BlobStoreDir     string `mapstructure:"BLOB_STORE_DIR"`
+	S3Endpoint       string `mapstructure:"S3_ENDPOINT"`
+	S3Region         string `mapstructure:"S3_REGION"`
+	S3Bucket         string `mapstructure:"S3_BUCKET"`
+	S3AccessKey      string `mapstructure:"S3_ACCESS_KEY"`
+	S3SecretKey      string `mapstructure:"S3_SECRET_KEY"`
+	// ProfileImageMaxBytes caps uploads; defaults to 5 MiB
+	ProfileImageMaxBytes int64 `mapstructure:"PROFILE_IMAGE_MAX_BYTES"`
+
+	// PublicBaseURL is the externally reachable address used in links inside emails
+	PublicBaseURL string `mapstructure:"PUBLIC_BASE_URL"`
+	// DefaultLocale is used for users without a supported preferred language; defaults to "en"
+	DefaultLocale string `mapstructure:"DEFAULT_LOCALE"`
+	// OverdueReminderIntervalHours is the minimum gap between two overdue reminders for the same loan; defaults to 24
+	OverdueReminderIntervalHours int `mapstructure:"OVERDUE_REMINDER_INTERVAL_HOURS"`
+	// LateFeeAmount is charged for every installment that falls overdue, with its first reminder; 0 charges no late fees
+	LateFeeAmount float64 `mapstructure:"LATE_FEE_AMOUNT"`
+
+	// outbox delivery; zero values fall back to the defaults in usecase/outbox_usecase.go
+	OutboxMaxAttempts    int `mapstructure:"OUTBOX_MAX_ATTEMPTS"`
+	OutboxPollSeconds    int `mapstructure:"OUTBOX_POLL_SECONDS"`
+	OutboxBackoffSeconds int `mapstructure:"OUTBOX_BACKOFF_SECONDS"`
+
+	// activation email resends; default to one per minute and five per day
+	ActivationResendCooldownSeconds int `mapstructure:"ACTIVATION_RESEND_COOLDOWN_SECONDS"`
+	ActivationResendDailyLimit      int `mapstructure:"ACTIVATION_RESEND_DAILY_LIMIT"`
+
+	// lifetime of emailed links; all default to 30 minutes
+	ActivationTokenExpiryMinutes    int `mapstructure:"ACTIVATION_TOKEN_EXPIRY_MINUTES"`
+	PasswordResetTokenExpiryMinutes int `mapstructure:"PASSWORD_RESET_TOKEN_EXPIRY_MINUTES"`
+	EmailChangeTokenExpiryMinutes   int `mapstructure:"EMAIL_CHANGE_TOKEN_EXPIRY_MINUTES"`
+	// ImpersonationTokenMinutes is the lifetime of the read-only tokens support gets when impersonating; defaults to 15
+	ImpersonationTokenMinutes int `mapstructure:"IMPERSONATION_TOKEN_MINUTES"`
+	// AccountInviteExpiryHours is how long the set-password link for admin-created accounts works; defaults to 72
+	AccountInviteExpiryHours int `mapstructure:"ACCOUNT_INVITE_EXPIRY_HOURS"`
+
+	// soft-deleted users and loans are purged after DeletedRecordRetentionDays (default 2555, about
+	// seven years); the purge job runs every PurgeIntervalHours (default 24)
+	DeletedRecordRetentionDays int `mapstructure:"DELETED_RECORD_RETENTION_DAYS"`
+	PurgeIntervalHours         int `mapstructure:"PURGE_INTERVAL_HOURS"`
 }
 
 func loadEnvVariables() *envConfigs {
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"loan-tracker-api/domain"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminUserController struct {
+	AdminUserUsecase domain.AdminUserUsecase
+}
+
+func NewAdminUserController(adminUserUsecase domain.AdminUserUsecase) *AdminUserController {
+	return &AdminUserController{AdminUserUsecase: adminUserUsecase}
+}
+
+func (a *AdminUserController) CreateUser(c *gin.Context) {
+	var request domain.AdminCreateUserRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	user, err := a.AdminUserUsecase.CreateUser(c.GetString("user_id"), c.GetString("role"), request)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    201,
+		"message": "User created successfully",
+		"data":    user,
+	})
+}
+
+func (a *AdminUserController) GetUser(c *gin.Context) {
+	detail, err := a.AdminUserUsecase.GetUserDetail(c.Param("id"))
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "User retrieved successfully",
+		"data":    detail,
+	})
+}
+
+func (a *AdminUserController) UpdateUser(c *gin.Context) {
+	var request domain.AdminUpdateUserRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	user, err := a.AdminUserUsecase.UpdateUser(c.GetString("user_id"), c.GetString("role"), c.Param("id"), request)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "User updated successfully",
+		"data":    user,
+	})
+}
+
+func (a *AdminUserController) SuspendUser(c *gin.Context) {
+	var request domain.SuspendUserRequest
+	// the reason is optional, so is the body
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+	}
+
+	err := a.AdminUserUsecase.SuspendUser(c.GetString("user_id"), c.GetString("role"), c.Param("id"), request.Reason)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "User suspended successfully",
+	})
+}
+
+func (a *AdminUserController) ReactivateUser(c *gin.Context) {
+	err := a.AdminUserUsecase.ReactivateUser(c.GetString("user_id"), c.GetString("role"), c.Param("id"))
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "User reactivated successfully",
+	})
+}
+
+func (a *AdminUserController) ForcePasswordReset(c *gin.Context) {
+	err := a.AdminUserUsecase.ForcePasswordReset(c.GetString("user_id"), c.GetString("role"), c.Param("id"))
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Password reset required; a reset link was sent to the user",
+	})
+}
+
+// ImpersonateUser returns a short-lived, read-only token that acts as the user.
+func (a *AdminUserController) ImpersonateUser(c *gin.Context) {
+	session, err := a.AdminUserUsecase.ImpersonateUser(c.GetString("user_id"), c.GetString("role"), c.Param("id"))
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Impersonation token issued; it is read-only and every request is logged",
+		"data":    session,
+	})
+}
+
+func (a *AdminUserController) DeleteUser(c *gin.Context) {
+	user, err := a.AdminUserUsecase.DeleteUser(c.GetString("user_id"), c.GetString("role"), c.Param("id"))
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "User deleted successfully",
+		"data":    user,
+	})
+}
+
+func (a *AdminUserController) RestoreUser(c *gin.Context) {
+	user, err := a.AdminUserUsecase.RestoreUser(c.GetString("user_id"), c.Param("id"))
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "User restored successfully",
+		"data":    user,
+	})
+}
+
+func (a *AdminUserController) GetDeletedUsers(c *gin.Context) {
+	limit := c.DefaultQuery("limit", "10")
+	page := c.DefaultQuery("page", "1")
+
+	users, err := a.AdminUserUsecase.GetDeletedUsers(limit, page)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":         200,
+		"message":      "Deleted users fetched successfully",
+		"data":         users,
+		"current_page": page,
+	})
+}
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"loan-tracker-api/domain"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyController struct {
+	APIKeyUsecase domain.APIKeyUsecase
+}
+
+func NewAPIKeyController(apiKeyUsecase domain.APIKeyUsecase) *APIKeyController {
+	return &APIKeyController{APIKeyUsecase: apiKeyUsecase}
+}
+
+func (a *APIKeyController) CreateKey(c *gin.Context) {
+	var request domain.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	key, err := a.APIKeyUsecase.CreateKey(c.GetString("user_id"), c.GetString("role"), request)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    201,
+		"message": "API key created. Store the key now, it can't be shown again",
+		"data":    key,
+	})
+}
+
+func (a *APIKeyController) GetKeys(c *gin.Context) {
+	keys, err := a.APIKeyUsecase.GetKeys()
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "API keys retrieved successfully",
+		"data":    keys,
+	})
+}
+
+func (a *APIKeyController) RevokeKey(c *gin.Context) {
+	key, err := a.APIKeyUsecase.RevokeKey(c.GetString("user_id"), c.Param("id"))
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "API key revoked successfully",
+		"data":    key,
+	})
+}
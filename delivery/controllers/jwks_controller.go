@@ -0,0 +1,23 @@
+package controllers
+
+import (
+	"loan-tracker-api/domain"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JWKSController struct {
+	TokenVerifier domain.TokenVerifier
+}
+
+func NewJWKSController(tokenVerifier domain.TokenVerifier) *JWKSController {
+	return &JWKSController{TokenVerifier: tokenVerifier}
+}
+
+// GetJWKS serves the public signing keys as a JSON Web Key Set. Caches may keep it for a few
+// minutes, so a new key must be published that long before tokens are signed with it.
+func (j *JWKSController) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, j.TokenVerifier.JWKS())
+}
@@ -1,7 +1,10 @@
 package controllers
 
 import (
+	"errors"
 	"loan-tracker-api/domain"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,10 +20,10 @@ func NewLoanController(loanUsecase domain.LoanUsecase) *LoanController {
 }
 
 func (l *LoanController) CreateLoan(c *gin.Context) {
-	var loan domain.Loan
+	var request domain.CreateLoanRequest
 	userID := c.GetString("user_id")
 	usename := c.GetString("username")
-	if err := c.ShouldBindJSON(&loan); err != nil {
+	if err := c.ShouldBindJSON(&request); err != nil {
 
 		c.JSON(400, gin.H{
 			"code":    400,
@@ -28,10 +31,8 @@ func (l *LoanController) CreateLoan(c *gin.Context) {
 		})
 		return
 	}
-	loan.BorrowerID = userID
-	loan.BorrowerName = usename
 
-	createdLoan , err := l.loanUsecase.CreateLoan(loan)
+	createdLoan , err := l.loanUsecase.CreateLoan(userID, usename, request)
 	if err.Message != "" {
 		c.JSON(err.StatusCode, err)
 		return
@@ -45,6 +46,54 @@ func (l *LoanController) CreateLoan(c *gin.Context) {
 }
 
 
+func (l *LoanController) UpdateLoan(c *gin.Context) {
+	var update domain.LoanUpdateRequest
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(400, gin.H{
+			"code":    400,
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	updatedLoan, err := l.loanUsecase.UpdateLoan(c.GetString("user_id"), c.Param("id"), update)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "Loan updated successfully",
+		"data":    updatedLoan,
+	})
+}
+
+func (l *LoanController) CancelLoan(c *gin.Context) {
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{
+			"code":    400,
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	cancelledLoan, err := l.loanUsecase.CancelLoan(c.GetString("user_id"), c.Param("id"), request.Reason)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "Loan cancelled successfully",
+		"data":    cancelledLoan,
+	})
+}
+
 func (l *LoanController)GetLoanByID(c *gin.Context) {
 	id := c.Param("id")
 	userID := c.GetString("user_id")
@@ -72,23 +121,166 @@ func (l *LoanController)GetLoanByID(c *gin.Context) {
 	
 }
 
-func (l *LoanController) GetLoans(c *gin.Context) {
-	loans, err := l.loanUsecase.GetLoans()
-	if err.Message != ""  {
-		c.JSON(500, gin.H{
-			"code":    500,
-			"message": "Internal Server Error",
+func (l *LoanController) GetMyLoans(c *gin.Context) {
+	filter, parseErr := parseLoanFilter(c)
+	if parseErr != nil {
+		c.JSON(400, gin.H{
+			"code":    400,
+			"message": parseErr.Error(),
 		})
 		return
 	}
 
-	c.JSON(200, gin.H{
+	page, err := l.loanUsecase.GetUserLoans(c.GetString("user_id"), filter)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	c.JSON(200, loanPageResponse(page, filter))
+}
+
+func loanPageResponse(page domain.LoanPage, filter domain.LoanFilter) gin.H {
+	response := gin.H{
 		"code":    200,
 		"message": "Loans fetched successfully",
-		"data":    loans,
+		"data":    page.Loans,
+
+		"total":       page.Total,
+		"quantity":    strconv.Itoa(len(page.Loans)) + "/" + strconv.Itoa(filter.Limit),
+		"next_cursor": page.NextCursor,
+	}
+	if filter.Cursor == "" {
+		response["current_page"] = filter.Page
+	}
+	return response
+}
+
+// parseLoanFilter reads the listing query parameters shared by the loan listing endpoints.
+func parseLoanFilter(c *gin.Context) (domain.LoanFilter, error) {
+	filter := domain.LoanFilter{
+		Status:    c.Query("status"),
+		SortBy:    c.Query("sort_by"),
+		SortOrder: c.DefaultQuery("order", "desc"),
+		Cursor:    c.Query("cursor"),
+		Page:      1,
+		Limit:     10,
+	}
+
+	if filter.SortOrder != "asc" && filter.SortOrder != "desc" {
+		return domain.LoanFilter{}, errors.New("order must be asc or desc")
+	}
+
+	var err error
+	if page := c.Query("page"); page != "" {
+		if filter.Page, err = strconv.Atoi(page); err != nil || filter.Page < 1 {
+			return domain.LoanFilter{}, errors.New("page must be a positive number")
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 1 || filter.Limit > 100 {
+			return domain.LoanFilter{}, errors.New("limit must be between 1 and 100")
+		}
+	}
+	if minAmount := c.Query("min_amount"); minAmount != "" {
+		if filter.MinAmount, err = strconv.ParseFloat(minAmount, 64); err != nil {
+			return domain.LoanFilter{}, errors.New("min_amount must be a number")
+		}
+	}
+	if maxAmount := c.Query("max_amount"); maxAmount != "" {
+		if filter.MaxAmount, err = strconv.ParseFloat(maxAmount, 64); err != nil {
+			return domain.LoanFilter{}, errors.New("max_amount must be a number")
+		}
+	}
+	if from := c.Query("created_from"); from != "" {
+		if filter.CreatedFrom, err = parseQueryDate(from, false); err != nil {
+			return domain.LoanFilter{}, errors.New("created_from must be a date (YYYY-MM-DD) or RFC3339 timestamp")
+		}
+	}
+	if to := c.Query("created_to"); to != "" {
+		if filter.CreatedTo, err = parseQueryDate(to, true); err != nil {
+			return domain.LoanFilter{}, errors.New("created_to must be a date (YYYY-MM-DD) or RFC3339 timestamp")
+		}
+	}
+
+	return filter, nil
+}
+
+// parseQueryDate accepts either a full RFC3339 timestamp or a plain date. A plain
+// date used as an upper bound covers the whole day.
+func parseQueryDate(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	return t, nil
+}
+
+func (l *LoanController) GetLoanSchedule(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.GetString("user_id")
+	Role := c.GetString("role")
+
+	schedule, err := l.loanUsecase.GetLoanSchedule(userID, Role, id)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "Repayment schedule fetched successfully",
+		"data":    schedule,
+	})
+}
+
+func (l *LoanController) GetLoanHistory(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.GetString("user_id")
+	Role := c.GetString("role")
+
+	history, err := l.loanUsecase.GetLoanHistory(userID, Role, id)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "Loan history fetched successfully",
+		"data":    history,
 	})
 }
 
+func (l *LoanController) GetLoans(c *gin.Context) {
+	filter, parseErr := parseLoanFilter(c)
+	if parseErr != nil {
+		c.JSON(400, gin.H{
+			"code":    400,
+			"message": parseErr.Error(),
+		})
+		return
+	}
+	filter.BorrowerID = c.Query("borrower_id")
+	filter.BorrowerName = c.Query("borrower_name")
+	filter.Search = c.Query("q")
+	filter.Deleted = c.Query("deleted") == "true"
+
+	page, err := l.loanUsecase.GetLoans(filter)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	c.JSON(200, loanPageResponse(page, filter))
+}
+
 
 func (l *LoanController) UpdateLoanStatus(c *gin.Context) {
 	id := c.Param("id")
@@ -101,9 +293,7 @@ func (l *LoanController) UpdateLoanStatus(c *gin.Context) {
 		return
 	}
 
-	var updateData struct {
-		Status string `json:"status"`
-	}
+	var updateData domain.LoanStatusRequest
 
 	if err := c.ShouldBindJSON(&updateData); err != nil {
 		c.JSON(400, gin.H{
@@ -123,7 +313,7 @@ func (l *LoanController) UpdateLoanStatus(c *gin.Context) {
 
 	
 
-	updatedLoan, err := l.loanUsecase.UpdateLoanStatus(updateData.Status, id)
+	updatedLoan, err := l.loanUsecase.UpdateLoanStatus(c.GetString("user_id"), id, updateData)
 	if err.Message != "" {
 		c.JSON(err.StatusCode, gin.H{
 			"code":    err.StatusCode,
@@ -142,7 +332,7 @@ func (l *LoanController) UpdateLoanStatus(c *gin.Context) {
 
 func (l *LoanController) DeleteLoan(c *gin.Context) {
 	id := c.Param("id")
-	deletedLoan, err := l.loanUsecase.DeleteLoan(id)
+	deletedLoan, err := l.loanUsecase.DeleteLoan(c.GetString("user_id"), id)
 	if err.Message != "" {
 		c.JSON(err.StatusCode, err)
 		return
@@ -153,4 +343,18 @@ func (l *LoanController) DeleteLoan(c *gin.Context) {
 		"message": "Loan deleted successfully",
 		"data":    deletedLoan,
 	})
+}
+
+func (l *LoanController) RestoreLoan(c *gin.Context) {
+	loan, err := l.loanUsecase.RestoreLoan(c.GetString("user_id"), c.Param("id"))
+	if err.Message != "" {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "Loan restored successfully",
+		"data":    loan,
+	})
 }
\ No newline at end of file
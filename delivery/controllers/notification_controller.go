@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"loan-tracker-api/domain"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type NotificationController struct {
+	NotificationUsecase domain.NotificationUsecase
+}
+
+func NewNotificationController(notificationUsecase domain.NotificationUsecase) *NotificationController {
+	return &NotificationController{NotificationUsecase: notificationUsecase}
+}
+
+func (n *NotificationController) GetEmailTemplates(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Email templates retrieved successfully",
+		"data":    n.NotificationUsecase.ListEmailTemplates(),
+	})
+}
+
+// PreviewEmailTemplate renders a template with sample data. ?format=html or ?format=text
+// returns that part as-is so it can be opened in a browser; otherwise both parts come back as JSON.
+func (n *NotificationController) PreviewEmailTemplate(c *gin.Context) {
+	message, err := n.NotificationUsecase.PreviewEmail(c.Param("name"), c.Query("locale"))
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	switch c.Query("format") {
+	case "html":
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(message.HTMLBody))
+		return
+	case "text":
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(message.TextBody))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Email template rendered successfully",
+		"data":    message,
+	})
+}
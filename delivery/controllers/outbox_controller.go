@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"loan-tracker-api/domain"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OutboxController struct {
+	OutboxUsecase domain.OutboxUsecase
+}
+
+func NewOutboxController(outboxUsecase domain.OutboxUsecase) *OutboxController {
+	return &OutboxController{OutboxUsecase: outboxUsecase}
+}
+
+func (o *OutboxController) GetMessages(c *gin.Context) {
+	page := c.DefaultQuery("page", "1")
+	limit := c.DefaultQuery("limit", "20")
+
+	messages, total, err := o.OutboxUsecase.GetMessages(c.Query("status"), page, limit)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":         200,
+		"message":      "Outbox messages retrieved successfully",
+		"data":         messages,
+		"total":        total,
+		"current_page": page,
+	})
+}
+
+func (o *OutboxController) GetMessage(c *gin.Context) {
+	message, err := o.OutboxUsecase.GetMessageByID(c.Param("id"))
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Outbox message retrieved successfully",
+		"data":    message,
+	})
+}
+
+func (o *OutboxController) RedriveMessage(c *gin.Context) {
+	message, err := o.OutboxUsecase.RedriveMessage(c.GetString("user_id"), c.Param("id"))
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Outbox message queued for delivery",
+		"data":    message,
+	})
+}
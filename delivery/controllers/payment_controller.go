@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"loan-tracker-api/domain"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PaymentController struct {
+	paymentUsecase domain.PaymentUsecase
+}
+
+func NewPaymentController(paymentUsecase domain.PaymentUsecase) *PaymentController {
+	return &PaymentController{
+		paymentUsecase: paymentUsecase,
+	}
+}
+
+func (p *PaymentController) RecordPayment(c *gin.Context) {
+	var request domain.PaymentRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{
+			"code":    400,
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	payment, err := p.paymentUsecase.RecordPayment(c.GetString("user_id"), c.Param("id"), request)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	c.JSON(201, gin.H{
+		"code":    201,
+		"message": "Payment recorded successfully",
+		"data":    payment,
+	})
+}
+
+func (p *PaymentController) GetLoanPayments(c *gin.Context) {
+	payments, err := p.paymentUsecase.GetLoanPayments(c.GetString("user_id"), c.GetString("role"), c.Param("id"))
+	if err.Message != "" {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "Payments fetched successfully",
+		"data":    payments,
+	})
+}
+
+func (p *PaymentController) ReversePayment(c *gin.Context) {
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{
+			"code":    400,
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	reversal, err := p.paymentUsecase.ReversePayment(c.GetString("user_id"), c.Param("id"), c.Param("payment_id"), request.Reason)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "Payment reversed successfully",
+		"data":    reversal,
+	})
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"io"
+	"loan-tracker-api/domain"
+	"loan-tracker-api/infrastracture"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ProfileImageController struct {
+	ProfileImageUsecase domain.ProfileImageUsecase
+}
+
+func NewProfileImageController(profileImageUsecase domain.ProfileImageUsecase) *ProfileImageController {
+	return &ProfileImageController{ProfileImageUsecase: profileImageUsecase}
+}
+
+// UploadImage expects a multipart form with the file in the "image" field.
+func (p *ProfileImageController) UploadImage(c *gin.Context) {
+	maxBytes := infrastracture.ProfileImageMaxBytes()
+	// leave room for the multipart headers around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+64<<10)
+
+	header, err := c.FormFile("image")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An image file is required in the \"image\" field"})
+		return
+	}
+	if header.Size > maxBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Image is too large"})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image file"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image file"})
+		return
+	}
+
+	user, uerr := p.ProfileImageUsecase.UploadImage(c.GetString("user_id"), header.Header.Get("Content-Type"), data)
+	if uerr.Message != "" {
+		c.JSON(uerr.StatusCode, gin.H{"error": uerr.Message})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "Profile image updated successfully",
+		"data":    user,
+	})
+}
+
+func (p *ProfileImageController) DeleteImage(c *gin.Context) {
+	err := p.ProfileImageUsecase.DeleteImage(c.GetString("user_id"))
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "Profile image deleted successfully",
+	})
+}
+
+// GetImage streams a user's profile image; ?size= picks small, medium (default) or large.
+func (p *ProfileImageController) GetImage(c *gin.Context) {
+	reader, contentType, err := p.ProfileImageUsecase.GetImage(c.Param("id"), c.Query("size"))
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+	defer reader.Close()
+
+	// the URL carries a version, so a stored copy never goes stale
+	c.DataFromReader(http.StatusOK, -1, contentType, reader, map[string]string{
+		"Cache-Control":          "private, max-age=86400",
+		"X-Content-Type-Options": "nosniff",
+	})
+}
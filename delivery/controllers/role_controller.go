@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"loan-tracker-api/domain"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoleController struct {
+	RoleUsecase domain.RoleUsecase
+}
+
+func NewRoleController(roleUsecase domain.RoleUsecase) *RoleController {
+	return &RoleController{RoleUsecase: roleUsecase}
+}
+
+func (r *RoleController) GetPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Permissions retrieved successfully",
+		"data":    r.RoleUsecase.GetPermissions(),
+	})
+}
+
+func (r *RoleController) GetRoles(c *gin.Context) {
+	roles, err := r.RoleUsecase.GetRoles()
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Roles retrieved successfully",
+		"data":    roles,
+	})
+}
+
+func (r *RoleController) CreateRole(c *gin.Context) {
+	var request domain.RoleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	role, err := r.RoleUsecase.CreateRole(c.GetString("user_id"), c.GetString("role"), request)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    201,
+		"message": "Role created successfully",
+		"data":    role,
+	})
+}
+
+func (r *RoleController) UpdateRole(c *gin.Context) {
+	var request domain.RoleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	role, err := r.RoleUsecase.UpdateRole(c.GetString("user_id"), c.GetString("role"), c.Param("name"), request)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Role updated successfully",
+		"data":    role,
+	})
+}
+
+func (r *RoleController) DeleteRole(c *gin.Context) {
+	err := r.RoleUsecase.DeleteRole(c.GetString("user_id"), c.Param("name"))
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Role deleted successfully",
+	})
+}
+
+func (r *RoleController) AssignRole(c *gin.Context) {
+	var request domain.AssignRoleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	user, err := r.RoleUsecase.AssignRole(c.GetString("user_id"), c.GetString("role"), c.Param("id"), request.Role)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Role assigned successfully",
+		"data":    user,
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"loan-tracker-api/infrastracture"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,6 +21,9 @@ func NewUserController(userUsecase domain.UserUsecase) *UserController {
 func (u *UserController) Register(c *gin.Context) {
 	var user domain.User
 	c.BindJSON(&user)
+	if user.PreferredLanguage == "" {
+		user.PreferredLanguage = c.GetHeader("Accept-Language")
+	}
 
 	err := u.UserUsecase.Register(user)
 	if err.Message != "" {
@@ -50,6 +54,25 @@ func (u *UserController) ActivateAccount(c *gin.Context) {
 	
 }
 
+func (u *UserController) ResendActivationEmail(c *gin.Context) {
+	var req domain.ResendActivationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	err := u.UserUsecase.ResendActivationEmail(req.Email)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "If an inactive account exists for this email, a new activation link has been sent",
+	})
+}
+
 
 
 func (u *UserController) Login(c *gin.Context) {
@@ -63,7 +86,7 @@ func (u *UserController) Login(c *gin.Context) {
 	userAgent := c.Request.UserAgent()
 	deviceFingerprint := infrastracture.GenerateDeviceFingerprint(ipAddress, userAgent)
 
-	response, err := u.UserUsecase.Login(&user, deviceFingerprint)
+	response, err := u.UserUsecase.Login(&user, deviceFingerprint, ipAddress)
 	if err.Message != "" {
 		c.JSON(err.StatusCode, err)
 		return
@@ -77,11 +100,143 @@ func (u *UserController) Login(c *gin.Context) {
 	
 }
 
+func (u *UserController) VerifyTwoFactorLogin(c *gin.Context) {
+	var request domain.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := u.UserUsecase.VerifyTwoFactorLogin(request, currentDeviceFingerprint(c), c.ClientIP())
+	if err.Message != "" {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "Login successful",
+		"data":    response,
+	})
+}
+
+// oauthFlowCookie keeps the state, nonce and PKCE verifier of a Google sign-in in the browser that
+// started it, which also ties the callback to that browser
+const oauthFlowCookie = "oauth_flow"
+
+func (u *UserController) GoogleLogin(c *gin.Context) {
+	start, err := u.UserUsecase.StartOAuthLogin()
+	if err.Message != "" {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	flow := start.Flow.State + "." + start.Flow.Nonce + "." + start.Flow.CodeVerifier
+	// Lax, not Strict: the cookie has to come along on the provider's redirect back
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthFlowCookie, flow, 600, "/auth/google", "", isSecureRequest(c), true)
+	c.Redirect(http.StatusFound, start.AuthURL)
+}
+
+func (u *UserController) GoogleCallback(c *gin.Context) {
+	// the flow is single use, whatever the outcome
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthFlowCookie, "", -1, "/auth/google", "", isSecureRequest(c), true)
+
+	if providerError := c.Query("error"); providerError != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign-in was cancelled or denied: " + providerError})
+		return
+	}
+
+	var flow domain.OAuthFlow
+	if cookie, err := c.Cookie(oauthFlowCookie); err == nil {
+		if parts := strings.Split(cookie, "."); len(parts) == 3 {
+			flow = domain.OAuthFlow{State: parts[0], Nonce: parts[1], CodeVerifier: parts[2]}
+		}
+	}
+
+	response, err := u.UserUsecase.OAuthLogin(domain.OAuthCallback{
+		State: c.Query("state"),
+		Code:  c.Query("code"),
+		Flow:  flow,
+	}, currentDeviceFingerprint(c), c.ClientIP())
+	if err.Message != "" {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "Login successful",
+		"data":    response,
+	})
+}
+
+func isSecureRequest(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+func (u *UserController) EnrollTwoFactor(c *gin.Context) {
+	enrollment, err := u.UserUsecase.EnrollTwoFactor(c.GetString("user_id"))
+	if err.Message != "" {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "Scan the secret with your authenticator app and confirm with a code",
+		"data":    enrollment,
+	})
+}
+
+func (u *UserController) ConfirmTwoFactor(c *gin.Context) {
+	var request domain.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	recoveryCodes, err := u.UserUsecase.ConfirmTwoFactor(c.GetString("user_id"), request.Code)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "Two-factor authentication enabled. Store these recovery codes somewhere safe, they are shown only once",
+		"data": gin.H{
+			"recovery_codes": recoveryCodes,
+		},
+	})
+}
+
+func (u *UserController) DisableTwoFactor(c *gin.Context) {
+	var request domain.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := u.UserUsecase.DisableTwoFactor(c.GetString("user_id"), request.Code)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "Two-factor authentication disabled",
+	})
+}
+
 func (u *UserController) RefreshToken(c *gin.Context) {
 	var refreshRequest domain.RefreshTokenRequest
 
 	if err := c.ShouldBindJSON(&refreshRequest); err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
+		return
 	}
 	ipAddress := c.ClientIP()
 	userAgent := c.Request.UserAgent()
@@ -103,6 +258,74 @@ func (u *UserController) RefreshToken(c *gin.Context) {
 }
 
 
+func (u *UserController) Logout(c *gin.Context) {
+	var logoutRequest domain.LogoutRequest
+	// the body is optional; without a token the current device is logged out
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&logoutRequest); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	uerr := u.UserUsecase.Logout(c.GetString("user_id"), currentDeviceFingerprint(c), logoutRequest.Token, c.GetString("token_id"), c.GetTime("token_expires_at"))
+	if uerr.Message != "" {
+		c.JSON(uerr.StatusCode, uerr)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "Logged out successfully",
+	})
+}
+
+func (u *UserController) LogoutAll(c *gin.Context) {
+	uerr := u.UserUsecase.LogoutAll(c.GetString("user_id"))
+	if uerr.Message != "" {
+		c.JSON(uerr.StatusCode, uerr)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "Logged out of all devices successfully",
+	})
+}
+
+func (u *UserController) GetSessions(c *gin.Context) {
+	sessions, uerr := u.UserUsecase.GetSessions(c.GetString("user_id"), currentDeviceFingerprint(c))
+	if uerr.Message != "" {
+		c.JSON(uerr.StatusCode, uerr)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "Sessions fetched successfully",
+		"data":    sessions,
+	})
+}
+
+func (u *UserController) RevokeSession(c *gin.Context) {
+	uerr := u.UserUsecase.RevokeSession(c.GetString("user_id"), c.Param("device_id"))
+	if uerr.Message != "" {
+		c.JSON(uerr.StatusCode, uerr)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "Session revoked successfully",
+	})
+}
+
+// currentDeviceFingerprint identifies the calling device the same way Login does.
+func currentDeviceFingerprint(c *gin.Context) string {
+	return infrastracture.GenerateDeviceFingerprint(c.ClientIP(), c.Request.UserAgent())
+}
+
+
 func (u *UserController)GetMyProfile(c *gin.Context) {
 	userID := c.GetString("user_id")
 	user, err := u.UserUsecase.GetMyProfile(userID)
@@ -118,6 +341,77 @@ func (u *UserController)GetMyProfile(c *gin.Context) {
 	})
 }
 
+func (u *UserController) UpdateProfile(c *gin.Context) {
+	var request domain.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	user, err := u.UserUsecase.UpdateProfile(c.GetString("user_id"), request)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "Profile updated successfully",
+		"data":    user,
+	})
+}
+
+func (u *UserController) RequestEmailChange(c *gin.Context) {
+	var request domain.ChangeEmailRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	err := u.UserUsecase.RequestEmailChange(c.GetString("user_id"), request)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "A confirmation link has been sent to the new email address",
+	})
+}
+
+func (u *UserController) ConfirmEmailChange(c *gin.Context) {
+	err := u.UserUsecase.ConfirmEmailChange(c.Query("token"))
+	if err.Message != "" {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "Your email address has been changed",
+	})
+}
+
+func (u *UserController) ChangePassword(c *gin.Context) {
+	var request domain.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	err := u.UserUsecase.ChangePassword(c.GetString("user_id"), request)
+	if err.Message != "" {
+		c.JSON(err.StatusCode, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":    200,
+		"message": "Password changed. Please log in again on all devices",
+	})
+}
+
 func (u *UserController) GetUsers(c *gin.Context) {
 	byName := c.Query("name")
 	limit := c.Query("limit") 
@@ -150,23 +444,20 @@ func (u *UserController) GetUsers(c *gin.Context) {
 }
 
 
-func (u *UserController) DeleteUser(c *gin.Context) {
-	userID := c.Param("id")
-	user, err := u.UserUsecase.DeleteUser(userID)
+func (u *UserController) UnlockUser(c *gin.Context) {
+	err := u.UserUsecase.UnlockUser(c.GetString("user_id"), c.Param("id"))
 	if err.Message != "" {
 		c.JSON(err.StatusCode, err)
 		return
 	}
 
 	c.JSON(200, gin.H{
-		"code": 200,
-		"message": "User deleted successfully",
-		"data": user,
+		"code":    200,
+		"message": "User unlocked successfully",
 	})
 }
 
 
-
 func (uc *UserController) SendPasswordResetLink(c *gin.Context) {
 	var req domain.ResetPasswordRequest
 
@@ -188,6 +479,22 @@ func (uc *UserController) SendPasswordResetLink(c *gin.Context) {
 		"message": "Password reset link sent"})
 }
 
+// ResetPasswordPage is where the links in reset, invite and lockout emails land. With a token it
+// asks for the new password, without one for the address to send a link to; both forms post to
+// the JSON endpoints below.
+func (uc *UserController) ResetPasswordPage(c *gin.Context) {
+	page, err := infrastracture.RenderPage("reset_password.html", gin.H{"Token": c.Param("token")})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render page"})
+		return
+	}
+
+	// the token is in the URL, so it must not be cached or sent on to other sites
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+}
+
 func (uc *UserController) ResetPassword(c *gin.Context) {
 	var req struct {
 		Password string `json:"password"`
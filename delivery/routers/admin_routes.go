@@ -4,6 +4,7 @@ package routers
 import (
 	"loan-tracker-api/config/db"
 	"loan-tracker-api/delivery/controllers"
+	"loan-tracker-api/domain"
 	"loan-tracker-api/infrastracture"
 	"loan-tracker-api/repository"
 	"loan-tracker-api/usecase"
@@ -11,37 +12,85 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func setUpAdminRoutes(router *gin.Engine) {
+func setUpAdminRoutes(router *gin.Engine, tokenGen domain.TokenGenerator, tokenVerifier domain.TokenVerifier, revocationStore domain.TokenRevocationStore, notifier domain.NotificationUsecase, outboxUsecase domain.OutboxUsecase, roleUsecase domain.RoleUsecase) {
     // Initialize repository with database collection
     userRepo := repository.NewUserRepositoryImpl(db.UserCollection)
     loanRepo := repository.NewLoanRepositoryImpl(db.LoanCollection)
     logRepo := repository.NewLogRepositoryImpl(db.LogCollection)
+    paymentRepo := repository.NewPaymentRepositoryImpl(db.PaymentCollection)
 
-    // Initialize token generator and password service
-    tokenGen := infrastracture.NewTokenGenerator()
+    // Initialize password service
     passwordSvc := infrastracture.NewPasswordService()
+    loginThrottle := infrastracture.NewLoginThrottle(repository.NewLoginAttemptRepositoryImpl(db.LoginAttemptCollection))
+    transactor := repository.NewTransactor(db.Client)
 
     // Initialize usecase with dependencies
-    userUsecase := usecase.NewUserUsecase(userRepo, tokenGen, passwordSvc, logRepo)
-    loanUsecase := usecase.NewLoanUsecase(loanRepo)
+    userUsecase := usecase.NewUserUsecase(userRepo, tokenGen, passwordSvc, logRepo, revocationStore, loginThrottle, notifier, infrastracture.NewGoogleOAuthClient(), transactor)
+    loanUsecase := usecase.NewLoanUsecase(loanRepo, logRepo, notifier, roleUsecase, transactor)
     logUsecase := usecase.NewLogUsecase(logRepo)
+    paymentUsecase := usecase.NewPaymentUsecase(paymentRepo, loanRepo, logRepo, notifier, transactor, roleUsecase)
+    adminUserUsecase := usecase.NewAdminUserUsecase(userRepo, loanRepo, repository.NewRoleRepositoryImpl(db.RoleCollection), passwordSvc, logRepo, revocationStore, notifier, roleUsecase, tokenGen, transactor)
+    apiKeyUsecase := usecase.NewAPIKeyUsecase(repository.NewAPIKeyRepositoryImpl(db.APIKeyCollection), userRepo, roleUsecase, logRepo)
 
     // Initialize controller with usecase
     userController := controllers.NewUserController(userUsecase)
     loanController := controllers.NewLoanController(loanUsecase)
     logController := controllers.NewLogController(logUsecase)
+    paymentController := controllers.NewPaymentController(paymentUsecase)
+    notificationController := controllers.NewNotificationController(notifier)
+    outboxController := controllers.NewOutboxController(outboxUsecase)
+    roleController := controllers.NewRoleController(roleUsecase)
+    adminUserController := controllers.NewAdminUserController(adminUserUsecase)
+    apiKeyController := controllers.NewAPIKeyController(apiKeyUsecase)
+
+    // every route states the permission it needs; the group only authenticates. API keys are
+    // accepted here and nowhere else, so a key can't act on its owner's own account
+    can := func(permission string) gin.HandlerFunc {
+        return infrastracture.RequirePermission(roleUsecase, permission)
+    }
 
     Admin := router.Group("/admin")
-    Admin.Use(infrastracture.AuthMiddleware(), infrastracture.RoleMiddleware("admin"))
+    Admin.Use(infrastracture.AuthMiddleware(tokenVerifier, revocationStore, apiKeyUsecase, logRepo), infrastracture.TwoFactorPolicyMiddleware())
     {
-        Admin.GET("/users", userController.GetUsers)
-        Admin.DELETE("/users/:id", userController.DeleteUser)
-
-        Admin.GET("/loans", loanController.GetLoans)
-        Admin.PATCH("/loans/:id/status", loanController.UpdateLoanStatus)
-        Admin.DELETE("/loans/:id", loanController.DeleteLoan)
-
-        Admin.GET("/logs", logController.GetLogs) 
+        Admin.GET("/users", can(domain.PermUsersRead), userController.GetUsers)
+        Admin.POST("/users", can(domain.PermUsersCreate), adminUserController.CreateUser)
+        Admin.GET("/users/deleted", can(domain.PermUsersRead), adminUserController.GetDeletedUsers)
+        Admin.GET("/users/:id", can(domain.PermUsersRead), adminUserController.GetUser)
+        Admin.PATCH("/users/:id", can(domain.PermUsersUpdate), adminUserController.UpdateUser)
+        Admin.POST("/users/:id/suspend", can(domain.PermUsersUpdate), adminUserController.SuspendUser)
+        Admin.POST("/users/:id/reactivate", can(domain.PermUsersUpdate), adminUserController.ReactivateUser)
+        Admin.POST("/users/:id/force-password-reset", can(domain.PermUsersUpdate), adminUserController.ForcePasswordReset)
+        Admin.DELETE("/users/:id", can(domain.PermUsersDelete), adminUserController.DeleteUser)
+        Admin.POST("/users/:id/restore", can(domain.PermUsersDelete), adminUserController.RestoreUser)
+        Admin.POST("/users/:id/unlock", can(domain.PermUsersUnlock), userController.UnlockUser)
+        Admin.POST("/users/:id/impersonate", can(domain.PermUsersImpersonate), adminUserController.ImpersonateUser)
+        Admin.PUT("/users/:id/role", can(domain.PermRolesAssign), roleController.AssignRole)
+
+        Admin.GET("/permissions", can(domain.PermRolesManage), roleController.GetPermissions)
+        Admin.GET("/roles", can(domain.PermRolesManage), roleController.GetRoles)
+        Admin.POST("/roles", can(domain.PermRolesManage), roleController.CreateRole)
+        Admin.PUT("/roles/:name", can(domain.PermRolesManage), roleController.UpdateRole)
+        Admin.DELETE("/roles/:name", can(domain.PermRolesManage), roleController.DeleteRole)
+
+        Admin.GET("/loans", can(domain.PermLoansRead), loanController.GetLoans)
+        Admin.PATCH("/loans/:id/status", can(domain.PermLoansApprove), loanController.UpdateLoanStatus)
+        Admin.DELETE("/loans/:id", can(domain.PermLoansDelete), loanController.DeleteLoan)
+        Admin.POST("/loans/:id/restore", can(domain.PermLoansDelete), loanController.RestoreLoan)
+        Admin.POST("/loans/:id/payments", can(domain.PermPaymentsRecord), paymentController.RecordPayment)
+        Admin.POST("/loans/:id/payments/:payment_id/reverse", can(domain.PermPaymentsReverse), paymentController.ReversePayment)
+
+        Admin.GET("/email-templates", can(domain.PermNotificationsManage), notificationController.GetEmailTemplates)
+        Admin.GET("/email-templates/:name/preview", can(domain.PermNotificationsManage), notificationController.PreviewEmailTemplate)
+
+        Admin.GET("/outbox", can(domain.PermNotificationsManage), outboxController.GetMessages)
+        Admin.GET("/outbox/:id", can(domain.PermNotificationsManage), outboxController.GetMessage)
+        Admin.POST("/outbox/:id/redrive", can(domain.PermNotificationsManage), outboxController.RedriveMessage)
+
+        Admin.GET("/logs", can(domain.PermLogsRead), logController.GetLogs) 
+
+        Admin.GET("/api-keys", can(domain.PermAPIKeysManage), apiKeyController.GetKeys)
+        Admin.POST("/api-keys", can(domain.PermAPIKeysManage), apiKeyController.CreateKey)
+        Admin.DELETE("/api-keys/:id", can(domain.PermAPIKeysManage), apiKeyController.RevokeKey)
     }
 }
 
@@ -77,7 +126,7 @@ func setUpAdminRoutes(router *gin.Engine) {
 // 	loanController := controllers.NewLoanController(loanUsecase)
 
 // 	Admin := router.Group("/admin")
-// 	Admin.Use(infrastracture.AuthMiddleware(), infrastracture.RoleMiddleware("admin"))
+// 	Admin.Use(infrastracture.AuthMiddleware(revocationStore), infrastracture.RoleMiddleware("admin"))
 // 	{
 // 		Admin.GET("/users", userController.GetUsers)
 // 		Admin.DELETE("/users/:id", userController.DeleteUser)
@@ -3,6 +3,7 @@ package routers
 import (
 	"loan-tracker-api/config/db"
 	"loan-tracker-api/delivery/controllers"
+	"loan-tracker-api/domain"
 	"loan-tracker-api/infrastracture"
 	"loan-tracker-api/repository"
 	"loan-tracker-api/usecase"
@@ -10,34 +11,51 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func setUpAuthRoutes(router *gin.Engine) {
+func setUpAuthRoutes(router *gin.Engine, tokenGen domain.TokenGenerator, tokenVerifier domain.TokenVerifier, revocationStore domain.TokenRevocationStore, notifier domain.NotificationUsecase) {
 	// Initialize repository with database collection
 	userRepo := repository.NewUserRepositoryImpl(db.UserCollection)
 	logRepo := repository.NewLogRepositoryImpl(db.LogCollection)
 
-	// Initialize token generator and password service
-	tokenGen := infrastracture.NewTokenGenerator() 
+	// Initialize password service
 	passwordSvc := infrastracture.NewPasswordService()
+	loginThrottle := infrastracture.NewLoginThrottle(repository.NewLoginAttemptRepositoryImpl(db.LoginAttemptCollection))
 
 	// Initialize usecase with dependencies
-	userUsecase := usecase.NewUserUsecase(userRepo, tokenGen, passwordSvc, logRepo)
+	userUsecase := usecase.NewUserUsecase(userRepo, tokenGen, passwordSvc, logRepo, revocationStore, loginThrottle, notifier, infrastracture.NewGoogleOAuthClient(), repository.NewTransactor(db.Client))
 
 	// Initialize controller with usecase
 	authController := controllers.NewUserController(userUsecase)
+	jwksController := controllers.NewJWKSController(tokenVerifier)
 	
 
 	auth := router.Group("/users")
 	{
 		auth.POST("/register", authController.Register)
 		auth.GET("/verify-email", authController.ActivateAccount)
+		auth.POST("/verify-email/resend", authController.ResendActivationEmail)
+		// opened from the email sent to the new address, so it can't require a login
+		auth.GET("/profile/email/confirm", authController.ConfirmEmailChange)
 		auth.POST("/login", authController.Login)
+		auth.POST("/login/2fa", authController.VerifyTwoFactorLogin)
 		auth.POST("/token/refresh", authController.RefreshToken)
 		
 
 
+		// the GET pages are where emailed links land; they post to the JSON endpoints
+		auth.GET("/reset-password", authController.ResetPasswordPage)
 		auth.POST("/reset-password", authController.SendPasswordResetLink)
+		auth.GET("/reset-password/:token", authController.ResetPasswordPage)
 		auth.POST("/reset-password/:token", authController.ResetPassword)
 		
 	}
+
+	// other services fetch our public keys here to verify tokens themselves
+	router.GET("/.well-known/jwks.json", jwksController.GetJWKS)
+
+	oauth := router.Group("/auth")
+	{
+		oauth.GET("/google", authController.GoogleLogin)
+		oauth.GET("/google/callback", authController.GoogleCallback)
+	}
 	
 }
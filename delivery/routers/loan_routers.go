@@ -3,6 +3,7 @@ package routers
 import (
 	"loan-tracker-api/config/db"
 	"loan-tracker-api/delivery/controllers"
+	"loan-tracker-api/domain"
 	"loan-tracker-api/infrastracture"
 	"loan-tracker-api/repository"
 	"loan-tracker-api/usecase"
@@ -10,16 +11,27 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func setUpLoanRoutes(router *gin.Engine) {
+func setUpLoanRoutes(router *gin.Engine, tokenVerifier domain.TokenVerifier, revocationStore domain.TokenRevocationStore, notifier domain.NotificationUsecase, roleUsecase domain.RoleUsecase) {
 	LoanRepo := repository.NewLoanRepositoryImpl(db.LoanCollection)
-	LoanUsecase := usecase.NewLoanUsecase(LoanRepo)
+	LogRepo := repository.NewLogRepositoryImpl(db.LogCollection)
+	Transactor := repository.NewTransactor(db.Client)
+	LoanUsecase := usecase.NewLoanUsecase(LoanRepo, LogRepo, notifier, roleUsecase, Transactor)
 	LoanController := controllers.NewLoanController(LoanUsecase)
+	PaymentRepo := repository.NewPaymentRepositoryImpl(db.PaymentCollection)
+	PaymentUsecase := usecase.NewPaymentUsecase(PaymentRepo, LoanRepo, LogRepo, notifier, Transactor, roleUsecase)
+	PaymentController := controllers.NewPaymentController(PaymentUsecase)
 	// controllers.NewLoanController(LoanUsecase)
 
 	Loan := router.Group("/loans")
-	Loan.Use(infrastracture.AuthMiddleware())
+	Loan.Use(infrastracture.AuthMiddleware(tokenVerifier, revocationStore, nil, LogRepo))
 	{
 		Loan.POST("/", LoanController.CreateLoan)
+		Loan.GET("/", LoanController.GetMyLoans)
 		Loan.GET("/:id",LoanController.GetLoanByID)
+		Loan.PATCH("/:id", LoanController.UpdateLoan)
+		Loan.POST("/:id/cancel", LoanController.CancelLoan)
+		Loan.GET("/:id/schedule", LoanController.GetLoanSchedule)
+		Loan.GET("/:id/history", LoanController.GetLoanHistory)
+		Loan.GET("/:id/payments", PaymentController.GetLoanPayments)
 	}
 }
\ No newline at end of file
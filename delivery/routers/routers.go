@@ -2,16 +2,42 @@
 package routers
 
 import (
+	"loan-tracker-api/config"
+	"loan-tracker-api/config/db"
+	"loan-tracker-api/domain"
+	"loan-tracker-api/infrastracture"
+	"loan-tracker-api/repository"
+	"loan-tracker-api/usecase"
+	"log"
+	"time"
+
 	"github.com/gin-gonic/gin"
 )
 
 func SetupRouter() *gin.Engine {
     router := gin.Default()
 
-    setUpAuthRoutes(router)
-    setUpUserRoutes(router)
-    setUpAdminRoutes(router)
-    setUpLoanRoutes(router)
+    // one store is shared by every route group so the in-memory backend sees all revocations
+    revocationStore := newTokenRevocationStore()
+    // emails are queued in the outbox and delivered by a background worker
+    outboxRepo := repository.NewOutboxRepositoryImpl(db.OutboxCollection)
+    outboxUsecase := usecase.NewOutboxUsecase(outboxRepo, infrastracture.NewMailer(), repository.NewLogRepositoryImpl(db.LogCollection))
+    notifier := usecase.NewNotificationUsecase(repository.NewUserRepositoryImpl(db.UserCollection), infrastracture.NewEmailRenderer(), outboxRepo)
+
+    // roles are cached in the usecase, so one instance answers every permission check
+    roleUsecase := usecase.NewRoleUsecase(repository.NewRoleRepositoryImpl(db.RoleCollection), repository.NewUserRepositoryImpl(db.UserCollection), repository.NewLogRepositoryImpl(db.LogCollection), revocationStore, repository.NewTransactor(db.Client))
+
+    // every token is signed and checked with the same key set, loaded once
+    jwtService := infrastracture.NewJWTService(infrastracture.NewKeySet())
+
+    setUpAuthRoutes(router, jwtService, jwtService, revocationStore, notifier)
+    setUpUserRoutes(router, jwtService, jwtService, revocationStore, notifier)
+    setUpAdminRoutes(router, jwtService, jwtService, revocationStore, notifier, outboxUsecase, roleUsecase)
+    setUpLoanRoutes(router, jwtService, revocationStore, notifier, roleUsecase)
+
+    startOutboxWorker(outboxUsecase)
+    startOverdueReminders(notifier, roleUsecase)
+    startPurgeJob()
     
 
 
@@ -19,3 +45,85 @@ func SetupRouter() *gin.Engine {
     return router
 }
 
+func newTokenRevocationStore() domain.TokenRevocationStore {
+    accessTokenTTL := time.Hour * time.Duration(config.EnvConfigs.AccessTokenExpiryHour)
+    if config.EnvConfigs.TokenRevocationStore == "memory" {
+        return repository.NewMemoryTokenRevocationStore(accessTokenTTL)
+    }
+    return repository.NewMongoTokenRevocationStore(db.RevokedTokenCollection, accessTokenTTL)
+}
+
+// startOutboxWorker polls the outbox for due messages. Every API instance runs one; claims are
+// leased so two workers never send the same message at the same time.
+func startOutboxWorker(outboxUsecase domain.OutboxUsecase) {
+    interval := time.Duration(config.EnvConfigs.OutboxPollSeconds) * time.Second
+    if interval <= 0 {
+        interval = 5 * time.Second
+    }
+
+    go func() {
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for {
+            if _, err := outboxUsecase.DeliverDue(time.Now()); err.Message != "" {
+                log.Printf("Error delivering outbox messages: %s", err.Message)
+            }
+            <-ticker.C
+        }
+    }()
+}
+
+// startOverdueReminders checks for missed installments once an hour for the lifetime of the process.
+func startOverdueReminders(notifier domain.NotificationUsecase, roleUsecase domain.RoleUsecase) {
+    paymentUsecase := usecase.NewPaymentUsecase(
+        repository.NewPaymentRepositoryImpl(db.PaymentCollection),
+        repository.NewLoanRepositoryImpl(db.LoanCollection),
+        repository.NewLogRepositoryImpl(db.LogCollection),
+        notifier,
+        repository.NewTransactor(db.Client),
+        roleUsecase,
+    )
+
+    go func() {
+        ticker := time.NewTicker(time.Hour)
+        defer ticker.Stop()
+        for {
+            sent, err := paymentUsecase.SendOverdueReminders(time.Now())
+            if err.Message != "" {
+                log.Printf("Error sending overdue reminders: %s", err.Message)
+            } else if sent > 0 {
+                log.Printf("Sent %d overdue payment reminders", sent)
+            }
+            <-ticker.C
+        }
+    }()
+}
+
+// startPurgeJob hard-deletes soft-deleted records once their retention period has passed.
+func startPurgeJob() {
+    retentionUsecase := usecase.NewRetentionUsecase(
+        repository.NewUserRepositoryImpl(db.UserCollection),
+        repository.NewLoanRepositoryImpl(db.LoanCollection),
+        repository.NewPaymentRepositoryImpl(db.PaymentCollection),
+        repository.NewLogRepositoryImpl(db.LogCollection),
+        infrastracture.NewBlobStore(),
+    )
+    interval := time.Duration(config.EnvConfigs.PurgeIntervalHours) * time.Hour
+    if interval <= 0 {
+        interval = 24 * time.Hour
+    }
+
+    go func() {
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for {
+            purged, err := retentionUsecase.PurgeDeleted(time.Now())
+            if err.Message != "" {
+                log.Printf("Error purging deleted records: %s", err.Message)
+            } else if purged.Users > 0 || purged.Loans > 0 {
+                log.Printf("Purged %d users and %d loans past their retention period", purged.Users, purged.Loans)
+            }
+            <-ticker.C
+        }
+    }()
+}
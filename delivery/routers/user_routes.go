@@ -3,6 +3,7 @@ package routers
 import (
 	"loan-tracker-api/config/db"
 	"loan-tracker-api/delivery/controllers"
+	"loan-tracker-api/domain"
 	"loan-tracker-api/infrastracture"
 	"loan-tracker-api/repository"
 	"loan-tracker-api/usecase"
@@ -10,26 +11,44 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func setUpUserRoutes(router *gin.Engine) {
+func setUpUserRoutes(router *gin.Engine, tokenGen domain.TokenGenerator, tokenVerifier domain.TokenVerifier, revocationStore domain.TokenRevocationStore, notifier domain.NotificationUsecase) {
 	// Initialize repository with database collection
 	userRepo := repository.NewUserRepositoryImpl(db.UserCollection)
 	logRepo := repository.NewLogRepositoryImpl(db.LogCollection)
 
-	// Initialize token generator and password service
-	tokenGen := infrastracture.NewTokenGenerator()
+	// Initialize password service
 	passwordSvc := infrastracture.NewPasswordService()
+	loginThrottle := infrastracture.NewLoginThrottle(repository.NewLoginAttemptRepositoryImpl(db.LoginAttemptCollection))
 
 	// Initialize usecase with dependencies
-	userUsecase := usecase.NewUserUsecase(userRepo, tokenGen, passwordSvc, logRepo)
+	userUsecase := usecase.NewUserUsecase(userRepo, tokenGen, passwordSvc, logRepo, revocationStore, loginThrottle, notifier, infrastracture.NewGoogleOAuthClient(), repository.NewTransactor(db.Client))
 
 	// Initialize controller with usecase
 	userController := controllers.NewUserController(userUsecase)
 
+	profileImageUsecase := usecase.NewProfileImageUsecase(userRepo, infrastracture.NewBlobStore(), logRepo)
+	profileImageController := controllers.NewProfileImageController(profileImageUsecase)
+
 	user := router.Group("/users")
 
-	user.Use(infrastracture.AuthMiddleware())
+	user.Use(infrastracture.AuthMiddleware(tokenVerifier, revocationStore, nil, logRepo))
 	{
 		user.GET("/profile", userController.GetMyProfile)
+		user.PATCH("/profile", userController.UpdateProfile)
+		user.POST("/profile/email", userController.RequestEmailChange)
+		user.POST("/profile/password", userController.ChangePassword)
+		user.PUT("/profile/image", profileImageController.UploadImage)
+		user.DELETE("/profile/image", profileImageController.DeleteImage)
+		user.GET("/:id/image", profileImageController.GetImage)
+
+		user.POST("/logout", userController.Logout)
+		user.POST("/logout-all", userController.LogoutAll)
+		user.GET("/sessions", userController.GetSessions)
+		user.DELETE("/sessions/:device_id", userController.RevokeSession)
+
+		user.POST("/2fa/enroll", userController.EnrollTwoFactor)
+		user.POST("/2fa/confirm", userController.ConfirmTwoFactor)
+		user.POST("/2fa/disable", userController.DisableTwoFactor)
 
 	}
 
@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APIKey lets a service call the admin API on behalf of the admin who created it. It grants
+// only the permissions in Scopes that the owner's role still holds. The key itself is shown
+// once; only its hash is stored, and Prefix identifies it in listings.
+type APIKey struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name       string             `json:"name" bson:"name"`
+	Prefix     string             `json:"prefix" bson:"prefix"`
+	KeyHash    string             `json:"-" bson:"key_hash"`
+	OwnerID    string             `json:"owner_id" bson:"owner_id"`
+	Scopes     []string           `json:"scopes" bson:"scopes"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	ExpiresAt  time.Time          `json:"expires_at" bson:"expires_at"`
+	LastUsedAt time.Time          `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+	RevokedAt  time.Time          `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	RevokedBy  string             `json:"revoked_by,omitempty" bson:"revoked_by,omitempty"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresInDays defaults to 90 and may not exceed 365
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+// CreatedAPIKey is the only response that ever contains the key.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyPrincipal is who a valid key acts as.
+type APIKeyPrincipal struct {
+	Key   APIKey
+	Owner User
+}
+
+type APIKeyRepository interface {
+	CreateKey(key APIKey) (APIKey, error)
+	// GetKeyByHash returns mongo.ErrNoDocuments for unknown keys; revoked and expired keys are returned.
+	GetKeyByHash(keyHash string) (APIKey, error)
+	GetKeys() ([]APIKey, error)
+	RevokeKey(id, revokedBy string, at time.Time) (APIKey, error)
+	TouchKey(id primitive.ObjectID, at time.Time) error
+}
+
+// ErrInvalidAPIKey covers unknown, revoked and expired keys and keys whose owner can't sign in.
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// APIKeyAuthenticator resolves the X-API-Key header for AuthMiddleware.
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(key string) (APIKeyPrincipal, error)
+}
+
+type APIKeyUsecase interface {
+	APIKeyAuthenticator
+	CreateKey(actorID, actorRole string, request CreateAPIKeyRequest) (CreatedAPIKey, ErrorResponse)
+	GetKeys() ([]APIKey, ErrorResponse)
+	RevokeKey(actorID, id string) (APIKey, ErrorResponse)
+}
@@ -0,0 +1,17 @@
+package domain
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrBlobNotFound is returned by BlobStore.Get when nothing is stored under the key.
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore keeps binary objects such as uploaded images under slash separated keys.
+type BlobStore interface {
+	Put(key, contentType string, data []byte) error
+	// Get returns the object and its content type; the caller closes the reader.
+	Get(key string) (io.ReadCloser, string, error)
+	Delete(key string) error
+}
@@ -23,7 +23,14 @@ type JwtCustomClaims struct {
 	Role       string `json:"role"`
 	Username   string `json:"username"`
 	IsActivated bool `json:"is_activated"`
+	TwoFactor   bool   `json:"two_factor"`
+	// Purpose is empty for access tokens and "refresh" or "2fa_challenge" for the others, which AuthMiddleware
+	// rejects. The aud claim and typ header tell the kinds apart for services verifying with our JWKS.
+	Purpose string `json:"purpose,omitempty"`
+	// ImpersonatedBy is the admin acting as UserID; such tokens are read-only
+	ImpersonatedBy string `json:"impersonated_by,omitempty"`
 
+	// StandardClaims.Id carries the token ID (jti) checked against the revocation store
 	jwt.StandardClaims
 }
 
@@ -33,3 +40,20 @@ type JwtCustomClaims struct {
 // 	Role() string
 // 	Username() string
 // }
+
+// JWK is the public part of a token signing key, as published in the JWKS document (RFC 7517).
+// RSA keys fill N and E, Ed25519 keys Curve and X.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
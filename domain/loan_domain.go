@@ -1,7 +1,10 @@
 package domain
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -16,6 +19,176 @@ type Loan struct {
 	CreatedAt     primitive.Timestamp `json:"created_at" bson:"createdAt"`
 	UpdatedAt     primitive.Timestamp `json:"-" bson:"updatedAt"`
 	Status        string              `json:"status"`
+
+	TermMonths         int                `json:"term_months" bson:"term_months"`
+	InterestRate       float64            `json:"interest_rate" bson:"interest_rate"`
+	RepaymentFrequency string             `json:"repayment_frequency" bson:"repayment_frequency"`
+	Schedule           []Installment      `json:"-" bson:"schedule,omitempty"`
+	Outstanding        LoanBalance        `json:"-" bson:"outstanding"`
+	StatusHistory      []LoanStatusChange `json:"-" bson:"status_history,omitempty"`
+	CancellationReason string             `json:"cancellation_reason,omitempty" bson:"cancellation_reason,omitempty"`
+
+	// OverdueNotifiedAt is when the borrower was last reminded about a missed installment
+	OverdueNotifiedAt time.Time `json:"-" bson:"overdue_notified_at,omitempty"`
+	// LateFeesAssessedThrough is the due date of the last installment a late fee was charged for
+	LateFeesAssessedThrough time.Time `json:"-" bson:"late_fees_assessed_through,omitempty"`
+
+	// soft deletion; the record is kept for the retention period and then purged
+	DeletedAt time.Time `json:"-" bson:"deleted_at,omitempty"`
+	DeletedBy string    `json:"-" bson:"deleted_by,omitempty"`
+}
+
+// CreateLoanRequest is what a borrower submits when applying for a loan. The interest rate is
+// not part of it; staff set it when they approve the loan.
+type CreateLoanRequest struct {
+	Title              string  `json:"title"`
+	Description        string  `json:"description"`
+	Amount             float64 `json:"amount"`
+	TermMonths         int     `json:"term_months"`
+	RepaymentFrequency string  `json:"repayment_frequency"`
+}
+
+// LoanStatusRequest moves a loan to another status. InterestRate is required when approving,
+// since the repayment schedule is built from it, and rejected for every other status.
+type LoanStatusRequest struct {
+	Status       string   `json:"status"`
+	Reason       string   `json:"reason"`
+	InterestRate *float64 `json:"interest_rate"`
+}
+
+// LoanUpdateRequest is a partial update of a pending loan application; nil fields are left unchanged.
+// Like CreateLoanRequest it has no interest rate.
+type LoanUpdateRequest struct {
+	Title              *string  `json:"title"`
+	Description        *string  `json:"description"`
+	Amount             *float64 `json:"amount"`
+	TermMonths         *int     `json:"term_months"`
+	RepaymentFrequency *string  `json:"repayment_frequency"`
+}
+
+// Loan lifecycle statuses.
+const (
+	LoanPending     = "pending"
+	LoanUnderReview = "under_review"
+	LoanApproved    = "approved"
+	LoanDisbursed   = "disbursed"
+	LoanActive      = "active"
+	LoanRepaid      = "repaid"
+	LoanDefaulted   = "defaulted"
+	LoanWrittenOff  = "written_off"
+	LoanRejected    = "rejected"
+	LoanCancelled   = "cancelled"
+)
+
+// loanTransitions lists, for every status, the statuses a loan may move to next.
+// Statuses missing from the map (rejected, cancelled, written_off) are final.
+var loanTransitions = map[string][]string{
+	LoanPending:     {LoanUnderReview, LoanRejected, LoanCancelled},
+	LoanUnderReview: {LoanApproved, LoanRejected, LoanCancelled},
+	LoanApproved:    {LoanDisbursed, LoanCancelled},
+	LoanDisbursed:   {LoanActive},
+	LoanActive:      {LoanRepaid, LoanDefaulted},
+	LoanDefaulted:   {LoanActive, LoanRepaid, LoanWrittenOff},
+	// a repaid loan is reopened when one of its payments is reversed
+	LoanRepaid: {LoanActive},
+}
+
+// ActiveLoanStatuses are the statuses in which money is lent out or committed. Neither a loan in
+// one of them nor its borrower is ever purged.
+var ActiveLoanStatuses = []string{LoanApproved, LoanDisbursed, LoanActive, LoanDefaulted}
+
+func IsValidLoanStatus(status string) bool {
+	switch status {
+	case LoanPending, LoanUnderReview, LoanApproved, LoanDisbursed, LoanActive,
+		LoanRepaid, LoanDefaulted, LoanWrittenOff, LoanRejected, LoanCancelled:
+		return true
+	}
+	return false
+}
+
+func CanTransitionLoan(from, to string) bool {
+	for _, next := range loanTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// LoanFilter narrows and orders a loan listing. Zero values mean "no constraint".
+type LoanFilter struct {
+	BorrowerID   string
+	BorrowerName string
+	Search       string
+	Status       string
+	MinAmount    float64
+	MaxAmount    float64
+	CreatedFrom  time.Time
+	CreatedTo    time.Time
+	SortBy       string
+	SortOrder    string
+	Page         int
+	Limit        int
+	// Cursor, when set, continues after the last loan of a previous page and Page is ignored.
+	Cursor string
+	// Deleted lists soft-deleted loans instead of live ones.
+	Deleted bool
+}
+
+// ErrInvalidCursor is returned when a pagination cursor is malformed or was issued for a different sort.
+var ErrInvalidCursor = errors.New("invalid pagination cursor")
+
+// LoanPage is one page of a loan listing.
+type LoanPage struct {
+	Loans      []Loan `json:"loans"`
+	Total      int64  `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// LoanSortFields maps the sort keys accepted by the API to the stored field names.
+var LoanSortFields = map[string]string{
+	"created_at": "createdAt",
+	"amount":     "amount",
+	"title":      "title",
+	"status":     "status",
+}
+
+// LoanStatusChange is a single entry of a loan's status history.
+type LoanStatusChange struct {
+	From      string    `json:"from" bson:"from"`
+	To        string    `json:"to" bson:"to"`
+	ActorID   string    `json:"actor_id" bson:"actor_id"`
+	Reason    string    `json:"reason,omitempty" bson:"reason,omitempty"`
+	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
+}
+
+
+// LoanBalance is what is still owed on a loan, split into the buckets payments are allocated against.
+type LoanBalance struct {
+	Fees      float64 `json:"fees" bson:"fees"`
+	Interest  float64 `json:"interest" bson:"interest"`
+	Principal float64 `json:"principal" bson:"principal"`
+}
+
+func (b LoanBalance) Total() float64 {
+	return b.Fees + b.Interest + b.Principal
+}
+
+// Repayment frequencies supported by the amortization engine.
+const (
+	WeeklyRepayment   = "weekly"
+	BiweeklyRepayment = "biweekly"
+	MonthlyRepayment  = "monthly"
+)
+
+// Installment is a single row of a loan repayment schedule.
+type Installment struct {
+	Number           int       `json:"number" bson:"number"`
+	DueDate          time.Time `json:"due_date" bson:"due_date"`
+	Payment          float64   `json:"payment" bson:"payment"`
+	Principal        float64   `json:"principal" bson:"principal"`
+	Interest         float64   `json:"interest" bson:"interest"`
+	RemainingBalance float64   `json:"remaining_balance" bson:"remaining_balance"`
 }
 
 type LoanResponse struct {
@@ -27,9 +200,24 @@ type LoanResponse struct {
 	Amount       float64             `json:"amount"`
 	CreatedAt    primitive.Timestamp `json:"created_at" bson:"createdAt"`
 	Status       string              `json:"status"`
+
+	TermMonths         int     `json:"term_months"`
+	InterestRate       float64 `json:"interest_rate"`
+	RepaymentFrequency string  `json:"repayment_frequency"`
+
+	Outstanding        LoanBalance `json:"outstanding"`
+	OutstandingBalance float64     `json:"outstanding_balance"`
+	CancellationReason string      `json:"cancellation_reason,omitempty"`
+
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy string     `json:"deleted_by,omitempty"`
 }
 
 func (l *Loan) MarshalJSON() ([]byte, error) {
+	var deletedAt *time.Time
+	if !l.DeletedAt.IsZero() {
+		deletedAt = &l.DeletedAt
+	}
 	return json.Marshal(&LoanResponse{
 		ID:           l.ID,
 		Title:        l.Title,
@@ -39,29 +227,63 @@ func (l *Loan) MarshalJSON() ([]byte, error) {
 		Amount:       l.Amount,
 		CreatedAt:    l.CreatedAt,
 		Status:       l.Status,
+
+		TermMonths:         l.TermMonths,
+		InterestRate:       l.InterestRate,
+		RepaymentFrequency: l.RepaymentFrequency,
+
+		Outstanding:        l.Outstanding,
+		OutstandingBalance: l.Outstanding.Total(),
+		CancellationReason: l.CancellationReason,
+
+		DeletedAt: deletedAt,
+		DeletedBy: l.DeletedBy,
 	})
 }
 
 
 type LoanRepository interface {
 	CreateLoan(loan Loan) (Loan, error)
+	// GetLoanByID and SearchLoans skip soft-deleted loans unless the filter asks for them
+	SoftDeleteLoan(id, deletedBy string, at time.Time) (Loan, error)
+	RestoreLoan(id string) (Loan, error)
+	// DeleteLoan removes the record for good; only the purge job uses it
 	DeleteLoan(id string) (Loan, error)
-	// UpdateLoan(loan Loan, loanID string) (Loan, error)
+	CountActiveLoans(borrowerID string) (int64, error)
+	// CancelOpenLoans cancels every pending or under_review loan of the borrower, recording change
+	// (with each loan's own From) in its history, and returns how many it cancelled.
+	CancelOpenLoans(ctx context.Context, borrowerID string, change LoanStatusChange) (int64, error)
+	GetLoansDeletedBefore(cutoff time.Time, limit int) ([]Loan, error)
+	// GetBorrowerLoanIDs lists every loan of the borrower, soft-deleted or not
+	GetBorrowerLoanIDs(borrowerID string) ([]string, error)
+	UpdateLoan(loan Loan, loanID string) (Loan, error)
 	GetLoanByID(id string) (Loan, error)
-	GetLoans() ([]Loan, error)
-	UpdateLoanStatus(newStatus, loanID string) (Loan, error)
-	// GetUserLoans(borrowerID string) ([]Loan, error)
-
-	// SearchLoan(loan Loan) (error)
+	SearchLoans(filter LoanFilter) (LoanPage, error)
+	// UpdateLoanStatus only applies while the loan is still in change.From; otherwise mongo.ErrNoDocuments.
+	UpdateLoanStatus(ctx context.Context, loanID string, change LoanStatusChange) (Loan, error)
+	// UpdateLoanSchedule stores the terms set on approval: the interest rate and the schedule built from it.
+	UpdateLoanSchedule(ctx context.Context, loanID string, interestRate float64, schedule []Installment, outstanding LoanBalance) (Loan, error)
+	// AdjustLoanBalance adds delta to the outstanding balance. A decrease only applies while every
+	// part of the balance still covers it; otherwise mongo.ErrNoDocuments.
+	AdjustLoanBalance(ctx context.Context, loanID string, delta LoanBalance) (Loan, error)
+	MarkOverdueNotified(ctx context.Context, loanID string, at time.Time) error
+	// AssessLateFees adds fees to the fees balance and moves LateFeesAssessedThrough to through, but
+	// only while it still is previousThrough, so no installment is charged twice; otherwise mongo.ErrNoDocuments.
+	AssessLateFees(ctx context.Context, loanID string, previousThrough, through time.Time, fees float64) (Loan, error)
 }
 
 type LoanUsecase interface {
-	CreateLoan( loan Loan) (Loan, ErrorResponse)
-	DeleteLoan( loanID string) (Loan, ErrorResponse)
-	UpdateLoanStatus(newStatus, loanID string) (Loan, ErrorResponse)
+	CreateLoan(borrowerID, borrowerName string, request CreateLoanRequest) (Loan, ErrorResponse)
+	DeleteLoan(actorID, loanID string) (Loan, ErrorResponse)
+	RestoreLoan(actorID, loanID string) (Loan, ErrorResponse)
+	UpdateLoan(userID, loanID string, update LoanUpdateRequest) (Loan, ErrorResponse)
+	CancelLoan(userID, loanID, reason string) (Loan, ErrorResponse)
+	UpdateLoanStatus(actorID, loanID string, request LoanStatusRequest) (Loan, ErrorResponse)
 	GetLoanByID(userID,Role, loanID string) (Loan, ErrorResponse)
-	GetLoans() ([]Loan, ErrorResponse)
-	// GetUserLoans(borrowerID string) ([]Loan, error)
+	GetLoans(filter LoanFilter) (LoanPage, ErrorResponse)
+	GetLoanSchedule(userID, Role, loanID string) ([]Installment, ErrorResponse)
+	GetLoanHistory(userID, Role, loanID string) ([]LoanStatusChange, ErrorResponse)
+	GetUserLoans(borrowerID string, filter LoanFilter) (LoanPage, ErrorResponse)
 
 
 }
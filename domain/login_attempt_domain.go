@@ -0,0 +1,33 @@
+package domain
+
+import "time"
+
+// LoginAttempt counts consecutive failed logins for a key, which is either an account ("account:<email>")
+// or a client address ("ip:<address>").
+type LoginAttempt struct {
+	Key         string    `bson:"_id"`
+	Failures    int       `bson:"failures"`
+	LastFailure time.Time `bson:"last_failure"`
+	LockedUntil time.Time `bson:"locked_until"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+type LoginAttemptRepository interface {
+	// GetLoginAttempt returns an empty attempt when nothing is recorded for key
+	GetLoginAttempt(key string) (LoginAttempt, error)
+	// RecordFailure counts a failure for key in one atomic update and returns the attempt as it is
+	// afterwards. A counter whose window has passed starts over; reaching threshold while unlocked
+	// locks the key until now+lockout and resets the count.
+	RecordFailure(key string, now time.Time, threshold int, window, lockout time.Duration) (LoginAttempt, error)
+	DeleteLoginAttempt(key string) error
+}
+
+// LoginThrottle decides whether a login may be attempted and records the outcome.
+type LoginThrottle interface {
+	// Check returns how long the caller has to wait before trying again and whether that is because of a lockout
+	Check(email, ip string) (wait time.Duration, locked bool, err error)
+	// RegisterFailure returns a non-zero time when this failure locked the account
+	RegisterFailure(email, ip string) (lockedUntil time.Time, err error)
+	RegisterSuccess(email string) error
+	Unlock(email string) error
+}
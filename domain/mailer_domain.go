@@ -0,0 +1,55 @@
+package domain
+
+import "context"
+
+// EmailMessage is a transactional email. Either body may be empty, but not both.
+type EmailMessage struct {
+	To       string `json:"to"`
+	Subject  string `json:"subject"`
+	HTMLBody string `json:"html_body,omitempty"`
+	TextBody string `json:"text_body,omitempty"`
+}
+
+type Mailer interface {
+	Send(message EmailMessage) error
+}
+
+// transactional email templates, see infrastracture/templates/email
+const (
+	EmailActivation      = "activation"
+	EmailPasswordReset   = "password_reset"
+	EmailPasswordChanged = "password_changed"
+	EmailAccountCreated  = "account_created"
+	EmailChange          = "email_change"
+	EmailChanged         = "email_changed"
+	EmailLoanApproved    = "loan_approved"
+	EmailLoanRejected    = "loan_rejected"
+	EmailPaymentReceived = "payment_received"
+	EmailPaymentOverdue  = "payment_overdue"
+	EmailAccountLocked   = "account_locked"
+)
+
+// EmailRenderer turns a named template into a message for the given locale. Locales
+// without their own variant fall back to the default locale. The returned message has no recipient.
+type EmailRenderer interface {
+	Render(templateName, locale string, data map[string]interface{}) (EmailMessage, error)
+	// Preview renders a template with built-in sample data.
+	Preview(templateName, locale string) (EmailMessage, error)
+	Catalog() EmailTemplateCatalog
+}
+
+type EmailTemplateCatalog struct {
+	Templates     []string `json:"templates"`
+	Locales       []string `json:"locales"`
+	DefaultLocale string   `json:"default_locale"`
+}
+
+type NotificationUsecase interface {
+	// SendEmail renders a template in the recipient's preferred language and queues it in the
+	// outbox. An error means nothing was queued; delivery failures are retried by the outbox worker.
+	// Passing the context of a transaction queues the email only if the transaction commits.
+	SendEmail(ctx context.Context, recipient User, templateName string, data map[string]interface{}) error
+	NotifyUser(ctx context.Context, userID, templateName string, data map[string]interface{}) error
+	ListEmailTemplates() EmailTemplateCatalog
+	PreviewEmail(templateName, locale string) (EmailMessage, ErrorResponse)
+}
@@ -0,0 +1,41 @@
+package domain
+
+// OAuthIdentity is what an OpenID Connect provider asserts about the user who signed in.
+type OAuthIdentity struct {
+	Provider      OAuthProvider
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// OAuthClient runs the authorization code flow with PKCE against one provider. Google's
+// implementation takes its endpoints from the config, so tests can point it at a fake server.
+type OAuthClient interface {
+	// AuthCodeURL is where the browser is sent to sign in; codeChallenge is the S256 PKCE challenge.
+	AuthCodeURL(state, nonce, codeChallenge string) string
+	// Exchange redeems the code from the callback and checks the returned ID token against nonce.
+	Exchange(code, codeVerifier, nonce string) (OAuthIdentity, error)
+}
+
+// OAuthFlow is the per-login secret state kept by the client between the redirect to the
+// provider and the callback.
+type OAuthFlow struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+// OAuthStart is returned when a login begins: the browser goes to AuthURL and Flow must come
+// back with the callback.
+type OAuthStart struct {
+	AuthURL string
+	Flow    OAuthFlow
+}
+
+// OAuthCallback carries the query parameters of the provider's redirect next to the stored flow.
+type OAuthCallback struct {
+	State string
+	Code  string
+	Flow  OAuthFlow
+}
@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	OutboxPending    = "pending"
+	OutboxProcessing = "processing"
+	OutboxSent       = "sent"
+	// OutboxDead messages ran out of attempts and wait for an admin to re-drive them
+	OutboxDead = "dead"
+)
+
+// OutboxMessage is a rendered email waiting for the background worker to deliver it. The bodies
+// are cleared once it is sent and never returned by the admin API.
+type OutboxMessage struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Template      string             `json:"template" bson:"template"`
+	Email         EmailMessage       `json:"email" bson:"email"`
+	Status        string             `json:"status" bson:"status"`
+	Attempts      int                `json:"attempts" bson:"attempts"`
+	LastError     string             `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	NextAttemptAt time.Time          `json:"next_attempt_at" bson:"next_attempt_at"`
+	LockedUntil   time.Time          `json:"-" bson:"locked_until,omitempty"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at" bson:"updated_at"`
+	SentAt        time.Time          `json:"sent_at,omitempty" bson:"sent_at,omitempty"`
+}
+
+type OutboxRepository interface {
+	// Enqueue takes a context so the message can be queued in the same transaction as the change it reports.
+	Enqueue(ctx context.Context, message OutboxMessage) (OutboxMessage, error)
+	// ClaimNext locks the oldest due message for lease and counts the attempt. It returns
+	// mongo.ErrNoDocuments when nothing is due. Messages whose lease ran out are claimable again.
+	ClaimNext(now time.Time, lease time.Duration) (OutboxMessage, error)
+	// MarkSent and MarkFailed take the message as ClaimNext returned it and only update it while
+	// that claim still holds; mongo.ErrNoDocuments means the lease ran out and another worker took over.
+	MarkSent(message OutboxMessage, at time.Time) error
+	// MarkFailed stores the error and either schedules the next attempt (OutboxPending) or gives up (OutboxDead).
+	MarkFailed(message OutboxMessage, status, lastError string, nextAttemptAt time.Time) error
+	GetMessages(status string, page, limit int) ([]OutboxMessage, int64, error)
+	GetMessageByID(id string) (OutboxMessage, error)
+	// Redrive puts a dead message back in the queue with a fresh attempt budget.
+	Redrive(id string, now time.Time) (OutboxMessage, error)
+}
+
+type OutboxUsecase interface {
+	// DeliverDue sends every message that is due and returns how many were delivered.
+	DeliverDue(now time.Time) (int, ErrorResponse)
+	GetMessages(status, page, limit string) ([]OutboxMessage, int64, ErrorResponse)
+	GetMessageByID(id string) (OutboxMessage, ErrorResponse)
+	RedriveMessage(adminID, id string) (OutboxMessage, ErrorResponse)
+}
@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	PaymentEntry  = "payment"
+	ReversalEntry = "reversal"
+	// FeeEntry records a charge rather than money received: its allocation was added to the balance
+	FeeEntry = "fee"
+)
+
+// Payment is an entry in a loan's payment ledger. Entries are only ever deleted together with
+// their loan when it is purged; a mistaken payment is cancelled by a reversal entry with negated amounts.
+type Payment struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	LoanID     string             `json:"loan_id" bson:"loan_id"`
+	Type       string             `json:"type" bson:"type"`
+	Amount     float64            `json:"amount" bson:"amount"`
+	Allocation LoanBalance        `json:"allocation" bson:"allocation"`
+	Note       string             `json:"note,omitempty" bson:"note,omitempty"`
+	RecordedBy string             `json:"recorded_by" bson:"recorded_by"`
+	ReversalOf string             `json:"reversal_of,omitempty" bson:"reversal_of,omitempty"`
+	ReversedBy string             `json:"reversed_by,omitempty" bson:"reversed_by,omitempty"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+}
+
+type PaymentRequest struct {
+	Amount float64 `json:"amount"`
+	Note   string  `json:"note"`
+}
+
+type PaymentRepository interface {
+	CreatePayment(ctx context.Context, payment Payment) (Payment, error)
+	GetPaymentByID(id string) (Payment, error)
+	GetPaymentsByLoanID(loanID string) ([]Payment, error)
+	MarkPaymentReversed(ctx context.Context, paymentID, reversalID string) error
+	DeletePaymentsByLoanID(loanID string) error
+}
+
+type PaymentUsecase interface {
+	// RecordPayment books money staff received against the loan; borrowers can't record their own payments.
+	RecordPayment(actorID, loanID string, request PaymentRequest) (Payment, ErrorResponse)
+	GetLoanPayments(userID, Role, loanID string) ([]Payment, ErrorResponse)
+	ReversePayment(adminID, loanID, paymentID, reason string) (Payment, ErrorResponse)
+	// SendOverdueReminders emails borrowers whose schedule is behind and returns how many were reminded.
+	// Installments that fell overdue since the last reminder are charged the configured late fee.
+	SendOverdueReminders(now time.Time) (int, ErrorResponse)
+}
@@ -0,0 +1,23 @@
+package domain
+
+import "io"
+
+// Profile image variants, each scaled to fit a square of the given size.
+const (
+	ImageSizeSmall  = "small"
+	ImageSizeMedium = "medium"
+	ImageSizeLarge  = "large"
+)
+
+var ProfileImageSizes = map[string]int{
+	ImageSizeSmall:  64,
+	ImageSizeMedium: 256,
+	ImageSizeLarge:  1024,
+}
+
+type ProfileImageUsecase interface {
+	// UploadImage validates and stores the image in every size, replacing the previous one.
+	UploadImage(userID, contentType string, data []byte) (ReturnUser, ErrorResponse)
+	DeleteImage(userID string) ErrorResponse
+	GetImage(userID, size string) (io.ReadCloser, string, ErrorResponse)
+}
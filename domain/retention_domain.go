@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// PurgeResult counts the records a purge run removed for good.
+type PurgeResult struct {
+	Users int `json:"users"`
+	Loans int `json:"loans"`
+}
+
+type RetentionUsecase interface {
+	// PurgeDeleted hard-deletes records soft-deleted before now minus the retention period.
+	PurgeDeleted(now time.Time) (PurgeResult, ErrorResponse)
+}
@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// permissions checked by RequirePermission; a role grants a set of them
+const (
+	PermLoansRead           = "loans:read"
+	PermLoansApprove        = "loans:approve"
+	PermLoansDelete         = "loans:delete"
+	PermPaymentsRecord      = "payments:record"
+	PermPaymentsReverse     = "payments:reverse"
+	PermUsersRead           = "users:read"
+	PermUsersCreate         = "users:create"
+	PermUsersUpdate         = "users:update"
+	PermUsersDelete         = "users:delete"
+	PermUsersUnlock         = "users:unlock"
+	PermUsersImpersonate    = "users:impersonate"
+	PermRolesManage         = "roles:manage"
+	PermRolesAssign         = "roles:assign"
+	PermLogsRead            = "logs:read"
+	PermNotificationsManage = "notifications:manage"
+	PermAPIKeysManage       = "api_keys:manage"
+)
+
+// AllPermissions describes every permission a role can be given.
+var AllPermissions = map[string]string{
+	PermLoansRead:           "List and search all loans",
+	PermLoansApprove:        "Move loans through review, approval, disbursement and default",
+	PermLoansDelete:         "Delete and restore loans",
+	PermPaymentsRecord:      "Record payments received against disbursed loans",
+	PermPaymentsReverse:     "Reverse recorded payments",
+	PermUsersRead:           "List users and view their details, sessions and loans",
+	PermUsersCreate:         "Create user accounts",
+	PermUsersUpdate:         "Edit, suspend and reactivate users and force password resets",
+	PermUsersDelete:         "Delete and restore user accounts",
+	PermUsersUnlock:         "Lift login lockouts",
+	PermUsersImpersonate:    "View the API as a user through a read-only token",
+	PermRolesManage:         "Create, edit and delete roles",
+	PermRolesAssign:         "Change the role of a user",
+	PermLogsRead:            "Read the system log",
+	PermNotificationsManage: "Preview email templates and inspect or re-drive the email outbox",
+	PermAPIKeysManage:       "Create, list and revoke API keys",
+}
+
+// RoleDefinition is a named set of permissions. User.Role and the role claim in access tokens hold its name.
+type RoleDefinition struct {
+	Name        string   `json:"name" bson:"_id"`
+	Description string   `json:"description" bson:"description"`
+	Permissions []string `json:"permissions" bson:"permissions"`
+	// BuiltIn roles are seeded at startup and can't be deleted
+	BuiltIn   bool      `json:"built_in" bson:"built_in"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+type RoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type RoleRepository interface {
+	CreateRole(role RoleDefinition) (RoleDefinition, error)
+	UpdateRole(role RoleDefinition) (RoleDefinition, error)
+	DeleteRole(ctx context.Context, name string) error
+	// LockRole writes to the role so transactions that count or change its members conflict with
+	// each other and one of them is retried. It returns mongo.ErrNoDocuments when the role doesn't exist.
+	LockRole(ctx context.Context, name string) error
+	GetRole(name string) (RoleDefinition, error)
+	GetRoles() ([]RoleDefinition, error)
+	// SeedRole inserts the role unless one with the same name already exists.
+	SeedRole(role RoleDefinition) error
+}
+
+// PermissionResolver answers permission checks for a role name.
+type PermissionResolver interface {
+	HasPermission(role, permission string) (bool, error)
+}
+
+type RoleUsecase interface {
+	PermissionResolver
+	GetPermissions() map[string]string
+	GetRoles() ([]RoleDefinition, ErrorResponse)
+	CreateRole(actorID, actorRole string, request RoleRequest) (RoleDefinition, ErrorResponse)
+	UpdateRole(actorID, actorRole, name string, request RoleRequest) (RoleDefinition, ErrorResponse)
+	DeleteRole(actorID, name string) ErrorResponse
+	AssignRole(actorID, actorRole, userID, roleName string) (ReturnUser, ErrorResponse)
+	// CanManageRole reports whether actorRole holds every permission of targetRole. It returns
+	// mongo.ErrNoDocuments when targetRole doesn't exist.
+	CanManageRole(actorRole, targetRole string) (bool, error)
+}
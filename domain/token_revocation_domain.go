@@ -0,0 +1,12 @@
+package domain
+
+import "time"
+
+// TokenRevocationStore tracks access tokens that must be rejected before they expire.
+// Single tokens are revoked by their jti; revoking a user invalidates every token
+// issued to them before the given instant.
+type TokenRevocationStore interface {
+	RevokeToken(tokenID string, expiresAt time.Time) error
+	RevokeUserTokens(userID string, issuedBefore time.Time) error
+	IsRevoked(tokenID, userID string, issuedAt time.Time) (bool, error)
+}
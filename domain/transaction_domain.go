@@ -0,0 +1,10 @@
+package domain
+
+import "context"
+
+// Transactor runs fn in a database transaction. Repository methods that take a context join it
+// when given the ctx passed to fn. fn can run more than once when the database asks for a retry,
+// so it must not have side effects outside the database.
+type Transactor interface {
+	WithTransaction(fn func(ctx context.Context) error) error
+}
@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"context"
 	"encoding/json"
 	"time"
 
@@ -22,7 +23,7 @@ type User struct {
 	Role      string              `bson:"role" json:"role"`
 	CreatedAt primitive.Timestamp `bson:"createdAt" json:"createdAt"`
 	UpdatedAt primitive.Timestamp `bson:"updatedAt" json:"updatedAt"`
-	Image     string              `bson:"image,omitempty" json:"image,omitempty"`
+	Image     string              `bson:"image" json:"image,omitempty"`
 
 	ActivationToken string         `bson:"activation_token,omitempty" json:"activation_token,omitempty"`
 	TokenCreatedAt  time.Time      `bson:"token_created_at"`
@@ -31,6 +32,44 @@ type User struct {
 
 	GoogleID           string `bson:"google_id,omitempty" json:"google_id,omitempty"`
 	PasswordResetToken string `bson:"password_reset_token,omitempty" json:"password_reset_token,omitempty"`
+	// PasswordResetExpiresAt ends the reset token's validity; TokenCreatedAt belongs to the activation token
+	PasswordResetExpiresAt time.Time `bson:"password_reset_expires_at,omitempty" json:"-"`
+
+	// activation link reissues in the current 24 hour window, see UserUsecase.ResendActivationEmail
+	ActivationResendCount       int       `bson:"activation_resend_count" json:"-"`
+	ActivationResendWindowStart time.Time `bson:"activation_resend_window_start" json:"-"`
+
+	// ImageKey is the blob store prefix of the uploaded profile image and ImageFormat its file
+	// extension; Image then holds the authenticated URL it is served from
+	ImageKey    string `bson:"image_key" json:"-"`
+	ImageFormat string `bson:"image_format" json:"-"`
+
+	// a requested email change waits here until the link sent to the new address is opened;
+	// no omitempty so UpdateUser clears them once the change is confirmed
+	PendingEmail         string    `bson:"pending_email" json:"-"`
+	EmailChangeToken     string    `bson:"email_change_token" json:"-"`
+	EmailChangeExpiresAt time.Time `bson:"email_change_expires_at" json:"-"`
+
+	// PreferredLanguage is a base language tag such as "en" or "fr" used to localize emails
+	PreferredLanguage string `bson:"preferred_language,omitempty" json:"preferred_language,omitempty"`
+
+	// two-factor fields are written without omitempty so UpdateUser can clear them
+	TwoFactorEnabled       bool     `bson:"two_factor_enabled" json:"-"`
+	TwoFactorSecret        string   `bson:"two_factor_secret" json:"-"`
+	PendingTwoFactorSecret string   `bson:"pending_two_factor_secret" json:"-"`
+	RecoveryCodes          []string `bson:"recovery_codes" json:"-"`
+	LastTOTPStep           int64    `bson:"last_totp_step" json:"-"`
+
+	// set by admins; a suspended account can't log in or refresh its tokens
+	Suspended        bool      `bson:"suspended" json:"-"`
+	SuspendedAt      time.Time `bson:"suspended_at" json:"-"`
+	SuspensionReason string    `bson:"suspension_reason" json:"-"`
+	// PasswordResetRequired blocks login until the user sets a new password through a reset link
+	PasswordResetRequired bool `bson:"password_reset_required" json:"-"`
+
+	// soft deletion; the record is kept for the retention period and then purged
+	DeletedAt time.Time `bson:"deleted_at,omitempty" json:"-"`
+	DeletedBy string    `bson:"deleted_by,omitempty" json:"-"`
 }
 
 type ReturnUser struct {
@@ -40,6 +79,9 @@ type ReturnUser struct {
 	Role      string              `bson:"role" json:"role"`
 	CreatedAt primitive.Timestamp `bson:"createdAt" json:"createdAt"`
 	Image     string              `bson:"image,omitempty" json:"image,omitempty"`
+
+	DeletedAt *time.Time `bson:"-" json:"deleted_at,omitempty"`
+	DeletedBy string     `bson:"-" json:"deleted_by,omitempty"`
 }
 
 func (u *User) MarshalJSON() ([]byte, error) {
@@ -66,10 +108,24 @@ const (
 )
 
 
+// RefreshToken is one signed-in device. Token is the hash of the refresh token currently
+// issued to it; every refresh replaces it, and the replaced hashes stay in RotatedTokens so a
+// replayed old token can be recognised. All tokens rotated from one login share a FamilyID.
 type RefreshToken struct {
-	Token     string    `bson:"token" json:"token"`
-	DeviceID  string    `bson:"device_id" json:"device_id"`
-	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	Token         string    `bson:"token" json:"token"`
+	FamilyID      string    `bson:"family_id" json:"-"`
+	RotatedTokens []string  `bson:"rotated_tokens" json:"-"`
+	DeviceID      string    `bson:"device_id" json:"device_id"`
+	CreatedAt     time.Time `bson:"created_at" json:"created_at"`
+	LastUsedAt    time.Time `bson:"last_used_at" json:"last_used_at"`
+}
+
+// Session is the public view of a refresh token; the token itself is never exposed.
+type Session struct {
+	DeviceID   string    `json:"device_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
 }
 
 type LogInResponse struct {
@@ -77,10 +133,31 @@ type LogInResponse struct {
 	AccessToken  string `json:"accessToken"`
 	RefreshToken string `json:"refreshToken"`
 	User		 ReturnUser `json:"user"`
+
+	// set instead of the tokens above when the account has two-factor authentication enabled
+	TwoFactorRequired bool   `json:"twoFactorRequired,omitempty"`
+	ChallengeToken    string `json:"challengeToken,omitempty"`
+}
+
+type TwoFactorEnrollment struct {
+	Secret     string `json:"secret"`
+	OtpAuthURI string `json:"otpauth_uri"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
 }
 
 type RefreshTokenResponse struct {
 	AccessToken string `json:"accessToken"`
+	// RefreshToken replaces the one sent with the request, which no longer works
+	RefreshToken string `json:"refreshToken"`
 }
 
 
@@ -88,15 +165,80 @@ type ResetPasswordRequest struct {
 	Email string `json:"email"`
 }
 
+type ResendActivationRequest struct {
+	Email string `json:"email"`
+}
+
+// UpdateProfileRequest is a partial update of the caller's profile; nil fields are left unchanged.
+// Image is still accepted so older clients get a clear error instead of a silently ignored field;
+// the image is changed through the upload endpoint.
+type UpdateProfileRequest struct {
+	Username *string `json:"username"`
+	Image    *string `json:"image"`
+}
+
+type ChangeEmailRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// AdminCreateUserRequest creates an active account. Without a password the user is emailed a
+// link to choose one.
+type AdminCreateUserRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+	Password string `json:"password"`
+}
+
+// AdminUpdateUserRequest is a partial update; nil fields are left unchanged.
+type AdminUpdateUserRequest struct {
+	Username          *string `json:"username"`
+	Email             *string `json:"email"`
+	PreferredLanguage *string `json:"preferred_language"`
+}
+
+type SuspendUserRequest struct {
+	Reason string `json:"reason"`
+}
+
+// AdminUserDetail is everything an admin sees about one account.
+type AdminUserDetail struct {
+	User                  ReturnUser `json:"user"`
+	IsActive              bool       `json:"is_active"`
+	Suspended             bool       `json:"suspended"`
+	SuspendedAt           *time.Time `json:"suspended_at,omitempty"`
+	SuspensionReason      string     `json:"suspension_reason,omitempty"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	TwoFactorEnabled      bool       `json:"two_factor_enabled"`
+	PreferredLanguage     string     `json:"preferred_language,omitempty"`
+	Sessions              []Session  `json:"sessions"`
+	Loans                 []Loan     `json:"loans"`
+	LoanCount             int64      `json:"loan_count"`
+}
+
 type TokenGenerator interface {
 	GenerateToken(user User) (string, error)
 	GenerateRefreshToken(user User) (string, error)
 	RefreshToken(token string) (string, error)
+	// challenge tokens prove the password step of a two-factor login and cannot be used as access tokens
+	GenerateChallengeToken(user User) (string, error)
+	VerifyChallengeToken(token string) (string, error)
+	// GenerateImpersonationToken issues a short-lived, read-only access token for user on behalf of adminID
+	GenerateImpersonationToken(user User, adminID string, expiry time.Duration) (string, error)
 }
 
 type TokenVerifier interface {
-	VerifyToken(token string) (*User, error)
-	VerifyRefreshToken(token string) (*User, error)
+	// VerifyAccessToken checks the signature against the key named by the token's kid, the expiry
+	// and that the token is an access token.
+	VerifyAccessToken(token string) (*JwtCustomClaims, error)
+	// JWKS publishes the verification keys so other services can check our tokens.
+	JWKS() JWKSet
 }
 
 type PasswordService interface {
@@ -108,8 +250,22 @@ type UserUsecase interface {
 	// for every user
 	Register(user User) ErrorResponse
 	AccountActivation(token string, email string) ErrorResponse
-	Login(user *User, deviceID string) (LogInResponse, ErrorResponse)
+	ResendActivationEmail(email string) ErrorResponse
+	Login(user *User, deviceID, clientIP string) (LogInResponse, ErrorResponse)
 	RefreshToken(userID, deviceID, token string) (RefreshTokenResponse, ErrorResponse)
+	Logout(userID, deviceID, token, accessTokenID string, accessTokenExpiresAt time.Time) ErrorResponse
+	LogoutAll(userID string) ErrorResponse
+	GetSessions(userID, currentDeviceID string) ([]Session, ErrorResponse)
+	RevokeSession(userID, deviceID string) ErrorResponse
+
+	EnrollTwoFactor(userID string) (TwoFactorEnrollment, ErrorResponse)
+	ConfirmTwoFactor(userID, code string) ([]string, ErrorResponse)
+	DisableTwoFactor(userID, code string) ErrorResponse
+	VerifyTwoFactorLogin(request TwoFactorLoginRequest, deviceID, clientIP string) (LogInResponse, ErrorResponse)
+
+	// sign-in through an OpenID Connect provider
+	StartOAuthLogin() (OAuthStart, ErrorResponse)
+	OAuthLogin(callback OAuthCallback, deviceID, clientIP string) (LogInResponse, ErrorResponse)
 	
 	// // reset password
 	ResetPassword(token, newPassword string) ErrorResponse
@@ -117,34 +273,110 @@ type UserUsecase interface {
 
 
 	GetMyProfile(userID string) (ReturnUser, ErrorResponse)
+	UpdateProfile(userID string, request UpdateProfileRequest) (ReturnUser, ErrorResponse)
+	// RequestEmailChange mails a confirmation link to the new address; the email only changes
+	// once ConfirmEmailChange redeems it.
+	RequestEmailChange(userID string, request ChangeEmailRequest) ErrorResponse
+	ConfirmEmailChange(token string) ErrorResponse
+	ChangePassword(userID string, request ChangePasswordRequest) ErrorResponse
 	GetUsers(byName, limit , page string) ([]ReturnUser, ErrorResponse)
-	DeleteUser(userID string) (ReturnUser, ErrorResponse)
+	UnlockUser(adminID, userID string) ErrorResponse
 	
 }
 
+// UserChange is a targeted update of one user, keyed by bson field names. Only the fields in Set
+// are written, so a request working from an older copy of the user can't undo what another request
+// changed meanwhile, such as a suspension or a new role. Where lists fields that must still hold the
+// given values for the change to apply; a nil value matches a missing field.
+type UserChange struct {
+	Set   map[string]interface{}
+	Where map[string]interface{}
+}
+
 type UserRepository interface {
 	// for every user
 
-	Register(user User) error
+	// Register, UpdateUser and DeleteAllRefreshTokens take a context so they can join a transaction.
+	Register(ctx context.Context, user User) error
 	GetUserByUsernameOrEmail(username, email string) (User, error)
-	AccountActivation(email string) error
+	// AccountActivation activates the account only while tokenHash is still its activation token,
+	// consuming it; mongo.ErrNoDocuments means the token was already used or replaced.
+	AccountActivation(email, tokenHash string) error
 	GetUserByEmail(email string) (User, error)
+	GetUserByUsername(username string) (User, error)
+	GetUserByGoogleID(googleID string) (User, error)
 	Login(user *User) (*User, error)
-	UpdateUser(user *User) error
-	DeleteRefreshToken(user *User, refreshToken string) error
-	DeleteAllRefreshTokens(user *User) error
+	// UpdateUser applies change to the live user with that ID; mongo.ErrNoDocuments means there is
+	// none or a guard in change.Where no longer holds.
+	UpdateUser(ctx context.Context, userID primitive.ObjectID, change UserChange) error
+	// AddRefreshToken starts a session, replacing any other session of the same device.
+	AddRefreshToken(userID primitive.ObjectID, token RefreshToken) error
+	// DeleteRefreshToken removes the session whose current refresh token hashes to tokenHash;
+	// mongo.ErrNoDocuments means there is none.
+	DeleteRefreshToken(user *User, tokenHash string) error
+	// RotateRefreshToken swaps the session holding oldTokenHash for next, but only while that
+	// hash is still current, so one token can't be redeemed twice; otherwise mongo.ErrNoDocuments.
+	RotateRefreshToken(userID primitive.ObjectID, oldTokenHash string, next RefreshToken) error
+	// RevokeRefreshTokenFamily ends the session of every token rotated from the same login.
+	RevokeRefreshTokenFamily(userID primitive.ObjectID, familyID string) error
+	DeleteAllRefreshTokens(ctx context.Context, user *User) error
+	DeleteRefreshTokenByDevice(user *User, deviceID string) error
 
 	GetUserByID(id string) (User, error)
+	CountUsersByRole(ctx context.Context, role string) (int64, error)
 	
-	GetUserByResetToken(token string) (User, error)
+	// ReissueActivationToken replaces the activation token of the inactive account with that email,
+	// but only when cooldown has passed since the last token and fewer than dailyLimit were issued in
+	// the current 24 hour window. The limits are checked and counted in one update, so concurrent
+	// requests can't both pass them; mongo.ErrNoDocuments means no account matched or a limit was hit.
+	ReissueActivationToken(ctx context.Context, email, tokenHash string, now time.Time, cooldown time.Duration, dailyLimit int) (User, error)
+	// ConsumePasswordResetToken removes the reset token and returns the user as it was before,
+	// so a token can be redeemed only once even under concurrent requests.
+	ConsumePasswordResetToken(tokenHash string) (User, error)
+	// ConsumeEmailChangeToken works the same way for the link confirming a new email address.
+	ConsumeEmailChangeToken(tokenHash string) (User, error)
+	// ConsumeTOTPStep records step as the last TOTP step used, but only while it is newer than the
+	// stored one; ConsumeRecoveryCode removes the recovery code with that hash. Both fail with
+	// mongo.ErrNoDocuments when the code was already used, so concurrent requests can't share one.
+	ConsumeTOTPStep(userID primitive.ObjectID, step int64) error
+	ConsumeRecoveryCode(userID primitive.ObjectID, codeHash string) error
 
 	// // ActivateAccountMe(Email string) error
 
 	// // // for user profile
 	GetMyProfile(userID string) (User, error)
 	GetUsers(byName, limit , page string) ([]User, error)
+
+	// every query above skips soft-deleted users; these are the only ways to reach them
+	SoftDeleteUser(ctx context.Context, userID, deletedBy string, at time.Time) (User, error)
+	RestoreUser(userID string) (User, error)
+	GetDeletedUsers(limit, page string) ([]User, error)
+	GetDeletedUserByID(userID string) (User, error)
+	GetUsersDeletedBefore(cutoff time.Time, skip, limit int) ([]User, error)
+	// DeleteUser removes the record for good; it backs the purge job and failed sign-ups
 	DeleteUser(userID string) (User, error)
 
 	
 
 }
+
+type AdminUserUsecase interface {
+	CreateUser(actorID, actorRole string, request AdminCreateUserRequest) (ReturnUser, ErrorResponse)
+	GetUserDetail(userID string) (AdminUserDetail, ErrorResponse)
+	UpdateUser(actorID, actorRole, userID string, request AdminUpdateUserRequest) (ReturnUser, ErrorResponse)
+	SuspendUser(actorID, actorRole, userID, reason string) ErrorResponse
+	ReactivateUser(actorID, actorRole, userID string) ErrorResponse
+	ForcePasswordReset(actorID, actorRole, userID string) ErrorResponse
+	// DeleteUser soft-deletes the account; it is purged once the retention period has passed.
+	DeleteUser(actorID, actorRole, userID string) (ReturnUser, ErrorResponse)
+	RestoreUser(actorID, userID string) (ReturnUser, ErrorResponse)
+	GetDeletedUsers(limit, page string) ([]ReturnUser, ErrorResponse)
+	// ImpersonateUser lets support see the API as the user does, through a read-only token.
+	ImpersonateUser(actorID, actorRole, userID string) (ImpersonationResponse, ErrorResponse)
+}
+
+type ImpersonationResponse struct {
+	AccessToken string     `json:"accessToken"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	User        ReturnUser `json:"user"`
+}
@@ -1,24 +1,29 @@
 package infrastracture
 
 import (
+	"errors"
 	"fmt"
 	"loan-tracker-api/config"
+	"loan-tracker-api/domain"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 )
 
-// var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
-
-
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware accepts requests carrying a valid, unrevoked access token and puts its claims in the context.
+// When apiKeys is set an X-API-Key header is accepted instead; it yields the same context values
+// for the key's owner plus the key's scopes, which RequirePermission also enforces.
+// Impersonation tokens only get through for reads, and every request made with one is written to auditLog.
+func AuthMiddleware(verifier domain.TokenVerifier, revocationStore domain.TokenRevocationStore, apiKeys domain.APIKeyAuthenticator, auditLog domain.LogRepository) gin.HandlerFunc {
 	
 	return func(c *gin.Context) {
-		var JwtSecret = []byte(config.EnvConfigs.JwtSecret)
-
-
+		if rawKey := c.GetHeader("X-API-Key"); rawKey != "" && apiKeys != nil {
+			authenticateAPIKey(c, apiKeys, rawKey)
+			return
+		}
 
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -34,13 +39,7 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		token, err := jwt.Parse(authParts[1], func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-			}
-			return JwtSecret, nil
-		})
-
+		claims, err := verifier.VerifyAccessToken(authParts[1])
 		if err != nil {
 			fmt.Printf("Error parsing token: %v\n", err)
 			c.JSON(401, gin.H{"error": "Invalid JWT"})
@@ -48,35 +47,97 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		if !token.Valid {
-			fmt.Println("Token is not valid")
-			c.JSON(401, gin.H{"error": "Invalid JWT"})
+		issuedAt := time.Unix(claims.IssuedAt, 0)
+		expiresAt := time.Unix(claims.ExpiresAt, 0)
+
+		revoked, err := revocationStore.IsRevoked(claims.Id, claims.UserID, issuedAt)
+		if err == nil && !revoked && claims.ImpersonatedBy != "" {
+			// signing the admin out everywhere must also end the sessions they opened as someone else
+			revoked, err = revocationStore.IsRevoked(claims.Id, claims.ImpersonatedBy, issuedAt)
+		}
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Unable to verify token"})
 			c.Abort()
 			return
 		}
-
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(401, gin.H{"error": "Invalid JWT"})
+		if revoked {
+			c.JSON(401, gin.H{"error": "Token has been revoked"})
 			c.Abort()
 			return
 		}
 
-		// c.Set("user", claims)
-		c.Set("user_id", claims["user_id"])
-		c.Set("username", claims["username"])
-		c.Set ("role", claims["role"])
-		c.Set("is_activated", claims["is_activated"])
-		fmt.Println(claims,"claims8888888888888888888888888888888888")
+		c.Set("token_id", claims.Id)
+		c.Set("token_expires_at", expiresAt)
+		c.Set("user_id", claims.UserID)
+		c.Set("username", claims.Username)
+		c.Set("role", claims.Role)
+		c.Set("is_activated", claims.IsActivated)
+		c.Set("two_factor", claims.TwoFactor)
+
+		if claims.ImpersonatedBy != "" {
+			impersonatedRequest(c, auditLog, claims)
+			return
+		}
 
-		// c.Set("Roles", claims["role"])
 		c.Next()
 	}
 }
 
+// impersonatedRequest lets an admin's impersonation token read but not change anything, and logs
+// each request, blocked or not, with the admin behind it.
+func impersonatedRequest(c *gin.Context, auditLog domain.LogRepository, claims *domain.JwtCustomClaims) {
+	c.Set("impersonator_id", claims.ImpersonatedBy)
+
+	details := "Admin " + claims.ImpersonatedBy + " as user " + claims.UserID + ": " + c.Request.Method + " " + c.Request.URL.Path
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Impersonation tokens are read-only"})
+		c.Abort()
+		details += " (blocked)"
+	} else {
+		c.Next()
+		details += fmt.Sprintf(" (%d)", c.Writer.Status())
+	}
+
+	auditLog.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Impersonated Request",
+		Details:   details,
+	})
+}
 
 
-func RoleMiddleware(Role_ string) gin.HandlerFunc {
+
+func authenticateAPIKey(c *gin.Context, apiKeys domain.APIKeyAuthenticator, rawKey string) {
+	principal, err := apiKeys.AuthenticateAPIKey(rawKey)
+	if errors.Is(err, domain.ErrInvalidAPIKey) {
+		c.JSON(401, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Unable to verify API key"})
+		c.Abort()
+		return
+	}
+
+	// the owner proved their second factor when minting the key
+	c.Set("token_id", "api_key:"+principal.Key.ID.Hex())
+	c.Set("token_expires_at", principal.Key.ExpiresAt)
+	c.Set("user_id", principal.Owner.ID.Hex())
+	c.Set("username", principal.Owner.Username)
+	c.Set("role", principal.Owner.Role)
+	c.Set("is_activated", principal.Owner.IsActive)
+	c.Set("two_factor", true)
+	c.Set("api_key_id", principal.Key.ID.Hex())
+	c.Set("api_key_scopes", principal.Key.Scopes)
+
+	c.Next()
+}
+
+// RequirePermission lets the request through only when the caller's role grants every listed
+// permission; requests made with an API key also need it among the key's scopes. It must run
+// after AuthMiddleware.
+func RequirePermission(resolver domain.PermissionResolver, permissions ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		
 		role:= c.GetString("role")
@@ -86,12 +147,34 @@ func RoleMiddleware(Role_ string) gin.HandlerFunc {
 			return
 		}
 
-		if role != Role_ {
-			c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		// support sees what the user sees, never more
+		if c.GetString("impersonator_id") != "" {
+			c.IndentedJSON(http.StatusForbidden, gin.H{"error": "Impersonation tokens can't use admin endpoints"})
 			c.Abort()
 			return
 		}
 
+		scopes, isAPIKey := c.Get("api_key_scopes")
+		for _, permission := range permissions {
+			if isAPIKey && !slices.Contains(scopes.([]string), permission) {
+				c.IndentedJSON(http.StatusForbidden, gin.H{"error": "API key lacks scope " + permission})
+				c.Abort()
+				return
+			}
+
+			ok, err := resolver.HasPermission(role, permission)
+			if err != nil {
+				c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+				c.Abort()
+				return
+			}
+			if !ok {
+				c.IndentedJSON(http.StatusForbidden, gin.H{"error": "Missing permission " + permission})
+				c.Abort()
+				return
+			}
+		}
+
 		c.Next()
 	}
 }
@@ -123,3 +206,22 @@ func EligibilityMiddleware() gin.HandlerFunc {
         c.Next()
     }
 }
+
+// TwoFactorPolicyMiddleware enforces the REQUIRE_ADMIN_2FA policy. It must run after AuthMiddleware.
+func TwoFactorPolicyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// anyone past the plain user role can reach some admin route, so they all need a second factor
+		if !config.EnvConfigs.RequireAdmin2FA || c.GetString("role") == string(domain.UserRole) {
+			c.Next()
+			return
+		}
+
+		if !c.GetBool("two_factor") {
+			c.IndentedJSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for admin accounts. Enroll at /users/2fa/enroll and log in again."})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
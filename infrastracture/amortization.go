@@ -0,0 +1,97 @@
+package infrastracture
+
+import (
+	"errors"
+	"loan-tracker-api/domain"
+	"math"
+	"time"
+)
+
+// PeriodsPerYear returns how many installments a year holds for the given repayment frequency.
+func PeriodsPerYear(frequency string) (int, error) {
+	switch frequency {
+	case domain.WeeklyRepayment:
+		return 52, nil
+	case domain.BiweeklyRepayment:
+		return 26, nil
+	case domain.MonthlyRepayment:
+		return 12, nil
+	}
+	return 0, errors.New("unsupported repayment frequency: " + frequency)
+}
+
+// GenerateRepaymentSchedule builds an amortized (equal payment) schedule for the
+// principal at the given annual interest rate (in percent), starting one period after start.
+func GenerateRepaymentSchedule(principal, annualRate float64, termMonths int, frequency string, start time.Time) ([]domain.Installment, error) {
+	if principal <= 0 {
+		return nil, errors.New("principal must be positive")
+	}
+	if termMonths <= 0 {
+		return nil, errors.New("term must be positive")
+	}
+	if annualRate < 0 {
+		return nil, errors.New("interest rate cannot be negative")
+	}
+
+	periodsPerYear, err := PeriodsPerYear(frequency)
+	if err != nil {
+		return nil, err
+	}
+
+	periods := int(math.Round(float64(termMonths) * float64(periodsPerYear) / 12))
+	if periods < 1 {
+		periods = 1
+	}
+
+	rate := annualRate / 100 / float64(periodsPerYear)
+	payment := principal / float64(periods)
+	if rate > 0 {
+		payment = principal * rate / (1 - math.Pow(1+rate, -float64(periods)))
+	}
+	payment = RoundCents(payment)
+
+	schedule := make([]domain.Installment, 0, periods)
+	balance := principal
+	for i := 1; i <= periods; i++ {
+		interest := RoundCents(balance * rate)
+		principalPart := payment - interest
+		// the last installment settles whatever rounding has left over
+		if i == periods || principalPart > balance {
+			principalPart = balance
+		}
+		balance = RoundCents(balance - principalPart)
+
+		schedule = append(schedule, domain.Installment{
+			Number:           i,
+			DueDate:          dueDate(start, frequency, i),
+			Payment:          RoundCents(principalPart + interest),
+			Principal:        RoundCents(principalPart),
+			Interest:         interest,
+			RemainingBalance: balance,
+		})
+	}
+
+	return schedule, nil
+}
+
+func dueDate(start time.Time, frequency string, period int) time.Time {
+	switch frequency {
+	case domain.WeeklyRepayment:
+		return start.AddDate(0, 0, 7*period)
+	case domain.BiweeklyRepayment:
+		return start.AddDate(0, 0, 14*period)
+	}
+	// clamp to the end of the month so a loan approved on the 31st doesn't drift into the next month
+	due := time.Date(start.Year(), start.Month()+time.Month(period), 1, start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+	lastDay := due.AddDate(0, 1, -1).Day()
+	day := start.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return due.AddDate(0, 0, day-1)
+}
+
+// RoundCents rounds a money amount to two decimal places.
+func RoundCents(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,110 @@
+package infrastracture
+
+import (
+	"loan-tracker-api/domain"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestGenerateRepaymentSchedule(t *testing.T) {
+	start := time.Date(2026, time.January, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		principal    float64
+		annualRate   float64
+		termMonths   int
+		frequency    string
+		wantPeriods  int
+		wantPayment  float64
+		wantInterest float64
+	}{
+		{"monthly with interest", 10000, 12, 12, domain.MonthlyRepayment, 12, 888.49, 661.86},
+		{"zero interest", 1200, 0, 12, domain.MonthlyRepayment, 12, 100, 0},
+		{"weekly", 5200, 10, 12, domain.WeeklyRepayment, 52, 105.18, 269.32},
+		{"biweekly", 2600, 5, 6, domain.BiweeklyRepayment, 13, 202.7, 35.14},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := GenerateRepaymentSchedule(tt.principal, tt.annualRate, tt.termMonths, tt.frequency, start)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(schedule) != tt.wantPeriods {
+				t.Fatalf("got %d installments, want %d", len(schedule), tt.wantPeriods)
+			}
+			if schedule[0].Payment != tt.wantPayment {
+				t.Errorf("first payment = %v, want %v", schedule[0].Payment, tt.wantPayment)
+			}
+
+			var principal, interest float64
+			for i, installment := range schedule {
+				if installment.Number != i+1 {
+					t.Errorf("installment %d has number %d", i, installment.Number)
+				}
+				if got := RoundCents(installment.Principal + installment.Interest); got != installment.Payment {
+					t.Errorf("installment %d: principal + interest = %v, payment = %v", installment.Number, got, installment.Payment)
+				}
+				principal += installment.Principal
+				interest += installment.Interest
+			}
+
+			if got := RoundCents(principal); got != tt.principal {
+				t.Errorf("principal repaid = %v, want %v", got, tt.principal)
+			}
+			if got := RoundCents(interest); math.Abs(got-tt.wantInterest) > 0.001 {
+				t.Errorf("total interest = %v, want %v", got, tt.wantInterest)
+			}
+			if last := schedule[len(schedule)-1]; last.RemainingBalance != 0 {
+				t.Errorf("remaining balance after the last installment = %v", last.RemainingBalance)
+			}
+		})
+	}
+}
+
+func TestGenerateRepaymentScheduleRejectsInvalidTerms(t *testing.T) {
+	tests := []struct {
+		name       string
+		principal  float64
+		annualRate float64
+		termMonths int
+		frequency  string
+	}{
+		{"zero principal", 0, 5, 12, domain.MonthlyRepayment},
+		{"zero term", 1000, 5, 0, domain.MonthlyRepayment},
+		{"negative rate", 1000, -1, 12, domain.MonthlyRepayment},
+		{"unknown frequency", 1000, 5, 12, "daily"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := GenerateRepaymentSchedule(tt.principal, tt.annualRate, tt.termMonths, tt.frequency, time.Now()); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestDueDateClampsToEndOfMonth(t *testing.T) {
+	start := time.Date(2026, time.January, 31, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		frequency string
+		period    int
+		want      time.Time
+	}{
+		{domain.MonthlyRepayment, 1, time.Date(2026, time.February, 28, 9, 0, 0, 0, time.UTC)},
+		{domain.MonthlyRepayment, 2, time.Date(2026, time.March, 31, 9, 0, 0, 0, time.UTC)},
+		{domain.MonthlyRepayment, 3, time.Date(2026, time.April, 30, 9, 0, 0, 0, time.UTC)},
+		{domain.WeeklyRepayment, 1, time.Date(2026, time.February, 7, 9, 0, 0, 0, time.UTC)},
+		{domain.BiweeklyRepayment, 2, time.Date(2026, time.February, 28, 9, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		if got := dueDate(start, tt.frequency, tt.period); !got.Equal(tt.want) {
+			t.Errorf("dueDate(%s, %d) = %v, want %v", tt.frequency, tt.period, got, tt.want)
+		}
+	}
+}
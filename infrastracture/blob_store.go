@@ -0,0 +1,273 @@
+package infrastracture
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"loan-tracker-api/config"
+	"loan-tracker-api/domain"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NewBlobStore picks the storage backend from BLOB_STORE_BACKEND ("local" or "s3").
+// The local backend writes below BLOB_STORE_DIR, "uploads" by default.
+func NewBlobStore() domain.BlobStore {
+	if config.EnvConfigs.BlobStoreBackend == "s3" {
+		return NewS3BlobStore(config.EnvConfigs.S3Endpoint, config.EnvConfigs.S3Region, config.EnvConfigs.S3Bucket, config.EnvConfigs.S3AccessKey, config.EnvConfigs.S3SecretKey)
+	}
+
+	dir := config.EnvConfigs.BlobStoreDir
+	if dir == "" {
+		dir = "uploads"
+	}
+	return NewLocalBlobStore(dir)
+}
+
+// validBlobKey rejects keys that could escape the store, such as "../x" or "/etc/passwd".
+func validBlobKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "..") {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
+
+// LocalBlobStore keeps blobs as files. The content type is derived from the key's extension,
+// so keys should end in one.
+type LocalBlobStore struct {
+	dir string
+}
+
+func NewLocalBlobStore(dir string) *LocalBlobStore {
+	return &LocalBlobStore{dir: dir}
+}
+
+func (l *LocalBlobStore) Put(key, contentType string, data []byte) error {
+	if err := validBlobKey(key); err != nil {
+		return err
+	}
+
+	file := filepath.Join(l.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+
+	// write to a temporary file first so readers never see a half written blob
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func (l *LocalBlobStore) Get(key string) (io.ReadCloser, string, error) {
+	if err := validBlobKey(key); err != nil {
+		return nil, "", err
+	}
+
+	file, err := os.Open(filepath.Join(l.dir, filepath.FromSlash(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", domain.ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return file, contentType, nil
+}
+
+func (l *LocalBlobStore) Delete(key string) error {
+	if err := validBlobKey(key); err != nil {
+		return err
+	}
+
+	err := os.Remove(filepath.Join(l.dir, filepath.FromSlash(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// S3BlobStore talks to an S3 compatible API with path style addressing, which AWS and MinIO
+// both accept. Requests are signed with AWS Signature Version 4.
+type S3BlobStore struct {
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+func NewS3BlobStore(endpoint, region, bucket, accessKey, secretKey string) *S3BlobStore {
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &S3BlobStore{
+		endpoint:  strings.TrimRight(endpoint, "/"),
+		region:    region,
+		bucket:    bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *S3BlobStore) Put(key, contentType string, data []byte) error {
+	if err := validBlobKey(key); err != nil {
+		return err
+	}
+
+	resp, err := s.do(http.MethodPut, key, contentType, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func (s *S3BlobStore) Get(key string) (io.ReadCloser, string, error) {
+	if err := validBlobKey(key); err != nil {
+		return nil, "", err
+	}
+
+	resp, err := s.do(http.MethodGet, key, "", nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, resp.Header.Get("Content-Type"), nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, "", domain.ErrBlobNotFound
+	}
+	defer resp.Body.Close()
+	return nil, "", s3Error(resp)
+}
+
+func (s *S3BlobStore) Delete(key string) error {
+	if err := validBlobKey(key); err != nil {
+		return err
+	}
+
+	resp, err := s.do(http.MethodDelete, key, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// S3 answers 204 whether or not the object existed
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func s3Error(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 request failed with %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+func (s *S3BlobStore) do(method, key, contentType string, body []byte) (*http.Response, error) {
+	if s.endpoint == "" || s.bucket == "" {
+		return nil, errors.New("s3 endpoint and bucket must be configured")
+	}
+
+	target, err := url.Parse(s.endpoint + "/" + s.bucket + "/" + key)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, body, time.Now().UTC())
+
+	return s.client.Do(req)
+}
+
+// sign adds the Signature Version 4 headers. Only the host, content type and x-amz-* headers
+// are signed, which is all S3 requires.
+func (s *S3BlobStore) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	signingKey = hmacSHA256(signingKey, s.region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.accessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
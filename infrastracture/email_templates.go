@@ -0,0 +1,247 @@
+package infrastracture
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"loan-tracker-api/config"
+	"loan-tracker-api/domain"
+	"path"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates/email
+var emailTemplateFS embed.FS
+
+const emailTemplateRoot = "templates/email"
+
+// emailTemplate is one locale's variant of a template. The .txt file defines "subject" and
+// "text"; the .html file defines "content", which is wrapped in the shared layout.
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+type EmailTemplateRenderer struct {
+	baseURL       string
+	defaultLocale string
+	// templates is keyed by locale, then template name
+	templates map[string]map[string]emailTemplate
+}
+
+// NewEmailRenderer parses the embedded templates. They ship inside the binary, so a parse
+// error is a build defect and panics at startup rather than on the first email.
+func NewEmailRenderer() domain.EmailRenderer {
+	baseURL := strings.TrimRight(config.EnvConfigs.PublicBaseURL, "/")
+	if baseURL == "" {
+		baseURL = "http://localhost" + config.EnvConfigs.LocalServerPort
+	}
+	defaultLocale := NormalizeLocale(config.EnvConfigs.DefaultLocale)
+	if defaultLocale == "" {
+		defaultLocale = "en"
+	}
+
+	renderer, err := newEmailTemplateRenderer(emailTemplateFS, baseURL, defaultLocale)
+	if err != nil {
+		panic(err)
+	}
+	return renderer
+}
+
+func newEmailTemplateRenderer(files fs.FS, baseURL, defaultLocale string) (*EmailTemplateRenderer, error) {
+	layout, err := htmltemplate.ParseFS(files, path.Join(emailTemplateRoot, "layout.html"))
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := fs.ReadDir(files, emailTemplateRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := map[string]map[string]emailTemplate{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		locale := entry.Name()
+		textFiles, err := fs.Glob(files, path.Join(emailTemplateRoot, locale, "*.txt"))
+		if err != nil {
+			return nil, err
+		}
+
+		templates[locale] = map[string]emailTemplate{}
+		for _, textFile := range textFiles {
+			name := strings.TrimSuffix(path.Base(textFile), ".txt")
+
+			text, err := texttemplate.ParseFS(files, textFile)
+			if err != nil {
+				return nil, err
+			}
+			html, err := htmltemplate.Must(layout.Clone()).ParseFS(files, path.Join(emailTemplateRoot, locale, name+".html"))
+			if err != nil {
+				return nil, err
+			}
+			templates[locale][name] = emailTemplate{text: text, html: html}
+		}
+	}
+
+	if _, ok := templates[defaultLocale]; !ok {
+		return nil, fmt.Errorf("no email templates for default locale %q", defaultLocale)
+	}
+
+	return &EmailTemplateRenderer{
+		baseURL:       baseURL,
+		defaultLocale: defaultLocale,
+		templates:     templates,
+	}, nil
+}
+
+// NormalizeLocale reduces a language tag or an Accept-Language header to its primary
+// base language, e.g. "fr-CA,fr;q=0.9,en;q=0.8" becomes "fr".
+func NormalizeLocale(locale string) string {
+	locale = strings.TrimSpace(locale)
+	if i := strings.IndexAny(locale, ",;"); i >= 0 {
+		locale = locale[:i]
+	}
+	if i := strings.IndexAny(locale, "-_"); i >= 0 {
+		locale = locale[:i]
+	}
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if locale == "*" {
+		return ""
+	}
+	return locale
+}
+
+func (r *EmailTemplateRenderer) Render(templateName, locale string, data map[string]interface{}) (domain.EmailMessage, error) {
+	locale = NormalizeLocale(locale)
+	tmpl, ok := r.templates[locale][templateName]
+	if !ok {
+		locale = r.defaultLocale
+		tmpl, ok = r.templates[locale][templateName]
+		if !ok {
+			return domain.EmailMessage{}, fmt.Errorf("unknown email template %q", templateName)
+		}
+	}
+
+	values := map[string]interface{}{}
+	for key, value := range data {
+		values[key] = value
+	}
+	values["BaseURL"] = r.baseURL
+	values["Locale"] = locale
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", values); err != nil {
+		return domain.EmailMessage{}, err
+	}
+	values["Subject"] = strings.TrimSpace(subject.String())
+
+	if err := tmpl.text.ExecuteTemplate(&text, "text", values); err != nil {
+		return domain.EmailMessage{}, err
+	}
+	if err := tmpl.html.ExecuteTemplate(&html, "layout", values); err != nil {
+		return domain.EmailMessage{}, err
+	}
+
+	return domain.EmailMessage{
+		Subject:  values["Subject"].(string),
+		TextBody: strings.TrimSpace(text.String()),
+		HTMLBody: html.String(),
+	}, nil
+}
+
+func (r *EmailTemplateRenderer) Preview(templateName, locale string) (domain.EmailMessage, error) {
+	data, ok := emailSampleData[templateName]
+	if !ok {
+		return domain.EmailMessage{}, fmt.Errorf("unknown email template %q", templateName)
+	}
+	return r.Render(templateName, locale, data)
+}
+
+func (r *EmailTemplateRenderer) Catalog() domain.EmailTemplateCatalog {
+	catalog := domain.EmailTemplateCatalog{DefaultLocale: r.defaultLocale}
+	for locale := range r.templates {
+		catalog.Locales = append(catalog.Locales, locale)
+	}
+	for name := range r.templates[r.defaultLocale] {
+		catalog.Templates = append(catalog.Templates, name)
+	}
+	sort.Strings(catalog.Locales)
+	sort.Strings(catalog.Templates)
+	return catalog
+}
+
+// emailSampleData feeds the admin preview endpoint; keep it in step with what the usecases pass.
+var emailSampleData = map[string]map[string]interface{}{
+	domain.EmailActivation: {
+		"Username": "jdoe",
+		"Email":    "jdoe@example.com",
+		"Token":    "3f9a0c2e5b7d4a1c8e6f0b2d4a6c8e0f",
+	},
+	domain.EmailPasswordReset: {
+		"Username": "jdoe",
+		"Token":    "3f9a0c2e5b7d4a1c8e6f0b2d4a6c8e0f",
+	},
+	domain.EmailAccountCreated: {
+		"Username":  "jdoe",
+		"Token":     "3f9a0c2e5b7d4a1c8e6f0b2d4a6c8e0f",
+		"ExpiresAt": time.Date(2024, time.August, 9, 14, 30, 0, 0, time.UTC),
+	},
+	domain.EmailPasswordChanged: {
+		"Username":  "jdoe",
+		"ChangedAt": time.Date(2024, time.August, 6, 14, 30, 0, 0, time.UTC),
+	},
+	domain.EmailChange: {
+		"Username": "jdoe",
+		"Email":    "john.doe@example.org",
+		"Token":    "3f9a0c2e5b7d4a1c8e6f0b2d4a6c8e0f",
+	},
+	domain.EmailChanged: {
+		"Username":  "jdoe",
+		"NewEmail":  "john.doe@example.org",
+		"ChangedAt": time.Date(2024, time.August, 6, 14, 30, 0, 0, time.UTC),
+	},
+	domain.EmailLoanApproved: {
+		"Username":     "jdoe",
+		"LoanID":       "66b1f0c2a4e5d6f7a8b9c0d1",
+		"LoanTitle":    "Home renovation",
+		"Amount":       5000.0,
+		"TermMonths":   12,
+		"InterestRate": 9.5,
+		"FirstDueDate": time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC),
+	},
+	domain.EmailLoanRejected: {
+		"Username":  "jdoe",
+		"LoanID":    "66b1f0c2a4e5d6f7a8b9c0d1",
+		"LoanTitle": "Home renovation",
+		"Amount":    5000.0,
+		"Reason":    "Insufficient repayment history",
+	},
+	domain.EmailPaymentReceived: {
+		"Username":    "jdoe",
+		"LoanID":      "66b1f0c2a4e5d6f7a8b9c0d1",
+		"LoanTitle":   "Home renovation",
+		"PaymentID":   "66b2a1d3b5f6e7a8b9c0d1e2",
+		"Amount":      438.71,
+		"Outstanding": 4825.33,
+	},
+	domain.EmailPaymentOverdue: {
+		"Username":  "jdoe",
+		"LoanID":    "66b1f0c2a4e5d6f7a8b9c0d1",
+		"LoanTitle": "Home renovation",
+		"AmountDue": 438.71,
+		"DueDate":   time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC),
+		"LateFee":   25.0,
+	},
+	domain.EmailAccountLocked: {
+		"Username":    "jdoe",
+		"LockedUntil": time.Date(2024, time.August, 6, 14, 30, 0, 0, time.UTC),
+	},
+}
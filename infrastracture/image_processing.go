@@ -0,0 +1,122 @@
+package infrastracture
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"loan-tracker-api/config"
+)
+
+// MaxImageSide guards against decompression bombs: small files that decode to huge bitmaps.
+// At the limit the decoded RGBA bitmap takes 64 MiB.
+const MaxImageSide = 4096
+
+var ErrUnsupportedImage = errors.New("unsupported image")
+
+var ErrImageTooLarge = errors.New("image dimensions too large")
+
+// ProfileImageMaxBytes is the largest accepted upload, 5 MiB unless configured otherwise.
+func ProfileImageMaxBytes() int64 {
+	if config.EnvConfigs.ProfileImageMaxBytes > 0 {
+		return config.EnvConfigs.ProfileImageMaxBytes
+	}
+	return 5 << 20
+}
+
+// DecodeImage decodes a JPEG, PNG or GIF and returns it with the format it should be stored
+// in: JPEG stays JPEG, everything else becomes PNG so transparency survives. The bitmap is
+// converted to RGBA here, once, so resizing it to several sizes needs no further full-size copies.
+func DecodeImage(data []byte) (*image.RGBA, string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupportedImage
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, "", ErrUnsupportedImage
+	}
+	if cfg.Width > MaxImageSide || cfg.Height > MaxImageSide {
+		return nil, "", ErrImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupportedImage
+	}
+
+	// averaging premultiplied values keeps transparent edges from turning dark
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+
+	if format == "jpeg" {
+		return rgba, "jpg", nil
+	}
+	return rgba, "png", nil
+}
+
+// ResizeToFit scales src down, keeping its aspect ratio, so neither side exceeds maxSize.
+// Smaller images are returned unscaled. Every destination pixel is the average of the source
+// pixels it covers, which gives clean thumbnails without a resampling library.
+func ResizeToFit(src *image.RGBA, maxSize int) *image.RGBA {
+	srcW, srcH := src.Bounds().Dx(), src.Bounds().Dy()
+	if srcW <= maxSize && srcH <= maxSize {
+		return src
+	}
+
+	dstW, dstH := maxSize, maxSize
+	if srcW > srcH {
+		dstH = max(1, srcH*maxSize/srcW)
+	} else {
+		dstW = max(1, srcW*maxSize/srcH)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for dy := 0; dy < dstH; dy++ {
+		y0 := dy * srcH / dstH
+		y1 := max(y0+1, (dy+1)*srcH/dstH)
+		for dx := 0; dx < dstW; dx++ {
+			x0 := dx * srcW / dstW
+			x1 := max(x0+1, (dx+1)*srcW/dstW)
+
+			var r, g, b, a, n int
+			for y := y0; y < y1; y++ {
+				row := src.Pix[y*src.Stride:]
+				for x := x0; x < x1; x++ {
+					p := row[x*4 : x*4+4]
+					r += int(p[0])
+					g += int(p[1])
+					b += int(p[2])
+					a += int(p[3])
+					n++
+				}
+			}
+
+			d := dst.Pix[dy*dst.Stride+dx*4:]
+			d[0] = uint8(r / n)
+			d[1] = uint8(g / n)
+			d[2] = uint8(b / n)
+			d[3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// EncodeImage writes img as "jpg" or "png". Re-encoding also drops any metadata the upload
+// carried, such as the GPS position in a photo's EXIF block.
+func EncodeImage(img image.Image, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if format == "jpg" {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,191 @@
+package infrastracture
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"loan-tracker-api/config"
+	"loan-tracker-api/domain"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// jwtKey is one entry of a KeySet. Keys without a private part only verify: they belong to a
+// retired signing key whose tokens have not all expired yet.
+type jwtKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+// KeySet holds every key tokens may be signed with and the one new tokens are signed with.
+type KeySet struct {
+	signing *jwtKey
+	keys    map[string]*jwtKey
+}
+
+// NewKeySet loads the keys from JWT_KEYS_DIR, one PEM file per key named <kid>.pem. A private
+// key file (PKCS#1 or PKCS#8, RSA or Ed25519) can sign and verify, a public key file only
+// verifies. JWT_SIGNING_KEY_ID picks the signing key and may only be left out when the
+// directory holds a single private key. JWT_KEYS_DIR is required; only with DEV_MODE does an
+// unset directory fall back to a temporary key.
+//
+// To rotate, add the new key, publish it through the JWKS endpoint for a while, switch
+// JWT_SIGNING_KEY_ID to it, then replace the old private key with its public key and delete that
+// once the longest lived token signed with it has expired.
+func NewKeySet() *KeySet {
+	dir := config.EnvConfigs.JwtKeysDir
+	if dir == "" {
+		// every restart would sign everyone out and instances couldn't share tokens
+		if !config.EnvConfigs.DevMode {
+			log.Fatal("JWT_KEYS_DIR is not set; point it at the signing keys, or set DEV_MODE to sign tokens with a temporary key")
+		}
+		log.Println("JWT_KEYS_DIR is not set, signing tokens with a temporary key")
+		keys, err := newEphemeralKeySet()
+		if err != nil {
+			panic(err)
+		}
+		return keys
+	}
+
+	keys, err := LoadKeySet(dir, config.EnvConfigs.JwtSigningKeyID)
+	if err != nil {
+		log.Fatalf("Error loading JWT keys: %v", err)
+	}
+	return keys
+}
+
+func LoadKeySet(dir, signingKeyID string) (*KeySet, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := &KeySet{keys: map[string]*jwtKey{}}
+	var privateKeys []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		id := strings.TrimSuffix(filepath.Base(file), ".pem")
+		key, err := parseJWTKey(id, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		keys.keys[id] = key
+		if key.private != nil {
+			privateKeys = append(privateKeys, id)
+		}
+	}
+
+	if signingKeyID == "" {
+		if len(privateKeys) != 1 {
+			return nil, fmt.Errorf("%s holds %d private keys; set JWT_SIGNING_KEY_ID to pick one", dir, len(privateKeys))
+		}
+		signingKeyID = privateKeys[0]
+	}
+	signing, ok := keys.keys[signingKeyID]
+	if !ok || signing.private == nil {
+		return nil, fmt.Errorf("no private key %q in %s", signingKeyID, dir)
+	}
+	keys.signing = signing
+
+	return keys, nil
+}
+
+func parseJWTKey(id string, data []byte) (*jwtKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must have at least 2048 bits")
+		}
+		return &jwtKey{id: id, method: jwt.SigningMethodRS256, private: key, public: &key.PublicKey}, nil
+	case *rsa.PublicKey:
+		if key.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must have at least 2048 bits")
+		}
+		return &jwtKey{id: id, method: jwt.SigningMethodRS256, public: key}, nil
+	case ed25519.PrivateKey:
+		return &jwtKey{id: id, method: jwt.SigningMethodEdDSA, private: key, public: key.Public()}, nil
+	case ed25519.PublicKey:
+		return &jwtKey{id: id, method: jwt.SigningMethodEdDSA, public: key}, nil
+	}
+	return nil, errors.New("only RSA and Ed25519 keys are supported")
+}
+
+func newEphemeralKeySet() (*KeySet, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+
+	key := &jwtKey{id: "ephemeral-" + hex.EncodeToString(suffix), method: jwt.SigningMethodEdDSA, private: private, public: public}
+	return &KeySet{signing: key, keys: map[string]*jwtKey{key.id: key}}, nil
+}
+
+// JWKS lists the public half of every key, ordered by kid.
+func (k *KeySet) JWKS() domain.JWKSet {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	set := domain.JWKSet{Keys: []domain.JWK{}}
+	for _, id := range ids {
+		key := k.keys[id]
+		jwk := domain.JWK{KeyID: key.id, Use: "sig", Algorithm: key.method.Alg()}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
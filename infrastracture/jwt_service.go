@@ -1,6 +1,10 @@
 package infrastracture
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"loan-tracker-api/config"
 	"loan-tracker-api/domain"
 	"time"
@@ -8,82 +12,226 @@ import (
 	"github.com/golang-jwt/jwt"
 )
 
-// TokenGenerator implementation
-type TokenGeneratorImpl struct{}
+// refreshPurpose marks refresh tokens, which share the signing keys with access tokens
+const refreshPurpose = "refresh"
 
-// NewTokenGenerator creates a new TokenGenerator instance
-func NewTokenGenerator() domain.TokenGenerator {
-	return &TokenGeneratorImpl{}
+// Every kind of token carries its own audience and typ header. Services that verify our tokens
+// against the published JWKS only have to check aud, as they would for any issuer, to accept
+// nothing but full access tokens; they don't need to know our purpose or impersonated_by claims.
+const (
+	accessAudience        = "loan-tracker-api"
+	refreshAudience       = "loan-tracker-api/refresh"
+	challengeAudience     = "loan-tracker-api/2fa-challenge"
+	impersonationAudience = "loan-tracker-api/impersonation"
+)
+
+// JWTService signs and verifies every token the API issues, using the keys of a KeySet.
+// It implements both domain.TokenGenerator and domain.TokenVerifier.
+type JWTService struct {
+	keys *KeySet
 }
 
-// GenerateToken generates an access token for the user
-func (tg *TokenGeneratorImpl) GenerateToken(user domain.User) (string, error) {
-	accessTokenSecret := []byte(config.EnvConfigs.JwtSecret)
-	accessTokenExpiryHour := config.EnvConfigs.AccessTokenExpiryHour
+func NewJWTService(keys *KeySet) *JWTService {
+	return &JWTService{keys: keys}
+}
 
-	claims := domain.JwtCustomClaims{
-		Authorized:  true,
-		UserID:      user.ID.Hex(),
-		Role:        user.Role,
-		Username:    user.Username,
-		IsActivated: user.IsActive,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * time.Duration(accessTokenExpiryHour)).Unix(),
-		},
+// tokenKind derives the audience and typ header a token must carry from its purpose and whether
+// it impersonates someone. Access tokens use the at+jwt type of RFC 9068.
+func tokenKind(claims domain.JwtCustomClaims) (audience, typ string, err error) {
+	switch {
+	case claims.Purpose == refreshPurpose:
+		return refreshAudience, "refresh+jwt", nil
+	case claims.Purpose == challengePurpose:
+		return challengeAudience, "2fa-challenge+jwt", nil
+	case claims.Purpose != "":
+		return "", "", fmt.Errorf("unknown token purpose %q", claims.Purpose)
+	case claims.ImpersonatedBy != "":
+		return impersonationAudience, "impersonation+jwt", nil
+	default:
+		return accessAudience, "at+jwt", nil
+	}
+}
+
+// newToken builds an unsigned token with the audience and typ of its kind.
+func newToken(method jwt.SigningMethod, claims domain.JwtCustomClaims) (*jwt.Token, error) {
+	audience, typ, err := tokenKind(claims)
+	if err != nil {
+		return nil, err
 	}
+	claims.Audience = audience
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["typ"] = typ
+	return token, nil
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	t, err := token.SignedString(accessTokenSecret)
+// sign stamps the token with the signing key's kid so verifiers can pick the matching key
+func (s *JWTService) sign(claims domain.JwtCustomClaims) (string, error) {
+	token, err := newToken(s.keys.signing.method, claims)
 	if err != nil {
 		return "", err
 	}
-	return t, nil
+	token.Header["kid"] = s.keys.signing.id
+	return token.SignedString(s.keys.signing.private)
 }
 
-// GenerateRefreshToken generates a refresh token for the user
-func (tg *TokenGeneratorImpl) GenerateRefreshToken(user domain.User) (string, error) {
-	refreshTokenSecret := []byte(config.EnvConfigs.JwtRefreshSecret)
-	refreshTokenExpiryHour := config.EnvConfigs.RefreshTokenExpiryHour
+// parse verifies the signature with the key named by the kid header. The algorithm must be
+// the one that key is used with, so a token can't pick a weaker one.
+func (s *JWTService) parse(tokenString string) (*domain.JwtCustomClaims, error) {
+	claims := &domain.JwtCustomClaims{}
+	t, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		id, _ := token.Header["kid"].(string)
+		key, ok := s.keys.keys[id]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", id)
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.public, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !t.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	// the audience and type must match the kind the claims describe, so a token of one kind
+	// can't pass for another anywhere
+	audience, typ, err := tokenKind(*claims)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Audience != audience || t.Header["typ"] != typ {
+		return nil, errors.New("token audience or type does not match its kind")
+	}
+	return claims, nil
+}
+
+func userClaims(user domain.User, purpose string, expiry time.Duration) (domain.JwtCustomClaims, error) {
+	tokenID, err := newTokenID()
+	if err != nil {
+		return domain.JwtCustomClaims{}, err
+	}
 
-	claims := domain.JwtCustomClaims{
+	return domain.JwtCustomClaims{
 		Authorized:  true,
 		UserID:      user.ID.Hex(),
 		Role:        user.Role,
 		Username:    user.Username,
 		IsActivated: user.IsActive,
+		TwoFactor:   user.TwoFactorEnabled,
+		Purpose:     purpose,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * time.Duration(refreshTokenExpiryHour)).Unix(),
+			Id:        tokenID,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(expiry).Unix(),
 		},
+	}, nil
+}
+
+// GenerateToken generates an access token for the user
+func (s *JWTService) GenerateToken(user domain.User) (string, error) {
+	claims, err := userClaims(user, "", time.Hour*time.Duration(config.EnvConfigs.AccessTokenExpiryHour))
+	if err != nil {
+		return "", err
 	}
+	return s.sign(claims)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	t, err := token.SignedString(refreshTokenSecret)
+// GenerateRefreshToken generates a refresh token for the user
+func (s *JWTService) GenerateRefreshToken(user domain.User) (string, error) {
+	claims, err := userClaims(user, refreshPurpose, time.Hour*time.Duration(config.EnvConfigs.RefreshTokenExpiryHour))
 	if err != nil {
 		return "", err
 	}
-	return t, nil
+	return s.sign(claims)
 }
 
-// RefreshToken parses and verifies a refresh token and returns the user ID
-func (tg *TokenGeneratorImpl) RefreshToken(tokenString string) (string, error) {
-	refreshTokenSecret := []byte(config.EnvConfigs.JwtRefreshSecret)
+// challengePurpose marks tokens issued between the password and the second factor of a login
+const challengePurpose = "2fa_challenge"
+
+// challengeTokenExpiry is how long a user has to enter their second factor after the password step
+const challengeTokenExpiry = 5 * time.Minute
+
+// GenerateChallengeToken issues a short-lived token that only VerifyChallengeToken accepts
+func (s *JWTService) GenerateChallengeToken(user domain.User) (string, error) {
+	tokenID, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
 
-	t, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return refreshTokenSecret, nil
+	return s.sign(domain.JwtCustomClaims{
+		UserID:  user.ID.Hex(),
+		Purpose: challengePurpose,
+		StandardClaims: jwt.StandardClaims{
+			Id:        tokenID,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(challengeTokenExpiry).Unix(),
+		},
 	})
+}
+
+// VerifyChallengeToken checks a challenge token's signature, expiry and purpose and returns the user ID
+func (s *JWTService) VerifyChallengeToken(tokenString string) (string, error) {
+	claims, err := s.parse(tokenString)
 	if err != nil {
 		return "", err
 	}
+	if claims.Purpose != challengePurpose || claims.UserID == "" {
+		return "", errors.New("invalid challenge token")
+	}
+
+	return claims.UserID, nil
+}
 
-	claims, ok := t.Claims.(jwt.MapClaims)
-	if !ok || !t.Valid {
+// GenerateImpersonationToken issues an access token for user that also names the admin behind it.
+// AuthMiddleware only lets it read and logs every request made with it.
+func (s *JWTService) GenerateImpersonationToken(user domain.User, adminID string, expiry time.Duration) (string, error) {
+	claims, err := userClaims(user, "", expiry)
+	if err != nil {
 		return "", err
 	}
+	claims.ImpersonatedBy = adminID
+	return s.sign(claims)
+}
+
+// newTokenID returns a random identifier used as the jti claim
+func newTokenID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
 
-	userID, ok := claims["user_id"].(string)
-	if !ok {
+// RefreshToken parses and verifies a refresh token and returns the user ID
+func (s *JWTService) RefreshToken(tokenString string) (string, error) {
+	claims, err := s.parse(tokenString)
+	if err != nil {
 		return "", err
 	}
+	if claims.Purpose != refreshPurpose || claims.UserID == "" {
+		return "", errors.New("invalid refresh token")
+	}
+
+	return claims.UserID, nil
+}
+
+// VerifyAccessToken accepts only access tokens, including the read-only ones of an impersonation;
+// refresh, challenge and other purpose tokens are signed with the same keys but grant no access.
+func (s *JWTService) VerifyAccessToken(tokenString string) (*domain.JwtCustomClaims, error) {
+	claims, err := s.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, errors.New("not an access token")
+	}
+
+	return claims, nil
+}
 
-	return userID, nil
+func (s *JWTService) JWKS() domain.JWKSet {
+	return s.keys.JWKS()
 }
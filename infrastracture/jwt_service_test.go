@@ -0,0 +1,342 @@
+package infrastracture
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"loan-tracker-api/domain"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var testUser = domain.User{ID: primitive.NewObjectID(), Username: "alice", Role: "user", IsActive: true}
+
+func newRSATestKey(t *testing.T, bits int) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newEd25519TestKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writePKCS8(t *testing.T, dir, name string, key interface{}) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, name, "PRIVATE KEY", der)
+}
+
+func writePublic(t *testing.T, dir, name string, key interface{}) {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, name, "PUBLIC KEY", der)
+}
+
+// signWith signs claims with an arbitrary method, key and kid, the way a forged token would be made.
+// The audience and typ are those of the claims' kind unless the claims already name an audience.
+func signWith(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims domain.JwtCustomClaims) string {
+	t.Helper()
+	token, err := newToken(method, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Audience != "" {
+		token.Claims = claims
+	}
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func testClaims(t *testing.T, purpose string) domain.JwtCustomClaims {
+	t.Helper()
+	claims, err := userClaims(testUser, purpose, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+func TestJWTServiceParse(t *testing.T) {
+	rsaKey := newRSATestKey(t, 2048)
+	edKey := newEd25519TestKey(t)
+	otherEdKey := newEd25519TestKey(t)
+
+	keys := &KeySet{keys: map[string]*jwtKey{
+		"rsa": {id: "rsa", method: jwt.SigningMethodRS256, private: rsaKey, public: &rsaKey.PublicKey},
+		"ed":  {id: "ed", method: jwt.SigningMethodEdDSA, private: edKey, public: edKey.Public()},
+	}}
+	keys.signing = keys.keys["ed"]
+	service := NewJWTService(keys)
+
+	claims := testClaims(t, "")
+	expired := testClaims(t, "")
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	rsaPublicDER := x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)
+	refreshAudienceOnAccess := testClaims(t, "")
+	refreshAudienceOnAccess.Audience = refreshAudience
+	accessAudienceOnRefresh := testClaims(t, refreshPurpose)
+	accessAudienceOnRefresh.Audience = accessAudience
+	impersonating := testClaims(t, "")
+	impersonating.ImpersonatedBy = primitive.NewObjectID().Hex()
+	impersonatingAsAccess := impersonating
+	impersonatingAsAccess.Audience = accessAudience
+	untyped, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, testClaims(t, "")).SignedString(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"signed with the EdDSA key", signWith(t, jwt.SigningMethodEdDSA, edKey, "ed", claims), false},
+		{"signed with the RSA key", signWith(t, jwt.SigningMethodRS256, rsaKey, "rsa", claims), false},
+		{"unknown kid", signWith(t, jwt.SigningMethodEdDSA, edKey, "missing", claims), true},
+		{"missing kid", signWith(t, jwt.SigningMethodEdDSA, edKey, "", claims), true},
+		{"kid of another key", signWith(t, jwt.SigningMethodEdDSA, edKey, "rsa", claims), true},
+		{"signed by a key outside the set", signWith(t, jwt.SigningMethodEdDSA, otherEdKey, "ed", claims), true},
+		// the classic alg swap: HMAC keyed with the verifier's public key
+		{"HS256 with the RSA public key as secret", signWith(t, jwt.SigningMethodHS256, rsaPublicDER, "rsa", claims), true},
+		{"alg none", signWith(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "ed", claims), true},
+		{"RS256 under an EdDSA kid", signWith(t, jwt.SigningMethodRS256, rsaKey, "ed", claims), true},
+		{"expired", signWith(t, jwt.SigningMethodEdDSA, edKey, "ed", expired), true},
+		{"impersonation token", signWith(t, jwt.SigningMethodEdDSA, edKey, "ed", impersonating), false},
+		{"access claims under the refresh audience", signWith(t, jwt.SigningMethodEdDSA, edKey, "ed", refreshAudienceOnAccess), true},
+		{"refresh claims under the access audience", signWith(t, jwt.SigningMethodEdDSA, edKey, "ed", accessAudienceOnRefresh), true},
+		{"impersonation under the access audience", signWith(t, jwt.SigningMethodEdDSA, edKey, "ed", impersonatingAsAccess), true},
+		{"no kid, aud or typ", untyped, true},
+		{"garbage", "not.a.token", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := service.parse(tt.token)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected the token to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if parsed.UserID != testUser.ID.Hex() {
+				t.Errorf("user ID = %q, want %q", parsed.UserID, testUser.ID.Hex())
+			}
+		})
+	}
+}
+
+func TestJWTServiceChecksPurpose(t *testing.T) {
+	keys, err := newEphemeralKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewJWTService(keys)
+
+	sign := func(purpose string) string {
+		token, err := service.sign(testClaims(t, purpose))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	access := sign("")
+	refresh := sign(refreshPurpose)
+	challenge, err := service.GenerateChallengeToken(testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifiers := map[string]func(string) error{
+		"access": func(token string) error {
+			_, err := service.VerifyAccessToken(token)
+			return err
+		},
+		"refresh": func(token string) error {
+			_, err := service.RefreshToken(token)
+			return err
+		},
+		"challenge": func(token string) error {
+			_, err := service.VerifyChallengeToken(token)
+			return err
+		},
+	}
+	tokens := map[string]string{"access": access, "refresh": refresh, "challenge": challenge}
+
+	for verifier, verify := range verifiers {
+		for kind, token := range tokens {
+			err := verify(token)
+			if kind == verifier && err != nil {
+				t.Errorf("%s verifier rejected a %s token: %v", verifier, kind, err)
+			}
+			if kind != verifier && err == nil {
+				t.Errorf("%s verifier accepted a %s token", verifier, kind)
+			}
+		}
+	}
+}
+
+func TestLoadKeySet(t *testing.T) {
+	rsaKey := newRSATestKey(t, 2048)
+	edKey := newEd25519TestKey(t)
+	retiredKey := newEd25519TestKey(t)
+
+	tests := []struct {
+		name        string
+		files       func(t *testing.T, dir string)
+		signingID   string
+		wantSigning string
+		wantErr     bool
+	}{
+		{
+			name:        "single private key needs no id",
+			files:       func(t *testing.T, dir string) { writePKCS8(t, dir, "only.pem", edKey) },
+			wantSigning: "only",
+		},
+		{
+			name: "PKCS#1 RSA key picked by id next to a retired public key",
+			files: func(t *testing.T, dir string) {
+				writePEM(t, dir, "2026-rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+				writePKCS8(t, dir, "2026-ed.pem", edKey)
+				writePublic(t, dir, "2025.pem", retiredKey.Public())
+			},
+			signingID:   "2026-rsa",
+			wantSigning: "2026-rsa",
+		},
+		{
+			name: "two private keys without an id",
+			files: func(t *testing.T, dir string) {
+				writePKCS8(t, dir, "a.pem", edKey)
+				writePKCS8(t, dir, "b.pem", rsaKey)
+			},
+			wantErr: true,
+		},
+		{
+			name:      "signing id names a public key",
+			files:     func(t *testing.T, dir string) { writePublic(t, dir, "2025.pem", retiredKey.Public()) },
+			signingID: "2025",
+			wantErr:   true,
+		},
+		{
+			name:      "unknown signing id",
+			files:     func(t *testing.T, dir string) { writePKCS8(t, dir, "only.pem", edKey) },
+			signingID: "other",
+			wantErr:   true,
+		},
+		{
+			name:    "empty directory",
+			files:   func(t *testing.T, dir string) {},
+			wantErr: true,
+		},
+		{
+			name:    "RSA key below 2048 bits",
+			files:   func(t *testing.T, dir string) { writePKCS8(t, dir, "weak.pem", newRSATestKey(t, 1024)) },
+			wantErr: true,
+		},
+		{
+			name:    "unsupported PEM block",
+			files:   func(t *testing.T, dir string) { writePEM(t, dir, "cert.pem", "CERTIFICATE", []byte("x")) },
+			wantErr: true,
+		},
+		{
+			name: "not PEM at all",
+			files: func(t *testing.T, dir string) {
+				if err := os.WriteFile(filepath.Join(dir, "junk.pem"), []byte("junk"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.files(t, dir)
+
+			keys, err := LoadKeySet(dir, tt.signingID)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if keys.signing.id != tt.wantSigning {
+				t.Errorf("signing key = %q, want %q", keys.signing.id, tt.wantSigning)
+			}
+			if got, want := len(keys.JWKS().Keys), len(keys.keys); got != want {
+				t.Errorf("JWKS lists %d keys, want %d", got, want)
+			}
+		})
+	}
+}
+
+// A token signed before a rotation keeps verifying while its key is only published as a public key.
+func TestLoadKeySetVerifiesTokensOfRetiredKeys(t *testing.T) {
+	retiredKey := newEd25519TestKey(t)
+	dir := t.TempDir()
+	writePKCS8(t, dir, "2026.pem", newEd25519TestKey(t))
+	writePublic(t, dir, "2025.pem", retiredKey.Public())
+
+	keys, err := LoadKeySet(dir, "2026")
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewJWTService(keys)
+
+	old := signWith(t, jwt.SigningMethodEdDSA, retiredKey, "2025", testClaims(t, ""))
+	if _, err := service.VerifyAccessToken(old); err != nil {
+		t.Errorf("token of the retired key was rejected: %v", err)
+	}
+
+	current, err := service.sign(testClaims(t, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := service.VerifyAccessToken(current)
+	if err != nil {
+		t.Fatalf("token of the signing key was rejected: %v", err)
+	}
+	if parsed.UserID != testUser.ID.Hex() {
+		t.Errorf("user ID = %q, want %q", parsed.UserID, testUser.ID.Hex())
+	}
+}
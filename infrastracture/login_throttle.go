@@ -0,0 +1,138 @@
+package infrastracture
+
+import (
+	"loan-tracker-api/config"
+	"loan-tracker-api/domain"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAccountLockoutThreshold = 5
+	defaultIPLockoutThreshold      = 20
+	defaultLockoutMinutes          = 15
+	defaultAttemptWindowMinutes    = 15
+
+	// failures below freeAttempts are not delayed; after that each failure doubles the wait up to maxLoginDelay
+	freeAttempts  = 3
+	maxLoginDelay = 5 * time.Minute
+)
+
+type LoginThrottleImpl struct {
+	attemptRepo domain.LoginAttemptRepository
+}
+
+func NewLoginThrottle(attemptRepo domain.LoginAttemptRepository) domain.LoginThrottle {
+	return &LoginThrottleImpl{attemptRepo: attemptRepo}
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func (t *LoginThrottleImpl) Check(email, ip string) (time.Duration, bool, error) {
+	now := time.Now()
+	var wait time.Duration
+	locked := false
+
+	for _, key := range []string{accountKey(email), ipKey(ip)} {
+		attempt, err := t.attemptRepo.GetLoginAttempt(key)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if attempt.LockedUntil.After(now) {
+			if remaining := attempt.LockedUntil.Sub(now); remaining > wait {
+				wait = remaining
+			}
+			locked = true
+			continue
+		}
+
+		if attempt.ExpiresAt.After(now) {
+			if remaining := attempt.LastFailure.Add(loginDelay(attempt.Failures)).Sub(now); remaining > wait {
+				wait = remaining
+			}
+		}
+	}
+
+	return wait, locked, nil
+}
+
+func (t *LoginThrottleImpl) RegisterFailure(email, ip string) (time.Time, error) {
+	accountLockedUntil, err := t.registerFailure(accountKey(email), lockoutThreshold(config.EnvConfigs.LoginLockoutThreshold, defaultAccountLockoutThreshold))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	_, err = t.registerFailure(ipKey(ip), lockoutThreshold(config.EnvConfigs.LoginIPLockoutThreshold, defaultIPLockoutThreshold))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return accountLockedUntil, nil
+}
+
+// registerFailure bumps the counter for key and locks it once threshold is reached.
+// It returns the lockout end only for the failure that triggered the lockout.
+func (t *LoginThrottleImpl) registerFailure(key string, threshold int) (time.Time, error) {
+	// Mongo keeps dates to the millisecond; truncating lets the returned lockout be compared exactly
+	now := time.Now().Truncate(time.Millisecond)
+	lockedUntil := now.Add(lockoutDuration())
+
+	attempt, err := t.attemptRepo.RecordFailure(key, now, threshold, attemptWindow(), lockoutDuration())
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if !attempt.LockedUntil.Equal(lockedUntil) {
+		return time.Time{}, nil
+	}
+	return lockedUntil, nil
+}
+
+func (t *LoginThrottleImpl) RegisterSuccess(email string) error {
+	return t.attemptRepo.DeleteLoginAttempt(accountKey(email))
+}
+
+func (t *LoginThrottleImpl) Unlock(email string) error {
+	return t.attemptRepo.DeleteLoginAttempt(accountKey(email))
+}
+
+func loginDelay(failures int) time.Duration {
+	if failures < freeAttempts {
+		return 0
+	}
+	delay := time.Second << uint(failures-freeAttempts)
+	if delay <= 0 || delay > maxLoginDelay {
+		return maxLoginDelay
+	}
+	return delay
+}
+
+func lockoutThreshold(configured, fallback int) int {
+	if configured > 0 {
+		return configured
+	}
+	return fallback
+}
+
+func lockoutDuration() time.Duration {
+	minutes := config.EnvConfigs.LoginLockoutMinutes
+	if minutes <= 0 {
+		minutes = defaultLockoutMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+func attemptWindow() time.Duration {
+	minutes := config.EnvConfigs.LoginAttemptWindowMinutes
+	if minutes <= 0 {
+		minutes = defaultAttemptWindowMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
@@ -0,0 +1,160 @@
+package infrastracture
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"loan-tracker-api/config"
+	"loan-tracker-api/domain"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/gomail.v2"
+)
+
+// NewMailer picks the mail backend from MAILER_BACKEND ("smtp", "file" or "memory"). It must be
+// set, so a forgotten setting can't quietly write production mail to disk; only with DEV_MODE
+// does an unset backend fall back to the file outbox.
+func NewMailer() domain.Mailer {
+	backend := config.EnvConfigs.MailerBackend
+	if backend == "" {
+		if !config.EnvConfigs.DevMode {
+			log.Fatal("MAILER_BACKEND is not set; set it to smtp, file or memory, or set DEV_MODE to write emails to the file outbox")
+		}
+		log.Println("MAILER_BACKEND is not set, writing emails to the file outbox")
+		backend = "file"
+	}
+
+	switch backend {
+	case "memory":
+		return NewMemoryMailer()
+	case "file":
+		dir := config.EnvConfigs.MailOutboxDir
+		if dir == "" {
+			dir = "outbox"
+		}
+		return NewFileMailer(dir)
+	case "smtp":
+		return NewSMTPMailer(config.EnvConfigs.SMTPHost, config.EnvConfigs.SMTPPort, config.EnvConfigs.SMTPUsername, config.EnvConfigs.SMTPPassword, config.EnvConfigs.MailFrom)
+	}
+	log.Fatalf("Unknown MAILER_BACKEND %q; use smtp, file or memory", backend)
+	return nil
+}
+
+// SMTPMailer delivers messages through an SMTP server.
+type SMTPMailer struct {
+	dialer *gomail.Dialer
+	from   string
+}
+
+func NewSMTPMailer(host string, port int, username, password, from string) *SMTPMailer {
+	if port == 0 {
+		port = 587
+	}
+	if from == "" {
+		from = username
+	}
+	return &SMTPMailer{
+		dialer: gomail.NewDialer(host, port, username, password),
+		from:   from,
+	}
+}
+
+func (s *SMTPMailer) Send(message domain.EmailMessage) error {
+	if s.dialer.Host == "" {
+		return errors.New("smtp host is not configured")
+	}
+
+	m := gomail.NewMessage()
+	m.SetHeader("From", s.from)
+	m.SetHeader("To", message.To)
+	m.SetHeader("Subject", message.Subject)
+
+	switch {
+	case message.TextBody != "" && message.HTMLBody != "":
+		m.SetBody("text/plain", message.TextBody)
+		m.AddAlternative("text/html", message.HTMLBody)
+	case message.HTMLBody != "":
+		m.SetBody("text/html", message.HTMLBody)
+	default:
+		m.SetBody("text/plain", message.TextBody)
+	}
+
+	return s.dialer.DialAndSend(m)
+}
+
+// FileMailer writes every message as an .eml file into a directory instead of sending it.
+type FileMailer struct {
+	dir string
+}
+
+func NewFileMailer(dir string) *FileMailer {
+	return &FileMailer{dir: dir}
+}
+
+func (f *FileMailer) Send(message domain.EmailMessage) error {
+	if err := os.MkdirAll(f.dir, 0o755); err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%s-%s.eml", now.Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+
+	boundary := "loan-tracker-" + hex.EncodeToString(suffix)
+	var b strings.Builder
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "To: %s\r\n", message.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&b, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+	if message.TextBody != "" {
+		fmt.Fprintf(&b, "--%s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n", boundary, message.TextBody)
+	}
+	if message.HTMLBody != "" {
+		fmt.Fprintf(&b, "--%s\r\nContent-Type: text/html; charset=utf-8\r\n\r\n%s\r\n", boundary, message.HTMLBody)
+	}
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+
+	return os.WriteFile(filepath.Join(f.dir, name), []byte(b.String()), 0o644)
+}
+
+// MemoryMailer keeps sent messages in memory so tests can assert on them.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []domain.EmailMessage
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(message domain.EmailMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+// Messages returns a copy of every message sent so far.
+func (m *MemoryMailer) Messages() []domain.EmailMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]domain.EmailMessage(nil), m.messages...)
+}
+
+// Reset forgets all recorded messages.
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
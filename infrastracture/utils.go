@@ -3,12 +3,10 @@ package infrastracture
 import (
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
-	"fmt"
 	"regexp"
 	"unicode"
-
-	"gopkg.in/gomail.v2"
 )
 
 func IsValidEmail(email string) bool {
@@ -48,24 +46,8 @@ func IsValidPassword(password string) bool {
 }
 
 
-func SendActivationEmail(email, token string) error {
-	m := gomail.NewMessage()
-	m.SetHeader("From", "bereket.meng@gmail.com")
-	m.SetHeader("To", email)
-	m.SetHeader("Subject", "Account Activation")
-
-
-	m.SetBody("text/html", fmt.Sprintf("Click <a href=\"http://localhost:8080/users/verify-email?email=%s&token=%s\">here</a> to activate your account.", email, token))
 
 
-	d := gomail.NewDialer("smtp.gmail.com", 587, "bereket.meng@gmail.com", "xjbs vduu hkjd lqlf")
-
-	
-	if err := d.DialAndSend(m); err != nil {
-		return err
-	}
-	return nil
-}
 
 
 func GenerateOTP() (string, error) {
@@ -95,27 +77,21 @@ func GenerateActivationToken() (string, error) {
 	return hex.EncodeToString(token), nil
 }
 
+// HashToken hashes an emailed activation or reset token, or a refresh token, for storage, so a
+// leaked database doesn't hand out working links or sessions. The tokens carry at least 128 random
+// bits, so plain SHA-256 is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// TokenHashMatches compares a presented token with a stored hash in constant time.
+func TokenHashMatches(token, storedHash string) bool {
+	return storedHash != "" && subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(storedHash)) == 1
+}
+
 func GenerateDeviceFingerprint(ip, userAgent string) string {
     data := ip + userAgent
     hash := sha256.Sum256([]byte(data))
     return hex.EncodeToString(hash[:])
 }
-
-func SendResetLink(email, token string) error {
-	m := gomail.NewMessage()
-	m.SetHeader("From", "bereket.meng@gmail.com")
-	m.SetHeader("To", email)
-	m.SetHeader("Subject", "Password Reset Link")
-
-
-	m.SetBody("text/html", fmt.Sprintf("Click <a href=\"http://127.0.0.1:8080/users/reset-password/%s\">here</a> to reset your password.", token))
-
-
-	d := gomail.NewDialer("smtp.gmail.com", 587, "bereket.meng@gmail.com", "xjbs vduu hkjd lqlf")
-
-	
-	if err := d.DialAndSend(m); err != nil {
-		return err
-	}
-	return nil
-}
\ No newline at end of file
@@ -0,0 +1,45 @@
+package infrastracture
+
+import "testing"
+
+func TestHashToken(t *testing.T) {
+	// SHA-256 of "abc", from FIPS 180-2
+	const abc = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got := HashToken("abc"); got != abc {
+		t.Errorf("HashToken(abc) = %s, want %s", got, abc)
+	}
+	if HashToken("token-a") == HashToken("token-b") {
+		t.Error("different tokens hash the same")
+	}
+}
+
+func TestTokenHashMatches(t *testing.T) {
+	token, err := GenerateActivationToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := HashToken(token)
+
+	tests := []struct {
+		name       string
+		token      string
+		storedHash string
+		want       bool
+	}{
+		{"matching token", token, stored, true},
+		{"other token", token + "x", stored, false},
+		{"hash presented as the token", stored, stored, false},
+		// a consumed token is stored as "", which must never match anything
+		{"empty stored hash", "", "", false},
+		{"token against empty stored hash", token, "", false},
+		{"empty token", "", stored, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TokenHashMatches(tt.token, tt.storedHash); got != tt.want {
+				t.Errorf("TokenHashMatches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package infrastracture
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+)
+
+//go:embed templates/pages
+var pageTemplateFS embed.FS
+
+// pageTemplates are the few HTML pages the API serves itself, for links opened from emails.
+// They ship inside the binary, so a parse error panics at startup.
+var pageTemplates = htmltemplate.Must(htmltemplate.ParseFS(pageTemplateFS, "templates/pages/*.html"))
+
+// RenderPage renders the embedded page with the given file name.
+func RenderPage(name string, data interface{}) ([]byte, error) {
+	var page bytes.Buffer
+	if err := pageTemplates.ExecuteTemplate(&page, name, data); err != nil {
+		return nil, err
+	}
+	return page.Bytes(), nil
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"loan-tracker-api/domain"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoAPIKeyRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAPIKeyRepositoryImpl(coll *mongo.Collection) domain.APIKeyRepository {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// every authenticated request looks its key up by hash
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"key_hash": 1},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("Error creating indexes on api keys: %v", err)
+	}
+
+	return &MongoAPIKeyRepository{collection: coll}
+}
+
+func (m *MongoAPIKeyRepository) CreateKey(key domain.APIKey) (domain.APIKey, error) {
+	result, err := m.collection.InsertOne(context.Background(), key)
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+	key.ID = result.InsertedID.(primitive.ObjectID)
+	return key, nil
+}
+
+func (m *MongoAPIKeyRepository) GetKeyByHash(keyHash string) (domain.APIKey, error) {
+	var key domain.APIKey
+	err := m.collection.FindOne(context.Background(), bson.M{"key_hash": keyHash}).Decode(&key)
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+	return key, nil
+}
+
+func (m *MongoAPIKeyRepository) GetKeys() ([]domain.APIKey, error) {
+	keys := []domain.APIKey{}
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+	cursor, err := m.collection.Find(context.Background(), bson.M{}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	if err = cursor.All(context.Background(), &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RevokeKey only matches keys that are still live, so revoking twice returns mongo.ErrNoDocuments.
+func (m *MongoAPIKeyRepository) RevokeKey(id, revokedBy string, at time.Time) (domain.APIKey, error) {
+	var key domain.APIKey
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+	filter := bson.M{"_id": objID, "revoked_at": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"revoked_at": at, "revoked_by": revokedBy}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = m.collection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&key)
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+	return key, nil
+}
+
+func (m *MongoAPIKeyRepository) TouchKey(id primitive.ObjectID, at time.Time) error {
+	_, err := m.collection.UpdateOne(context.Background(), bson.M{"_id": id}, bson.M{"$set": bson.M{"last_used_at": at}})
+	return err
+}
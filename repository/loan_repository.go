@@ -2,13 +2,20 @@ package repository
 
 import (
 	"context"
+	"encoding/base64"
 	"loan-tracker-api/domain"
+	"regexp"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// liveLoan matches loans that haven't been soft-deleted
+var liveLoan = bson.M{"$exists": false}
+
 type MongoLoanRepository struct {
 	collection *mongo.Collection
 }
@@ -39,41 +46,374 @@ func (m *MongoLoanRepository) GetLoanByID(id string) (domain.Loan, error) {
 	if err != nil {
 		return domain.Loan{}, err
 	}
-	err = m.collection.FindOne(context.Background(),bson.M{"_id":objID}).Decode(&loan)
+	err = m.collection.FindOne(context.Background(),bson.M{"_id":objID, "deleted_at": liveLoan}).Decode(&loan)
 	if err != nil {
 		return domain.Loan{}, err
 	}
 	return loan, nil
 }
 
-func (m *MongoLoanRepository) GetLoans() ([]domain.Loan, error) {
-	var loans []domain.Loan
-	cursor, err := m.collection.Find(context.Background(), bson.M{})
+// SearchLoans returns one page of loans matching the filter. Pages are addressed either by
+// page number or, for deep listings, by the opaque cursor returned with the previous page.
+func (m *MongoLoanRepository) SearchLoans(filter domain.LoanFilter) (domain.LoanPage, error) {
+	loans := []domain.Loan{}
+
+	query := bson.M{"deleted_at": liveLoan}
+	if filter.Deleted {
+		query["deleted_at"] = bson.M{"$exists": true}
+	}
+	if filter.BorrowerID != "" {
+		query["borrowerid"] = filter.BorrowerID
+	}
+	if filter.BorrowerName != "" {
+		query["borrowername"] = bson.M{"$regex": regexp.QuoteMeta(filter.BorrowerName), "$options": "i"}
+	}
+	if filter.Search != "" {
+		query["title"] = bson.M{"$regex": regexp.QuoteMeta(filter.Search), "$options": "i"}
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+
+	amount := bson.M{}
+	if filter.MinAmount > 0 {
+		amount["$gte"] = filter.MinAmount
+	}
+	if filter.MaxAmount > 0 {
+		amount["$lte"] = filter.MaxAmount
+	}
+	if len(amount) > 0 {
+		query["amount"] = amount
+	}
+
+	createdAt := bson.M{}
+	if !filter.CreatedFrom.IsZero() {
+		createdAt["$gte"] = primitive.Timestamp{T: uint32(filter.CreatedFrom.Unix())}
+	}
+	if !filter.CreatedTo.IsZero() {
+		createdAt["$lte"] = primitive.Timestamp{T: uint32(filter.CreatedTo.Unix())}
+	}
+	if len(createdAt) > 0 {
+		query["createdAt"] = createdAt
+	}
+
+	total, err := m.collection.CountDocuments(context.Background(), query)
 	if err != nil {
-		return nil, err
+		return domain.LoanPage{}, err
+	}
+
+	sortField, ok := domain.LoanSortFields[filter.SortBy]
+	if !ok {
+		sortField = "createdAt"
+	}
+	sortOrder := -1
+	if filter.SortOrder == "asc" {
+		sortOrder = 1
+	}
+
+	// _id breaks ties so pages stay stable when many loans share the same sort value
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: sortField, Value: sortOrder}, {Key: "_id", Value: sortOrder}})
+	// one extra document tells us whether there is a next page
+	findOptions.SetLimit(int64(filter.Limit + 1))
+
+	if filter.Cursor != "" {
+		after, err := decodeLoanCursor(filter.Cursor, sortField, sortOrder)
+		if err != nil {
+			return domain.LoanPage{}, err
+		}
+		query["$and"] = bson.A{after}
+	} else {
+		findOptions.SetSkip(int64((filter.Page - 1) * filter.Limit))
+	}
+
+	cursor, err := m.collection.Find(context.Background(), query, findOptions)
+	if err != nil {
+		return domain.LoanPage{}, err
 	}
 	defer cursor.Close(context.Background())
-	for cursor.Next(context.Background()) {
-		var loan domain.Loan
-		cursor.Decode(&loan)
-		loans = append(loans, loan)
+
+	if err = cursor.All(context.Background(), &loans); err != nil {
+		return domain.LoanPage{}, err
 	}
-	return loans, nil
+
+	page := domain.LoanPage{Loans: loans, Total: total}
+	if len(loans) > filter.Limit {
+		page.Loans = loans[:filter.Limit]
+		page.NextCursor, err = encodeLoanCursor(page.Loans[filter.Limit-1], sortField, sortOrder)
+		if err != nil {
+			return domain.LoanPage{}, err
+		}
+	}
+	return page, nil
+}
+
+type loanCursor struct {
+	SortField string             `bson:"s"`
+	SortOrder int                `bson:"o"`
+	Value     bson.RawValue      `bson:"v"`
+	ID        primitive.ObjectID `bson:"id"`
+}
+
+func encodeLoanCursor(last domain.Loan, sortField string, sortOrder int) (string, error) {
+	var value interface{}
+	switch sortField {
+	case "amount":
+		value = last.Amount
+	case "title":
+		value = last.Title
+	case "status":
+		value = last.Status
+	default:
+		value = last.CreatedAt
+	}
+
+	raw, err := bson.Marshal(bson.M{"s": sortField, "o": sortOrder, "v": value, "id": last.ID})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// decodeLoanCursor turns a cursor back into a query matching everything after the loan it points at.
+func decodeLoanCursor(encoded, sortField string, sortOrder int) (bson.M, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, domain.ErrInvalidCursor
+	}
+
+	var c loanCursor
+	if err := bson.Unmarshal(raw, &c); err != nil {
+		return nil, domain.ErrInvalidCursor
+	}
+	if c.SortField != sortField || c.SortOrder != sortOrder {
+		return nil, domain.ErrInvalidCursor
+	}
+
+	op := "$lt"
+	if sortOrder == 1 {
+		op = "$gt"
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{sortField: bson.M{op: c.Value}},
+		bson.M{sortField: c.Value, "_id": bson.M{op: c.ID}},
+	}}, nil
+}
+
+// UpdateLoan rewrites the borrower editable fields of a loan, but only while it is still pending.
+func (m *MongoLoanRepository) UpdateLoan(loan domain.Loan, loanID string) (domain.Loan, error) {
+	var updatedLoan domain.Loan
+	objID, err := primitive.ObjectIDFromHex(loanID)
+	if err != nil {
+		return domain.Loan{}, err
+	}
+	update := bson.M{"$set": bson.M{
+		"title":               loan.Title,
+		"description":         loan.Description,
+		"amount":              loan.Amount,
+		"term_months":         loan.TermMonths,
+		"repayment_frequency": loan.RepaymentFrequency,
+		"updatedAt":           loan.UpdatedAt,
+	}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = m.collection.FindOneAndUpdate(context.Background(), bson.M{"_id": objID, "status": domain.LoanPending}, update, opts).Decode(&updatedLoan)
+	if err != nil {
+		return domain.Loan{}, err
+	}
+	return updatedLoan, nil
+}
+
+// UpdateLoanStatus moves the loan from change.From to change.To and appends the change to its history.
+// The update only matches while the loan is still in change.From, so two concurrent transitions can't both win.
+func (m *MongoLoanRepository) UpdateLoanStatus(ctx context.Context, loanID string, change domain.LoanStatusChange) (domain.Loan, error) {
+	var loan domain.Loan
+	objID, err := primitive.ObjectIDFromHex(loanID)
+	if err != nil {
+		return domain.Loan{}, err
+	}
+	filter := bson.M{"_id": objID, "status": change.From}
+	set := bson.M{"status": change.To}
+	if change.To == domain.LoanCancelled {
+		set["cancellation_reason"] = change.Reason
+	}
+	update := bson.M{"$set": set, "$push": bson.M{"status_history": change}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = m.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&loan)
+	if err != nil {
+		return domain.Loan{}, err
+	}
+	return loan, nil
+}
+
+func (m *MongoLoanRepository) UpdateLoanSchedule(ctx context.Context, loanID string, interestRate float64, schedule []domain.Installment, outstanding domain.LoanBalance) (domain.Loan, error) {
+	var loan domain.Loan
+	objID, err := primitive.ObjectIDFromHex(loanID)
+	if err != nil {
+		return domain.Loan{}, err
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = m.collection.FindOneAndUpdate(ctx, bson.M{"_id": objID}, bson.M{"$set": bson.M{"interest_rate": interestRate, "schedule": schedule, "outstanding": outstanding}}, opts).Decode(&loan)
+	if err != nil {
+		return domain.Loan{}, err
+	}
+	return loan, nil
+}
+
+// balanceTolerance absorbs float rounding when checking that a decrease leaves no part of the balance negative
+const balanceTolerance = 0.005
+
+// AdjustLoanBalance atomically adds delta to the outstanding balance so concurrent payments don't
+// overwrite each other. The check that a decrease is covered is part of the filter, so two payments
+// can't both pass it against the same balance.
+func (m *MongoLoanRepository) AdjustLoanBalance(ctx context.Context, loanID string, delta domain.LoanBalance) (domain.Loan, error) {
+	var loan domain.Loan
+	objID, err := primitive.ObjectIDFromHex(loanID)
+	if err != nil {
+		return domain.Loan{}, err
+	}
+	changes := map[string]float64{
+		"outstanding.fees":      delta.Fees,
+		"outstanding.interest":  delta.Interest,
+		"outstanding.principal": delta.Principal,
+	}
+	filter := bson.M{"_id": objID}
+	for field, amount := range changes {
+		if amount < 0 {
+			filter[field] = bson.M{"$gte": -amount - balanceTolerance}
+		}
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = m.collection.FindOneAndUpdate(ctx, filter, bson.M{"$inc": changes}, opts).Decode(&loan)
+	if err != nil {
+		return domain.Loan{}, err
+	}
+	return loan, nil
+}
+
+func (m *MongoLoanRepository) MarkOverdueNotified(ctx context.Context, loanID string, at time.Time) error {
+	objID, err := primitive.ObjectIDFromHex(loanID)
+	if err != nil {
+		return err
+	}
+	_, err = m.collection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$set": bson.M{"overdue_notified_at": at}})
+	return err
 }
 
-func (m *MongoLoanRepository) UpdateLoanStatus(newStatus, loanID string) (domain.Loan, error) {
+func (m *MongoLoanRepository) AssessLateFees(ctx context.Context, loanID string, previousThrough, through time.Time, fees float64) (domain.Loan, error) {
 	var loan domain.Loan
 	objID, err := primitive.ObjectIDFromHex(loanID)
 	if err != nil {
 		return domain.Loan{}, err
 	}
-	err = m.collection.FindOneAndUpdate(context.Background(), bson.M{"_id": objID}, bson.M{"$set": bson.M{"status": newStatus}}).Decode(&loan)
+	filter := bson.M{"_id": objID, "late_fees_assessed_through": previousThrough}
+	if previousThrough.IsZero() {
+		// the field is omitted until the first fee
+		filter["late_fees_assessed_through"] = nil
+	}
+	update := bson.M{
+		"$inc": bson.M{"outstanding.fees": fees},
+		"$set": bson.M{"late_fees_assessed_through": through},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = m.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&loan)
+	if err != nil {
+		return domain.Loan{}, err
+	}
+	return loan, nil
+}
+
+func (m *MongoLoanRepository) SoftDeleteLoan(id, deletedBy string, at time.Time) (domain.Loan, error) {
+	var loan domain.Loan
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return domain.Loan{}, err
+	}
+	update := bson.M{"$set": bson.M{"deleted_at": at, "deleted_by": deletedBy}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = m.collection.FindOneAndUpdate(context.Background(), bson.M{"_id": objID, "deleted_at": liveLoan}, update, opts).Decode(&loan)
 	if err != nil {
 		return domain.Loan{}, err
 	}
 	return loan, nil
 }
 
+func (m *MongoLoanRepository) RestoreLoan(id string) (domain.Loan, error) {
+	var loan domain.Loan
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return domain.Loan{}, err
+	}
+	update := bson.M{"$unset": bson.M{"deleted_at": "", "deleted_by": ""}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = m.collection.FindOneAndUpdate(context.Background(), bson.M{"_id": objID, "deleted_at": bson.M{"$exists": true}}, update, opts).Decode(&loan)
+	if err != nil {
+		return domain.Loan{}, err
+	}
+	return loan, nil
+}
+
+// CountActiveLoans counts the borrower's loans in an active status, soft-deleted ones included.
+func (m *MongoLoanRepository) CountActiveLoans(borrowerID string) (int64, error) {
+	return m.collection.CountDocuments(context.Background(), bson.M{"borrowerid": borrowerID, "status": bson.M{"$in": domain.ActiveLoanStatuses}})
+}
+
+func (m *MongoLoanRepository) CancelOpenLoans(ctx context.Context, borrowerID string, change domain.LoanStatusChange) (int64, error) {
+	filter := bson.M{"borrowerid": borrowerID, "status": bson.M{"$in": bson.A{domain.LoanPending, domain.LoanUnderReview}}}
+	entry := bson.M{
+		"from":      "$status",
+		"to":        domain.LoanCancelled,
+		"actor_id":  bson.M{"$literal": change.ActorID},
+		"reason":    bson.M{"$literal": change.Reason},
+		"timestamp": change.Timestamp,
+	}
+	// a pipeline, so each history entry records the status that loan was actually in
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"status":              domain.LoanCancelled,
+		"cancellation_reason": bson.M{"$literal": change.Reason},
+		"status_history":      bson.M{"$concatArrays": bson.A{bson.M{"$ifNull": bson.A{"$status_history", bson.A{}}}, bson.A{entry}}},
+	}}}}
+	result, err := m.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// GetLoansDeletedBefore returns up to limit loans soft-deleted before cutoff that aren't active, oldest first.
+func (m *MongoLoanRepository) GetLoansDeletedBefore(cutoff time.Time, limit int) ([]domain.Loan, error) {
+	loans := []domain.Loan{}
+	filter := bson.M{"deleted_at": bson.M{"$lt": cutoff}, "status": bson.M{"$nin": domain.ActiveLoanStatuses}}
+	findOptions := options.Find().SetSort(bson.M{"deleted_at": 1}).SetLimit(int64(limit))
+	cursor, err := m.collection.Find(context.Background(), filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	if err = cursor.All(context.Background(), &loans); err != nil {
+		return nil, err
+	}
+	return loans, nil
+}
+
+func (m *MongoLoanRepository) GetBorrowerLoanIDs(borrowerID string) ([]string, error) {
+	findOptions := options.Find().SetProjection(bson.M{"_id": 1})
+	cursor, err := m.collection.Find(context.Background(), bson.M{"borrowerid": borrowerID}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	ids := []string{}
+	for cursor.Next(context.Background()) {
+		var loan domain.Loan
+		if err := cursor.Decode(&loan); err != nil {
+			return nil, err
+		}
+		ids = append(ids, loan.ID.Hex())
+	}
+	return ids, cursor.Err()
+}
 
 func (m *MongoLoanRepository) DeleteLoan(id string) (domain.Loan, error) {
 	var loan domain.Loan
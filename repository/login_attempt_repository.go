@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"loan-tracker-api/domain"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LoginAttemptRepositoryImpl struct {
+	collection *mongo.Collection
+}
+
+func NewLoginAttemptRepositoryImpl(coll *mongo.Collection) domain.LoginAttemptRepository {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// counters clean themselves up once their window and any lockout have passed
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"expires_at": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Printf("Error creating TTL index on login attempts: %v", err)
+	}
+
+	return &LoginAttemptRepositoryImpl{collection: coll}
+}
+
+func (lr *LoginAttemptRepositoryImpl) GetLoginAttempt(key string) (domain.LoginAttempt, error) {
+	var attempt domain.LoginAttempt
+	err := lr.collection.FindOne(context.Background(), bson.M{"_id": key}).Decode(&attempt)
+	if err == mongo.ErrNoDocuments {
+		return domain.LoginAttempt{Key: key}, nil
+	}
+	if err != nil {
+		return domain.LoginAttempt{}, err
+	}
+	return attempt, nil
+}
+
+// RecordFailure runs as an update pipeline so concurrent failures each see the count the previous
+// one left; reading the counter and writing it back would let parallel guesses overwrite each other.
+func (lr *LoginAttemptRepositoryImpl) RecordFailure(key string, now time.Time, threshold int, window, lockout time.Duration) (domain.LoginAttempt, error) {
+	fresh := bson.M{"$not": bson.A{bson.M{"$gt": bson.A{"$expires_at", now}}}}
+	lockNow := bson.M{"$and": bson.A{
+		bson.M{"$gte": bson.A{"$failures", threshold}},
+		bson.M{"$not": bson.A{bson.M{"$gt": bson.A{"$locked_until", now}}}},
+	}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"failures":     bson.M{"$cond": bson.A{fresh, 1, bson.M{"$add": bson.A{"$failures", 1}}}},
+			"locked_until": bson.M{"$cond": bson.A{fresh, time.Time{}, bson.M{"$ifNull": bson.A{"$locked_until", time.Time{}}}}},
+			"last_failure": now,
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"locked_until": bson.M{"$cond": bson.A{lockNow, now.Add(lockout), "$locked_until"}},
+			"failures":     bson.M{"$cond": bson.A{lockNow, 0, "$failures"}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"expires_at": bson.M{"$max": bson.A{now.Add(window), "$locked_until"}},
+		}}},
+	}
+
+	var attempt domain.LoginAttempt
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := lr.collection.FindOneAndUpdate(context.Background(), bson.M{"_id": key}, pipeline, opts).Decode(&attempt)
+	if err != nil {
+		return domain.LoginAttempt{}, err
+	}
+	return attempt, nil
+}
+
+func (lr *LoginAttemptRepositoryImpl) DeleteLoginAttempt(key string) error {
+	_, err := lr.collection.DeleteOne(context.Background(), bson.M{"_id": key})
+	return err
+}
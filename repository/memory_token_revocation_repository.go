@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"loan-tracker-api/domain"
+	"sync"
+	"time"
+)
+
+// MemoryTokenRevocationStore keeps revocations in process memory. It is meant for
+// development and single instance deployments; entries are lost on restart.
+type MemoryTokenRevocationStore struct {
+	mu      sync.Mutex
+	userTTL time.Duration
+	tokens  map[string]time.Time
+	users   map[string]userRevocation
+}
+
+type userRevocation struct {
+	issuedBefore time.Time
+	expiresAt    time.Time
+}
+
+func NewMemoryTokenRevocationStore(userTTL time.Duration) domain.TokenRevocationStore {
+	return &MemoryTokenRevocationStore{
+		userTTL: userTTL,
+		tokens:  map[string]time.Time{},
+		users:   map[string]userRevocation{},
+	}
+}
+
+func (m *MemoryTokenRevocationStore) RevokeToken(tokenID string, expiresAt time.Time) error {
+	if tokenID == "" {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.purgeExpired()
+	m.tokens[tokenID] = expiresAt
+	return nil
+}
+
+func (m *MemoryTokenRevocationStore) RevokeUserTokens(userID string, issuedBefore time.Time) error {
+	issuedBefore = issuedBefore.Truncate(time.Second)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.purgeExpired()
+	if existing, ok := m.users[userID]; ok && existing.issuedBefore.After(issuedBefore) {
+		return nil
+	}
+	m.users[userID] = userRevocation{issuedBefore: issuedBefore, expiresAt: issuedBefore.Add(m.userTTL)}
+	return nil
+}
+
+func (m *MemoryTokenRevocationStore) IsRevoked(tokenID, userID string, issuedAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if expiresAt, ok := m.tokens[tokenID]; ok && tokenID != "" && expiresAt.After(now) {
+		return true, nil
+	}
+	if revocation, ok := m.users[userID]; ok && revocation.expiresAt.After(now) && issuedAt.Before(revocation.issuedBefore) {
+		return true, nil
+	}
+	return false, nil
+}
+
+// purgeExpired drops entries whose tokens have expired on their own. Callers must hold mu.
+func (m *MemoryTokenRevocationStore) purgeExpired() {
+	now := time.Now()
+	for id, expiresAt := range m.tokens {
+		if !expiresAt.After(now) {
+			delete(m.tokens, id)
+		}
+	}
+	for id, revocation := range m.users {
+		if !revocation.expiresAt.After(now) {
+			delete(m.users, id)
+		}
+	}
+}
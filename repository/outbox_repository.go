@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"loan-tracker-api/domain"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// delivered messages are kept for a week so admins can still see what went out; their bodies,
+// which may hold single-use links, are dropped as soon as they are sent
+const sentOutboxRetention = 7 * 24 * time.Hour
+
+type MongoOutboxRepository struct {
+	collection *mongo.Collection
+}
+
+func NewOutboxRepositoryImpl(coll *mongo.Collection) domain.OutboxRepository {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// only sent messages have sent_at, so pending and dead ones never expire
+	_, err := coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{Keys: bson.M{"sent_at": 1}, Options: options.Index().SetExpireAfterSeconds(int32(sentOutboxRetention.Seconds()))},
+	})
+	if err != nil {
+		log.Printf("Error creating indexes on outbox: %v", err)
+	}
+
+	return &MongoOutboxRepository{collection: coll}
+}
+
+func (m *MongoOutboxRepository) Enqueue(ctx context.Context, message domain.OutboxMessage) (domain.OutboxMessage, error) {
+	result, err := m.collection.InsertOne(ctx, message)
+	if err != nil {
+		return domain.OutboxMessage{}, err
+	}
+	message.ID = result.InsertedID.(primitive.ObjectID)
+	return message, nil
+}
+
+func (m *MongoOutboxRepository) ClaimNext(now time.Time, lease time.Duration) (domain.OutboxMessage, error) {
+	var message domain.OutboxMessage
+	filter := bson.M{"$or": bson.A{
+		bson.M{"status": domain.OutboxPending, "next_attempt_at": bson.M{"$lte": now}},
+		// a worker that died mid-send leaves the message processing until its lease runs out
+		bson.M{"status": domain.OutboxProcessing, "locked_until": bson.M{"$lte": now}},
+	}}
+	update := bson.M{
+		"$set": bson.M{"status": domain.OutboxProcessing, "locked_until": now.Add(lease), "updated_at": now},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().SetSort(bson.M{"next_attempt_at": 1}).SetReturnDocument(options.After)
+	err := m.collection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&message)
+	if err != nil {
+		return domain.OutboxMessage{}, err
+	}
+	return message, nil
+}
+
+func (m *MongoOutboxRepository) MarkSent(message domain.OutboxMessage, at time.Time) error {
+	update := bson.M{
+		"$set":   bson.M{"status": domain.OutboxSent, "sent_at": at, "updated_at": at},
+		"$unset": bson.M{"locked_until": "", "last_error": "", "email.html_body": "", "email.text_body": ""},
+	}
+	return m.updateClaimed(message, update)
+}
+
+func (m *MongoOutboxRepository) MarkFailed(message domain.OutboxMessage, status, lastError string, nextAttemptAt time.Time) error {
+	update := bson.M{
+		"$set":   bson.M{"status": status, "last_error": lastError, "next_attempt_at": nextAttemptAt, "updated_at": time.Now()},
+		"$unset": bson.M{"locked_until": ""},
+	}
+	return m.updateClaimed(message, update)
+}
+
+// updateClaimed applies update only while the message is still held under the lease it was
+// claimed with; a worker whose lease ran out must not overwrite the state of the one that took over.
+func (m *MongoOutboxRepository) updateClaimed(message domain.OutboxMessage, update bson.M) error {
+	filter := bson.M{"_id": message.ID, "status": domain.OutboxProcessing, "locked_until": message.LockedUntil}
+	result, err := m.collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (m *MongoOutboxRepository) GetMessages(status string, page, limit int) ([]domain.OutboxMessage, int64, error) {
+	messages := []domain.OutboxMessage{}
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	total, err := m.collection.CountDocuments(context.Background(), filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+	findOptions.SetSkip(int64((page - 1) * limit))
+	findOptions.SetLimit(int64(limit))
+
+	cursor, err := m.collection.Find(context.Background(), filter, findOptions)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(context.Background())
+
+	if err = cursor.All(context.Background(), &messages); err != nil {
+		return nil, 0, err
+	}
+	return messages, total, nil
+}
+
+func (m *MongoOutboxRepository) GetMessageByID(id string) (domain.OutboxMessage, error) {
+	var message domain.OutboxMessage
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return domain.OutboxMessage{}, err
+	}
+	err = m.collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&message)
+	if err != nil {
+		return domain.OutboxMessage{}, err
+	}
+	return message, nil
+}
+
+func (m *MongoOutboxRepository) Redrive(id string, now time.Time) (domain.OutboxMessage, error) {
+	var message domain.OutboxMessage
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return domain.OutboxMessage{}, err
+	}
+	update := bson.M{"$set": bson.M{
+		"status":          domain.OutboxPending,
+		"attempts":        0,
+		"next_attempt_at": now,
+		"updated_at":      now,
+	}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = m.collection.FindOneAndUpdate(context.Background(), bson.M{"_id": objID, "status": domain.OutboxDead}, update, opts).Decode(&message)
+	if err != nil {
+		return domain.OutboxMessage{}, err
+	}
+	return message, nil
+}
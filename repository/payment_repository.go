@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"loan-tracker-api/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoPaymentRepository struct {
+	collection *mongo.Collection
+}
+
+func NewPaymentRepositoryImpl(paymentCollection *mongo.Collection) domain.PaymentRepository {
+	return &MongoPaymentRepository{
+		collection: paymentCollection,
+	}
+}
+
+func (m *MongoPaymentRepository) CreatePayment(ctx context.Context, payment domain.Payment) (domain.Payment, error) {
+	if payment.ID.IsZero() {
+		payment.ID = primitive.NewObjectID()
+	}
+	_, err := m.collection.InsertOne(ctx, payment)
+	if err != nil {
+		return domain.Payment{}, err
+	}
+	return payment, nil
+}
+
+func (m *MongoPaymentRepository) GetPaymentByID(id string) (domain.Payment, error) {
+	var payment domain.Payment
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return domain.Payment{}, err
+	}
+	err = m.collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&payment)
+	if err != nil {
+		return domain.Payment{}, err
+	}
+	return payment, nil
+}
+
+func (m *MongoPaymentRepository) GetPaymentsByLoanID(loanID string) ([]domain.Payment, error) {
+	payments := []domain.Payment{}
+	findOptions := options.Find().SetSort(bson.M{"created_at": 1})
+	cursor, err := m.collection.Find(context.Background(), bson.M{"loan_id": loanID}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	if err = cursor.All(context.Background(), &payments); err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+// MarkPaymentReversed links a payment to its reversal. It only matches payments that
+// have not been reversed yet, so the same payment cannot be reversed twice.
+func (m *MongoPaymentRepository) MarkPaymentReversed(ctx context.Context, paymentID, reversalID string) error {
+	objID, err := primitive.ObjectIDFromHex(paymentID)
+	if err != nil {
+		return err
+	}
+	filter := bson.M{"_id": objID, "type": domain.PaymentEntry, "reversed_by": bson.M{"$exists": false}}
+	result, err := m.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"reversed_by": reversalID}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (m *MongoPaymentRepository) DeletePaymentsByLoanID(loanID string) error {
+	_, err := m.collection.DeleteMany(context.Background(), bson.M{"loan_id": loanID})
+	return err
+}
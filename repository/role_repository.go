@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"loan-tracker-api/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoRoleRepository struct {
+	collection *mongo.Collection
+}
+
+func NewRoleRepositoryImpl(coll *mongo.Collection) domain.RoleRepository {
+	return &MongoRoleRepository{collection: coll}
+}
+
+func (m *MongoRoleRepository) CreateRole(role domain.RoleDefinition) (domain.RoleDefinition, error) {
+	_, err := m.collection.InsertOne(context.Background(), role)
+	if err != nil {
+		return domain.RoleDefinition{}, err
+	}
+	return role, nil
+}
+
+func (m *MongoRoleRepository) UpdateRole(role domain.RoleDefinition) (domain.RoleDefinition, error) {
+	var updated domain.RoleDefinition
+	update := bson.M{"$set": bson.M{
+		"description": role.Description,
+		"permissions": role.Permissions,
+		"updated_at":  role.UpdatedAt,
+	}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := m.collection.FindOneAndUpdate(context.Background(), bson.M{"_id": role.Name}, update, opts).Decode(&updated)
+	if err != nil {
+		return domain.RoleDefinition{}, err
+	}
+	return updated, nil
+}
+
+func (m *MongoRoleRepository) DeleteRole(ctx context.Context, name string) error {
+	result, err := m.collection.DeleteOne(ctx, bson.M{"_id": name, "built_in": false})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (m *MongoRoleRepository) LockRole(ctx context.Context, name string) error {
+	result, err := m.collection.UpdateOne(ctx, bson.M{"_id": name}, bson.M{"$inc": bson.M{"lock_version": 1}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (m *MongoRoleRepository) GetRole(name string) (domain.RoleDefinition, error) {
+	var role domain.RoleDefinition
+	err := m.collection.FindOne(context.Background(), bson.M{"_id": name}).Decode(&role)
+	if err != nil {
+		return domain.RoleDefinition{}, err
+	}
+	return role, nil
+}
+
+func (m *MongoRoleRepository) GetRoles() ([]domain.RoleDefinition, error) {
+	roles := []domain.RoleDefinition{}
+	cursor, err := m.collection.Find(context.Background(), bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	if err = cursor.All(context.Background(), &roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (m *MongoRoleRepository) SeedRole(role domain.RoleDefinition) error {
+	_, err := m.collection.UpdateOne(context.Background(), bson.M{"_id": role.Name}, bson.M{"$setOnInsert": role}, options.Update().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"loan-tracker-api/domain"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoTokenRevocationStore struct {
+	collection *mongo.Collection
+	userTTL    time.Duration
+}
+
+// NewMongoTokenRevocationStore returns a store whose entries are removed by a TTL index once
+// the tokens they cover have expired anyway. userTTL is how long a user-wide revocation is kept,
+// which must be at least the access token lifetime.
+func NewMongoTokenRevocationStore(coll *mongo.Collection, userTTL time.Duration) domain.TokenRevocationStore {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"expires_at": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Printf("Error creating TTL index on revoked tokens: %v", err)
+	}
+
+	return &MongoTokenRevocationStore{collection: coll, userTTL: userTTL}
+}
+
+func (m *MongoTokenRevocationStore) RevokeToken(tokenID string, expiresAt time.Time) error {
+	if tokenID == "" {
+		return nil
+	}
+	_, err := m.collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": "jti:" + tokenID},
+		bson.M{"$set": bson.M{"expires_at": expiresAt}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (m *MongoTokenRevocationStore) RevokeUserTokens(userID string, issuedBefore time.Time) error {
+	// JWT iat has second precision, so the cut-off is truncated to match it
+	issuedBefore = issuedBefore.Truncate(time.Second)
+	_, err := m.collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": "user:" + userID},
+		bson.M{
+			"$max": bson.M{"issued_before": issuedBefore},
+			"$set": bson.M{"expires_at": issuedBefore.Add(m.userTTL)},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (m *MongoTokenRevocationStore) IsRevoked(tokenID, userID string, issuedAt time.Time) (bool, error) {
+	ids := bson.A{"user:" + userID}
+	if tokenID != "" {
+		ids = append(ids, "jti:"+tokenID)
+	}
+
+	cursor, err := m.collection.Find(context.Background(), bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return false, err
+	}
+	defer cursor.Close(context.Background())
+
+	var entries []struct {
+		ID           string    `bson:"_id"`
+		IssuedBefore time.Time `bson:"issued_before"`
+		ExpiresAt    time.Time `bson:"expires_at"`
+	}
+	if err = cursor.All(context.Background(), &entries); err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	for _, entry := range entries {
+		// the TTL monitor only runs once a minute, so expired entries may still be around
+		if entry.ExpiresAt.Before(now) {
+			continue
+		}
+		if entry.ID != "user:"+userID || issuedAt.Before(entry.IssuedBefore) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+	"loan-tracker-api/domain"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MongoTransactor needs MongoDB to run as a replica set (a single-node one is enough), since
+// standalone servers don't support transactions.
+type MongoTransactor struct {
+	client *mongo.Client
+}
+
+func NewTransactor(client *mongo.Client) domain.Transactor {
+	return &MongoTransactor{client: client}
+}
+
+func (t *MongoTransactor) WithTransaction(fn func(ctx context.Context) error) error {
+	session, err := t.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(context.Background())
+
+	_, err = session.WithTransaction(context.Background(), func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"loan-tracker-api/domain"
 	"strconv"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -11,6 +12,9 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// liveUser matches users that haven't been soft-deleted
+var liveUser = bson.M{"$exists": false}
+
 type UserRepositoryImpl struct {
 	collection *mongo.Collection
 }
@@ -20,8 +24,8 @@ func NewUserRepositoryImpl(coll *mongo.Collection) domain.UserRepository {
 }
 
 
-func (u *UserRepositoryImpl) Register(user domain.User) error{
-	_, err := u.collection.InsertOne(context.Background(), user)
+func (u *UserRepositoryImpl) Register(ctx context.Context, user domain.User) error{
+	_, err := u.collection.InsertOne(ctx, user)
 	if err != nil {
 		return err
 	}
@@ -33,7 +37,7 @@ func (u *UserRepositoryImpl) Register(user domain.User) error{
 
 func (u *UserRepositoryImpl) GetUserByUsernameOrEmail(username, email string) (domain.User, error) {
 	var user domain.User
-	err := u.collection.FindOne(context.Background(), map[string]string{"username": username, "email": email}).Decode(&user)
+	err := u.collection.FindOne(context.Background(), bson.M{"username": username, "email": email, "deleted_at": liveUser}).Decode(&user)
 	if err != nil {
 		return domain.User{}, err
 	}
@@ -42,13 +46,16 @@ func (u *UserRepositoryImpl) GetUserByUsernameOrEmail(username, email string) (d
 }
 
 
-func (u *UserRepositoryImpl) AccountActivation(email string) error {
+func (u *UserRepositoryImpl) AccountActivation(email, tokenHash string) error {
 	
 	
-	_, err := u.collection.UpdateOne(context.Background(), bson.M{"email": email}, bson.M{"$set": bson.M{"is_active": true}, "$unset": bson.M{"activation_token": ""}, "$currentDate": bson.M{"updated_at": true}})
+	result, err := u.collection.UpdateOne(context.Background(), bson.M{"email": email, "activation_token": tokenHash, "deleted_at": liveUser}, bson.M{"$set": bson.M{"is_active": true}, "$unset": bson.M{"activation_token": ""}, "$currentDate": bson.M{"updated_at": true}})
 	if err != nil {
 		return err
 	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
 
 
 	return nil
@@ -57,7 +64,7 @@ func (u *UserRepositoryImpl) AccountActivation(email string) error {
 
 func (u *UserRepositoryImpl) GetUserByEmail(email string) (domain.User, error) {
 	var user domain.User
-	err := u.collection.FindOne(context.Background(), map[string]string{"email": email}).Decode(&user)
+	err := u.collection.FindOne(context.Background(), bson.M{"email": email, "deleted_at": liveUser}).Decode(&user)
 	if err != nil {
 		return domain.User{}, err
 	}
@@ -65,19 +72,48 @@ func (u *UserRepositoryImpl) GetUserByEmail(email string) (domain.User, error) {
 	return user, nil
 }
 
-func (u *UserRepositoryImpl) UpdateUser(user *domain.User) error {
-	_, err := u.collection.UpdateOne(context.Background(), bson.M{"email": user.Email}, bson.M{"$set": user})
+func (u *UserRepositoryImpl) GetUserByUsername(username string) (domain.User, error) {
+	var user domain.User
+	err := u.collection.FindOne(context.Background(), bson.M{"username": username, "deleted_at": liveUser}).Decode(&user)
 	if err != nil {
-		return err
+		return domain.User{}, err
 	}
 
+	return user, nil
+}
+
+func (u *UserRepositoryImpl) GetUserByGoogleID(googleID string) (domain.User, error) {
+	var user domain.User
+	err := u.collection.FindOne(context.Background(), bson.M{"google_id": googleID, "deleted_at": liveUser}).Decode(&user)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	return user, nil
+}
+
+// UpdateUser only sets the fields named in change, never the whole document. Sessions in
+// particular are only changed by the refresh token methods, which update them atomically.
+func (u *UserRepositoryImpl) UpdateUser(ctx context.Context, userID primitive.ObjectID, change domain.UserChange) error {
+	filter := bson.M{"_id": userID, "deleted_at": liveUser}
+	for field, value := range change.Where {
+		filter[field] = value
+	}
+
+	result, err := u.collection.UpdateOne(ctx, filter, bson.M{"$set": change.Set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
 	return nil
 }
 
 
 func (ur *UserRepositoryImpl) Login(user *domain.User) (*domain.User, error) {
 	var existingUser domain.User
-	err := ur.collection.FindOne(context.Background(), map[string]string{"email": user.Email}).Decode(&existingUser)
+	err := ur.collection.FindOne(context.Background(), bson.M{"email": user.Email, "deleted_at": liveUser}).Decode(&existingUser)
 	if err != nil {
 		return &domain.User{}, err
 	}
@@ -95,7 +131,7 @@ func (ur *UserRepositoryImpl) GetUserByID(id string) (domain.User, error) {
 		return domain.User{}, err
 	}
 
-	err = ur.collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&user)
+	err = ur.collection.FindOne(context.Background(), bson.M{"_id": objID, "deleted_at": liveUser}).Decode(&user)
 	if err != nil {
 		return domain.User{}, err
 	}
@@ -104,22 +140,87 @@ func (ur *UserRepositoryImpl) GetUserByID(id string) (domain.User, error) {
 
 
 
-func (ur *UserRepositoryImpl) DeleteRefreshToken(user *domain.User, token string) error {
-	objID, err := primitive.ObjectIDFromHex(user.ID.Hex())
-    if err != nil {
-        return err
-    }
-    _, err = ur.collection.UpdateOne(
-        context.Background(),
-        bson.M{"_id": objID},
-        bson.M{"$pull": bson.M{"refresh_tokens": bson.M{"token": token}}},
-    )
-    return err
+// AddRefreshToken replaces the device's session with token in a single update, so concurrent
+// logins from other devices keep theirs.
+func (ur *UserRepositoryImpl) AddRefreshToken(userID primitive.ObjectID, token domain.RefreshToken) error {
+	others := bson.M{"$filter": bson.M{
+		"input": bson.M{"$ifNull": bson.A{"$refresh_tokens", bson.A{}}},
+		"cond":  bson.M{"$ne": bson.A{"$$this.device_id", token.DeviceID}},
+	}}
+	result, err := ur.collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": userID},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"refresh_tokens": bson.M{"$concatArrays": bson.A{others, bson.A{bson.M{"$literal": token}}}},
+		}}}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (ur *UserRepositoryImpl) DeleteRefreshToken(user *domain.User, tokenHash string) error {
+	result, err := ur.collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": user.ID, "refresh_tokens.token": tokenHash},
+		bson.M{"$pull": bson.M{"refresh_tokens": bson.M{"token": tokenHash}}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (ur *UserRepositoryImpl) RotateRefreshToken(userID primitive.ObjectID, oldTokenHash string, next domain.RefreshToken) error {
+	result, err := ur.collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": userID, "refresh_tokens.token": oldTokenHash},
+		bson.M{"$set": bson.M{"refresh_tokens.$": next}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (ur *UserRepositoryImpl) RevokeRefreshTokenFamily(userID primitive.ObjectID, familyID string) error {
+	_, err := ur.collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": userID},
+		bson.M{"$pull": bson.M{"refresh_tokens": bson.M{"family_id": familyID}}},
+	)
+	return err
+}
+
+
+func (ur *UserRepositoryImpl) DeleteRefreshTokenByDevice(user *domain.User, deviceID string) error {
+	result, err := ur.collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": user.ID, "refresh_tokens.device_id": deviceID},
+		bson.M{"$pull": bson.M{"refresh_tokens": bson.M{"device_id": deviceID}}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
 }
 
 
-func (ur *UserRepositoryImpl) DeleteAllRefreshTokens(user *domain.User) error {
-	_, err := ur.collection.UpdateOne(context.Background(), map[string]string{"username": user.Username}, bson.M{"$set": bson.M{"refresh_tokens": []domain.RefreshToken{}}})
+func (ur *UserRepositoryImpl) DeleteAllRefreshTokens(ctx context.Context, user *domain.User) error {
+	_, err := ur.collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"refresh_tokens": []domain.RefreshToken{}}})
 	return err
 }
 
@@ -132,22 +233,35 @@ func (ur *UserRepositoryImpl) GetMyProfile(userID string) (domain.User, error) {
 		return domain.User{}, err
 	}
 
-	err = ur.collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&user)
+	err = ur.collection.FindOne(context.Background(), bson.M{"_id": objID, "deleted_at": liveUser}).Decode(&user)
 	if err != nil {
 		return domain.User{}, err
 	}
 	return user, nil
 }
 
+func (ur *UserRepositoryImpl) CountUsersByRole(ctx context.Context, role string) (int64, error) {
+	return ur.collection.CountDocuments(ctx, bson.M{"role": role, "deleted_at": liveUser})
+}
+
 func (ur *UserRepositoryImpl) GetUsers(byName, limit, page string) ([]domain.User, error) {
-	var users []domain.User
 
 	// Build the query filter for name search if provided
-	filter := bson.M{}
+	filter := bson.M{"deleted_at": liveUser}
 	if byName != "" {
-		filter = bson.M{"username": bson.M{"$regex": byName, "$options": "i"}} // Case-insensitive search
+		filter["username"] = bson.M{"$regex": byName, "$options": "i"} // Case-insensitive search
 	}
 
+	return ur.findUsers(filter, limit, page)
+}
+
+func (ur *UserRepositoryImpl) GetDeletedUsers(limit, page string) ([]domain.User, error) {
+	return ur.findUsers(bson.M{"deleted_at": bson.M{"$exists": true}}, limit, page)
+}
+
+func (ur *UserRepositoryImpl) findUsers(filter bson.M, limit, page string) ([]domain.User, error) {
+	var users []domain.User
+
 	// Convert limit and page to int
 	limitInt, err := strconv.Atoi(limit)
 	if err != nil {
@@ -192,6 +306,69 @@ func (ur *UserRepositoryImpl) GetUsers(byName, limit, page string) ([]domain.Use
 
 
 
+// SoftDeleteUser marks the user deleted and drops their sessions; the record itself stays.
+func (ur *UserRepositoryImpl) SoftDeleteUser(ctx context.Context, id, deletedBy string, at time.Time) (domain.User, error) {
+	var user domain.User
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	update := bson.M{"$set": bson.M{"deleted_at": at, "deleted_by": deletedBy, "refresh_tokens": []domain.RefreshToken{}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = ur.collection.FindOneAndUpdate(ctx, bson.M{"_id": objID, "deleted_at": liveUser}, update, opts).Decode(&user)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return user, nil
+}
+
+func (ur *UserRepositoryImpl) GetDeletedUserByID(id string) (domain.User, error) {
+	var user domain.User
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	err = ur.collection.FindOne(context.Background(), bson.M{"_id": objID, "deleted_at": bson.M{"$exists": true}}).Decode(&user)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return user, nil
+}
+
+func (ur *UserRepositoryImpl) RestoreUser(id string) (domain.User, error) {
+	var user domain.User
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	update := bson.M{"$unset": bson.M{"deleted_at": "", "deleted_by": ""}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = ur.collection.FindOneAndUpdate(context.Background(), bson.M{"_id": objID, "deleted_at": bson.M{"$exists": true}}, update, opts).Decode(&user)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return user, nil
+}
+
+// GetUsersDeletedBefore pages through users soft-deleted before cutoff, oldest first.
+func (ur *UserRepositoryImpl) GetUsersDeletedBefore(cutoff time.Time, skip, limit int) ([]domain.User, error) {
+	users := []domain.User{}
+	findOptions := options.Find().SetSort(bson.D{{Key: "deleted_at", Value: 1}, {Key: "_id", Value: 1}}).SetSkip(int64(skip)).SetLimit(int64(limit))
+	cursor, err := ur.collection.Find(context.Background(), bson.M{"deleted_at": bson.M{"$lt": cutoff}}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	if err = cursor.All(context.Background(), &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 func (ur *UserRepositoryImpl) DeleteUser(id string) (domain.User, error) {
 	var user domain.User
 	objID, err := primitive.ObjectIDFromHex(id)
@@ -207,9 +384,74 @@ func (ur *UserRepositoryImpl) DeleteUser(id string) (domain.User, error) {
 }
 
 
-func (ur *UserRepositoryImpl) GetUserByResetToken(token string) (domain.User, error) {
+func (ur *UserRepositoryImpl) ConsumeEmailChangeToken(tokenHash string) (domain.User, error) {
+	var user domain.User
+	update := bson.M{"$set": bson.M{"email_change_token": ""}}
+	err := ur.collection.FindOneAndUpdate(context.Background(), bson.M{"email_change_token": tokenHash, "deleted_at": liveUser}, update).Decode(&user)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return user, nil
+}
+
+func (ur *UserRepositoryImpl) ConsumeTOTPStep(userID primitive.ObjectID, step int64) error {
+	filter := bson.M{"_id": userID, "two_factor_enabled": true, "last_totp_step": bson.M{"$lt": step}, "deleted_at": liveUser}
+	return ur.updateMatched(filter, bson.M{"$set": bson.M{"last_totp_step": step}})
+}
+
+func (ur *UserRepositoryImpl) ConsumeRecoveryCode(userID primitive.ObjectID, codeHash string) error {
+	filter := bson.M{"_id": userID, "two_factor_enabled": true, "recovery_codes": codeHash, "deleted_at": liveUser}
+	return ur.updateMatched(filter, bson.M{"$pull": bson.M{"recovery_codes": codeHash}})
+}
+
+// updateMatched applies update and reports mongo.ErrNoDocuments when filter matched nothing.
+func (ur *UserRepositoryImpl) updateMatched(filter, update bson.M) error {
+	result, err := ur.collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (ur *UserRepositoryImpl) ReissueActivationToken(ctx context.Context, email, tokenHash string, now time.Time, cooldown time.Duration, dailyLimit int) (domain.User, error) {
+	var user domain.User
+	windowStart := now.Add(-24 * time.Hour)
+	windowOver := bson.M{"$lte": bson.A{bson.M{"$ifNull": bson.A{"$activation_resend_window_start", time.Time{}}}, windowStart}}
+	filter := bson.M{
+		"email":            email,
+		"is_active":        false,
+		"deleted_at":       liveUser,
+		"token_created_at": bson.M{"$lt": now.Add(-cooldown)},
+		"$or": bson.A{
+			// $not also matches accounts that never had a window
+			bson.M{"activation_resend_window_start": bson.M{"$not": bson.M{"$gt": windowStart}}},
+			bson.M{"activation_resend_count": bson.M{"$lt": dailyLimit}},
+		},
+	}
+	// a window that is over starts again at now with a count of one, otherwise the count goes up by one
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"activation_token":               bson.M{"$literal": tokenHash},
+		"token_created_at":               now,
+		"activation_resend_window_start": bson.M{"$cond": bson.A{windowOver, now, "$activation_resend_window_start"}},
+		"activation_resend_count": bson.M{"$cond": bson.A{windowOver, 1, bson.M{
+			"$add": bson.A{bson.M{"$ifNull": bson.A{"$activation_resend_count", 0}}, 1},
+		}}},
+	}}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := ur.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&user)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return user, nil
+}
+
+func (ur *UserRepositoryImpl) ConsumePasswordResetToken(tokenHash string) (domain.User, error) {
 	var user domain.User
-	err := ur.collection.FindOne(context.Background(), bson.M{"password_reset_token": token}).Decode(&user)
+	update := bson.M{"$unset": bson.M{"password_reset_token": "", "password_reset_expires_at": ""}}
+	err := ur.collection.FindOneAndUpdate(context.Background(), bson.M{"password_reset_token": tokenHash, "deleted_at": liveUser}, update).Decode(&user)
 	if err != nil {
 		return domain.User{}, err
 	}
@@ -0,0 +1,598 @@
+package usecase
+
+import (
+	"context"
+	"loan-tracker-api/config"
+	"loan-tracker-api/domain"
+	"loan-tracker-api/infrastracture"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// detailLoanLimit caps how many of a user's loans the admin detail view embeds
+const detailLoanLimit = 50
+
+type AdminUserUsecaseImpl struct {
+	userRepo        domain.UserRepository
+	loanRepo        domain.LoanRepository
+	roleRepo        domain.RoleRepository
+	passwordSvc     domain.PasswordService
+	logRepo         domain.LogRepository
+	revocationStore domain.TokenRevocationStore
+	notifier        domain.NotificationUsecase
+	roleUsecase     domain.RoleUsecase
+	tokenGen        domain.TokenGenerator
+	transactor      domain.Transactor
+}
+
+func NewAdminUserUsecase(userRepo domain.UserRepository, loanRepo domain.LoanRepository, roleRepo domain.RoleRepository, passwordSvc domain.PasswordService, logRepo domain.LogRepository, revocationStore domain.TokenRevocationStore, notifier domain.NotificationUsecase, roleUsecase domain.RoleUsecase, tokenGen domain.TokenGenerator, transactor domain.Transactor) domain.AdminUserUsecase {
+	return &AdminUserUsecaseImpl{
+		userRepo:        userRepo,
+		loanRepo:        loanRepo,
+		roleRepo:        roleRepo,
+		passwordSvc:     passwordSvc,
+		logRepo:         logRepo,
+		revocationStore: revocationStore,
+		notifier:        notifier,
+		roleUsecase:     roleUsecase,
+		tokenGen:        tokenGen,
+		transactor:      transactor,
+	}
+}
+
+// inviteExpiry is how long the set-password link of an admin-created account stays valid.
+func inviteExpiry() time.Duration {
+	hours := config.EnvConfigs.AccountInviteExpiryHours
+	if hours <= 0 {
+		hours = 72
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// impersonationExpiry is how long an impersonation token works; it can't be refreshed.
+func impersonationExpiry() time.Duration {
+	minutes := config.EnvConfigs.ImpersonationTokenMinutes
+	if minutes <= 0 {
+		minutes = 15
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// checkManageable stops admins from acting on accounts whose role outranks their own.
+func (a *AdminUserUsecaseImpl) checkManageable(actorRole, targetRole string) domain.ErrorResponse {
+	ok, err := a.roleUsecase.CanManageRole(actorRole, targetRole)
+	if err == mongo.ErrNoDocuments {
+		return domain.ErrorResponse{StatusCode: 400, Message: "Role not found"}
+	}
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 500, Message: "Internal Server Error"}
+	}
+	if !ok {
+		return domain.ErrorResponse{StatusCode: 403, Message: "You can't manage a user with more permissions than you"}
+	}
+	return domain.ErrorResponse{}
+}
+
+// CreateUser adds an already activated account. When the admin sets no password the account gets
+// an unusable random one and the user is emailed a link to choose their own.
+func (a *AdminUserUsecaseImpl) CreateUser(actorID, actorRole string, request domain.AdminCreateUserRequest) (domain.ReturnUser, domain.ErrorResponse) {
+	request.Username = strings.TrimSpace(request.Username)
+	request.Email = strings.TrimSpace(request.Email)
+	if request.Username == "" || request.Email == "" {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 400, Message: "Username and email are required"}
+	}
+	if !infrastracture.IsValidEmail(request.Email) {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 400, Message: "Invalid email address"}
+	}
+	if request.Password != "" && !infrastracture.IsValidPassword(request.Password) {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 400, Message: "Password must be at least 8 characters long and contain upper and lower case letters, a number and a symbol"}
+	}
+	if request.Role == "" {
+		request.Role = string(domain.UserRole)
+	}
+	if errResp := a.checkManageable(actorRole, request.Role); errResp.Message != "" {
+		return domain.ReturnUser{}, errResp
+	}
+
+	if _, err := a.userRepo.GetUserByEmail(request.Email); err == nil {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 400, Message: "Email is already in use"}
+	}
+	if _, err := a.userRepo.GetUserByUsername(request.Username); err == nil {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 400, Message: "Username is already taken"}
+	}
+
+	password := request.Password
+	if password == "" {
+		random, err := infrastracture.GenerateActivationToken()
+		if err != nil {
+			return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to generate password"}
+		}
+		password = random
+	}
+	hashedPassword, err := a.passwordSvc.HashPassword(password)
+	if err != nil {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to hash password"}
+	}
+
+	now := time.Now()
+	user := domain.User{
+		ID:        primitive.NewObjectID(),
+		Username:  request.Username,
+		Email:     request.Email,
+		Password:  hashedPassword,
+		Role:      request.Role,
+		IsActive:  true,
+		CreatedAt: primitive.Timestamp{T: uint32(now.Unix())},
+	}
+
+	var inviteToken string
+	if request.Password == "" {
+		inviteToken, err = infrastracture.GenerateActivationToken()
+		if err != nil {
+			return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to generate reset token"}
+		}
+		user.PasswordResetToken = infrastracture.HashToken(inviteToken)
+		user.PasswordResetExpiresAt = now.Add(inviteExpiry())
+	}
+
+	// same as Register: without the invite nobody could ever use the account, so both are saved together
+	errResp := inTransaction(a.transactor, func(ctx context.Context) error {
+		// conflicts with a concurrent deletion of the role, see RoleUsecase.DeleteRole
+		err := a.roleRepo.LockRole(ctx, user.Role)
+		if err == mongo.ErrNoDocuments {
+			return abortWith(400, "Role not found", nil)
+		}
+		if err != nil {
+			return abortWith(500, "Failed to create user account", err)
+		}
+		if err := a.userRepo.Register(ctx, user); err != nil {
+			return abortWith(500, "Failed to create user account", err)
+		}
+		if inviteToken == "" {
+			return nil
+		}
+		err = a.notifier.SendEmail(ctx, user, domain.EmailAccountCreated, map[string]interface{}{
+			"Token":     inviteToken,
+			"ExpiresAt": user.PasswordResetExpiresAt,
+		})
+		if err != nil {
+			return abortWith(500, "Failed to create user account", err)
+		}
+		return nil
+	})
+	if errResp.Message != "" {
+		return domain.ReturnUser{}, errResp
+	}
+
+	a.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: now.String(),
+		Event:     "User Created",
+		Details:   "Admin " + actorID + " created user " + user.Email + " with role " + user.Role,
+	})
+
+	return toReturnUser(user), domain.ErrorResponse{}
+}
+
+func (a *AdminUserUsecaseImpl) GetUserDetail(userID string) (domain.AdminUserDetail, domain.ErrorResponse) {
+	user, err := a.userRepo.GetUserByID(userID)
+	if err != nil {
+		return domain.AdminUserDetail{}, domain.ErrorResponse{StatusCode: 404, Message: "User not found"}
+	}
+
+	loans, err := a.loanRepo.SearchLoans(domain.LoanFilter{BorrowerID: userID, Page: 1, Limit: detailLoanLimit})
+	if err != nil {
+		return domain.AdminUserDetail{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to get loans"}
+	}
+
+	detail := domain.AdminUserDetail{
+		User:                  toReturnUser(user),
+		IsActive:              user.IsActive,
+		Suspended:             user.Suspended,
+		SuspensionReason:      user.SuspensionReason,
+		PasswordResetRequired: user.PasswordResetRequired,
+		TwoFactorEnabled:      user.TwoFactorEnabled,
+		PreferredLanguage:     user.PreferredLanguage,
+		Sessions:              userSessions(user, ""),
+		Loans:                 loans.Loans,
+		LoanCount:             loans.Total,
+	}
+	if user.Suspended && !user.SuspendedAt.IsZero() {
+		suspendedAt := user.SuspendedAt
+		detail.SuspendedAt = &suspendedAt
+	}
+	if detail.Loans == nil {
+		detail.Loans = []domain.Loan{}
+	}
+
+	return detail, domain.ErrorResponse{}
+}
+
+func (a *AdminUserUsecaseImpl) UpdateUser(actorID, actorRole, userID string, request domain.AdminUpdateUserRequest) (domain.ReturnUser, domain.ErrorResponse) {
+	user, err := a.userRepo.GetUserByID(userID)
+	if err != nil {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 404, Message: "User not found"}
+	}
+	if errResp := a.checkManageable(actorRole, user.Role); errResp.Message != "" {
+		return domain.ReturnUser{}, errResp
+	}
+
+	changes := []string{}
+	set := map[string]interface{}{}
+	if request.Username != nil {
+		username := strings.TrimSpace(*request.Username)
+		if username == "" {
+			return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 400, Message: "Username can't be empty"}
+		}
+		if username != user.Username {
+			if existing, err := a.userRepo.GetUserByUsername(username); err == nil && existing.ID != user.ID {
+				return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 400, Message: "Username is already taken"}
+			}
+			changes = append(changes, "username "+user.Username+" -> "+username)
+			user.Username = username
+			set["username"] = username
+		}
+	}
+	if request.Email != nil {
+		email := strings.TrimSpace(*request.Email)
+		if !infrastracture.IsValidEmail(email) {
+			return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 400, Message: "Invalid email address"}
+		}
+		if email != user.Email {
+			if existing, err := a.userRepo.GetUserByEmail(email); err == nil && existing.ID != user.ID {
+				return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 400, Message: "Email is already in use"}
+			}
+			changes = append(changes, "email "+user.Email+" -> "+email)
+			user.Email = email
+			set["email"] = email
+		}
+	}
+	if request.PreferredLanguage != nil {
+		language := infrastracture.NormalizeLocale(*request.PreferredLanguage)
+		if language != user.PreferredLanguage {
+			changes = append(changes, "preferred language "+user.PreferredLanguage+" -> "+language)
+			user.PreferredLanguage = language
+			set["preferred_language"] = language
+		}
+	}
+
+	if len(changes) == 0 {
+		return toReturnUser(user), domain.ErrorResponse{}
+	}
+
+	err = a.userRepo.UpdateUser(context.Background(), user.ID, domain.UserChange{Set: set})
+	if err == mongo.ErrNoDocuments {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 404, Message: "User not found"}
+	}
+	if err != nil {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to update user"}
+	}
+
+	a.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "User Updated",
+		Details:   "Admin " + actorID + " updated user " + userID + ": " + strings.Join(changes, ", "),
+	})
+
+	return toReturnUser(user), domain.ErrorResponse{}
+}
+
+// SuspendUser blocks logins and ends every session of the account right away.
+func (a *AdminUserUsecaseImpl) SuspendUser(actorID, actorRole, userID, reason string) domain.ErrorResponse {
+	if actorID == userID {
+		return domain.ErrorResponse{StatusCode: 400, Message: "You can't suspend your own account"}
+	}
+
+	user, err := a.userRepo.GetUserByID(userID)
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 404, Message: "User not found"}
+	}
+	if errResp := a.checkManageable(actorRole, user.Role); errResp.Message != "" {
+		return errResp
+	}
+	if user.Suspended {
+		return domain.ErrorResponse{StatusCode: 409, Message: "User is already suspended"}
+	}
+
+	now := time.Now()
+	user.Suspended = true
+	user.SuspendedAt = now
+	user.SuspensionReason = strings.TrimSpace(reason)
+	// like ForcePasswordReset: the flag and the ended sessions are saved together, and access
+	// tokens are revoked once they are
+	errResp := inTransaction(a.transactor, func(ctx context.Context) error {
+		err := a.userRepo.UpdateUser(ctx, user.ID, domain.UserChange{
+			Set:   map[string]interface{}{"suspended": true, "suspended_at": now, "suspension_reason": user.SuspensionReason},
+			Where: map[string]interface{}{"suspended": false},
+		})
+		if err == mongo.ErrNoDocuments {
+			return abortWith(409, "User is already suspended", err)
+		}
+		if err != nil {
+			return abortWith(500, "Failed to update user", err)
+		}
+		if err := a.userRepo.DeleteAllRefreshTokens(ctx, &user); err != nil {
+			return abortWith(500, "Failed to end sessions", err)
+		}
+		return nil
+	})
+	if errResp.Message != "" {
+		return errResp
+	}
+
+	if err := a.revocationStore.RevokeUserTokens(userID, now); err != nil {
+		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to revoke access tokens"}
+	}
+
+	details := "Admin " + actorID + " suspended user " + user.Email
+	if user.SuspensionReason != "" {
+		details += ": " + user.SuspensionReason
+	}
+	a.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: now.String(),
+		Event:     "User Suspended",
+		Details:   details,
+	})
+
+	return domain.ErrorResponse{}
+}
+
+func (a *AdminUserUsecaseImpl) ReactivateUser(actorID, actorRole, userID string) domain.ErrorResponse {
+	user, err := a.userRepo.GetUserByID(userID)
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 404, Message: "User not found"}
+	}
+	if errResp := a.checkManageable(actorRole, user.Role); errResp.Message != "" {
+		return errResp
+	}
+	if !user.Suspended {
+		return domain.ErrorResponse{StatusCode: 409, Message: "User is not suspended"}
+	}
+
+	user.Suspended = false
+	user.SuspendedAt = time.Time{}
+	user.SuspensionReason = ""
+	errResp := inTransaction(a.transactor, func(ctx context.Context) error {
+		err := a.userRepo.UpdateUser(ctx, user.ID, domain.UserChange{
+			Set:   map[string]interface{}{"suspended": false, "suspended_at": time.Time{}, "suspension_reason": ""},
+			Where: map[string]interface{}{"suspended": true},
+		})
+		if err == mongo.ErrNoDocuments {
+			return abortWith(409, "User is not suspended", err)
+		}
+		if err != nil {
+			return abortWith(500, "Failed to update user", err)
+		}
+		return nil
+	})
+	if errResp.Message != "" {
+		return errResp
+	}
+
+	a.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "User Reactivated",
+		Details:   "Admin " + actorID + " reactivated user " + user.Email,
+	})
+
+	return domain.ErrorResponse{}
+}
+
+// ForcePasswordReset signs the user out everywhere and blocks login until they choose a new
+// password through the emailed reset link.
+func (a *AdminUserUsecaseImpl) ForcePasswordReset(actorID, actorRole, userID string) domain.ErrorResponse {
+	user, err := a.userRepo.GetUserByID(userID)
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 404, Message: "User not found"}
+	}
+	if errResp := a.checkManageable(actorRole, user.Role); errResp.Message != "" {
+		return errResp
+	}
+
+	resetToken, err := infrastracture.GenerateActivationToken()
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to generate reset token"}
+	}
+
+	now := time.Now()
+	user.PasswordResetToken = infrastracture.HashToken(resetToken)
+	user.PasswordResetExpiresAt = now.Add(tokenExpiry(config.EnvConfigs.PasswordResetTokenExpiryMinutes))
+	user.PasswordResetRequired = true
+	errResp := inTransaction(a.transactor, func(ctx context.Context) error {
+		err := a.userRepo.UpdateUser(ctx, user.ID, domain.UserChange{Set: map[string]interface{}{
+			"password_reset_token":      user.PasswordResetToken,
+			"password_reset_expires_at": user.PasswordResetExpiresAt,
+			"password_reset_required":   true,
+		}})
+		if err == mongo.ErrNoDocuments {
+			return abortWith(404, "User not found", err)
+		}
+		if err != nil {
+			return abortWith(500, "Failed to update user", err)
+		}
+		if err := a.userRepo.DeleteAllRefreshTokens(ctx, &user); err != nil {
+			return abortWith(500, "Failed to end sessions", err)
+		}
+		err = a.notifier.SendEmail(ctx, user, domain.EmailPasswordReset, map[string]interface{}{"Token": resetToken, "Forced": true})
+		if err != nil {
+			return abortWith(500, "Failed to send reset link", err)
+		}
+		return nil
+	})
+	if errResp.Message != "" {
+		return errResp
+	}
+
+	if err := a.revocationStore.RevokeUserTokens(userID, now); err != nil {
+		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to revoke access tokens"}
+	}
+
+	a.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: now.String(),
+		Event:     "Password Reset Forced",
+		Details:   "Admin " + actorID + " forced a password reset for " + user.Email,
+	})
+
+	return domain.ErrorResponse{}
+}
+
+// DeleteUser soft-deletes the account and ends its sessions. Borrowers with active loans have to
+// settle them first, so the loans never point at a deleted account; loan applications nobody has
+// decided on yet are cancelled along with the account, since they could no longer be approved.
+func (a *AdminUserUsecaseImpl) DeleteUser(actorID, actorRole, userID string) (domain.ReturnUser, domain.ErrorResponse) {
+	if actorID == userID {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 400, Message: "You can't delete your own account"}
+	}
+
+	user, err := a.userRepo.GetUserByID(userID)
+	if err != nil {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 404, Message: "User not found"}
+	}
+	if errResp := a.checkManageable(actorRole, user.Role); errResp.Message != "" {
+		return domain.ReturnUser{}, errResp
+	}
+
+	activeLoans, err := a.loanRepo.CountActiveLoans(userID)
+	if err != nil {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 500, Message: "Internal Server Error"}
+	}
+	if activeLoans > 0 {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 409, Message: "User has active loans"}
+	}
+
+	now := time.Now()
+	var deleted domain.User
+	var cancelled int64
+	errResp := inTransaction(a.transactor, func(ctx context.Context) error {
+		var err error
+		if user.Role == string(domain.AdminRole) {
+			// the lock serializes this with role changes and other deletions of admins, see AssignRole
+			if err = a.roleRepo.LockRole(ctx, user.Role); err != nil {
+				return abortWith(500, "Internal Server Error", err)
+			}
+			admins, err := a.userRepo.CountUsersByRole(ctx, user.Role)
+			if err != nil {
+				return abortWith(500, "Internal Server Error", err)
+			}
+			if admins <= 1 {
+				return abortWith(409, "Can't remove the last admin", nil)
+			}
+		}
+
+		deleted, err = a.userRepo.SoftDeleteUser(ctx, userID, actorID, now)
+		if err == mongo.ErrNoDocuments {
+			return abortWith(404, "User not found", err)
+		}
+		if err != nil {
+			return abortWith(500, "Failed to delete user", err)
+		}
+
+		cancelled, err = a.loanRepo.CancelOpenLoans(ctx, userID, domain.LoanStatusChange{
+			To:        domain.LoanCancelled,
+			ActorID:   actorID,
+			Reason:    "Borrower account deleted",
+			Timestamp: now,
+		})
+		if err != nil {
+			return abortWith(500, "Failed to cancel open loans", err)
+		}
+		return nil
+	})
+	if errResp.Message != "" {
+		return domain.ReturnUser{}, errResp
+	}
+
+	if err := a.revocationStore.RevokeUserTokens(userID, now); err != nil {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to revoke access tokens"}
+	}
+
+	a.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: now.String(),
+		Event:     "User Deleted",
+		Details:   "Admin " + actorID + " deleted user " + deleted.Email + " and cancelled " + strconv.FormatInt(cancelled, 10) + " open loans",
+	})
+
+	return toReturnUser(deleted), domain.ErrorResponse{}
+}
+
+// RestoreUser undoes a soft delete, unless someone has signed up with the same email or username since.
+func (a *AdminUserUsecaseImpl) RestoreUser(actorID, userID string) (domain.ReturnUser, domain.ErrorResponse) {
+	deleted, err := a.userRepo.GetDeletedUserByID(userID)
+	if err != nil {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 404, Message: "Deleted user not found"}
+	}
+
+	if _, err := a.userRepo.GetUserByEmail(deleted.Email); err == nil {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 409, Message: "Another account now uses this email"}
+	}
+	if _, err := a.userRepo.GetUserByUsername(deleted.Username); err == nil {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 409, Message: "Another account now uses this username"}
+	}
+
+	user, err := a.userRepo.RestoreUser(userID)
+	if err == mongo.ErrNoDocuments {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 404, Message: "Deleted user not found"}
+	}
+	if err != nil {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to restore user"}
+	}
+
+	a.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "User Restored",
+		Details:   "Admin " + actorID + " restored user " + user.Email + ", deleted by " + deleted.DeletedBy + " on " + deleted.DeletedAt.Format(time.RFC3339),
+	})
+
+	return toReturnUser(user), domain.ErrorResponse{}
+}
+
+func (a *AdminUserUsecaseImpl) GetDeletedUsers(limit, page string) ([]domain.ReturnUser, domain.ErrorResponse) {
+	users, err := a.userRepo.GetDeletedUsers(limit, page)
+	if err != nil {
+		return []domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to get users"}
+	}
+
+	returnUsers := []domain.ReturnUser{}
+	for _, user := range users {
+		returnUsers = append(returnUsers, toReturnUser(user))
+	}
+	return returnUsers, domain.ErrorResponse{}
+}
+
+// ImpersonateUser issues a read-only token that lets support see the API exactly as the user does.
+// The token names the acting admin, and AuthMiddleware logs every request made with it.
+func (a *AdminUserUsecaseImpl) ImpersonateUser(actorID, actorRole, userID string) (domain.ImpersonationResponse, domain.ErrorResponse) {
+	if actorID == userID {
+		return domain.ImpersonationResponse{}, domain.ErrorResponse{StatusCode: 400, Message: "You can't impersonate yourself"}
+	}
+
+	user, err := a.userRepo.GetUserByID(userID)
+	if err != nil {
+		return domain.ImpersonationResponse{}, domain.ErrorResponse{StatusCode: 404, Message: "User not found"}
+	}
+	if errResp := a.checkManageable(actorRole, user.Role); errResp.Message != "" {
+		return domain.ImpersonationResponse{}, errResp
+	}
+
+	expiry := impersonationExpiry()
+	token, err := a.tokenGen.GenerateImpersonationToken(user, actorID, expiry)
+	if err != nil {
+		return domain.ImpersonationResponse{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to generate token"}
+	}
+
+	now := time.Now()
+	a.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: now.String(),
+		Event:     "Impersonation Started",
+		Details:   "Admin " + actorID + " started impersonating user " + user.Email,
+	})
+
+	return domain.ImpersonationResponse{
+		AccessToken: token,
+		ExpiresAt:   now.Add(expiry),
+		User:        toReturnUser(user),
+	}, domain.ErrorResponse{}
+}
@@ -0,0 +1,169 @@
+package usecase
+
+import (
+	"loan-tracker-api/domain"
+	"loan-tracker-api/infrastracture"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// apiKeyPrefix makes keys easy to recognise, e.g. by secret scanners
+	apiKeyPrefix            = "ltk_"
+	defaultAPIKeyExpiryDays = 90
+	maxAPIKeyExpiryDays     = 365
+	// last_used_at is only rewritten this often, not on every request
+	apiKeyTouchInterval = time.Minute
+)
+
+type APIKeyUsecaseImpl struct {
+	apiKeyRepo  domain.APIKeyRepository
+	userRepo    domain.UserRepository
+	roleUsecase domain.RoleUsecase
+	logRepo     domain.LogRepository
+}
+
+func NewAPIKeyUsecase(apiKeyRepo domain.APIKeyRepository, userRepo domain.UserRepository, roleUsecase domain.RoleUsecase, logRepo domain.LogRepository) domain.APIKeyUsecase {
+	return &APIKeyUsecaseImpl{
+		apiKeyRepo:  apiKeyRepo,
+		userRepo:    userRepo,
+		roleUsecase: roleUsecase,
+		logRepo:     logRepo,
+	}
+}
+
+// CreateKey mints a key owned by the actor. Scopes are limited to permissions the actor holds,
+// and a key can never manage keys itself or impersonate users.
+func (a *APIKeyUsecaseImpl) CreateKey(actorID, actorRole string, request domain.CreateAPIKeyRequest) (domain.CreatedAPIKey, domain.ErrorResponse) {
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" {
+		return domain.CreatedAPIKey{}, domain.ErrorResponse{StatusCode: 400, Message: "Name is required"}
+	}
+	if len(request.Scopes) == 0 {
+		return domain.CreatedAPIKey{}, domain.ErrorResponse{StatusCode: 400, Message: "At least one scope is required"}
+	}
+
+	if request.ExpiresInDays == 0 {
+		request.ExpiresInDays = defaultAPIKeyExpiryDays
+	}
+	if request.ExpiresInDays < 0 || request.ExpiresInDays > maxAPIKeyExpiryDays {
+		return domain.CreatedAPIKey{}, domain.ErrorResponse{StatusCode: 400, Message: "Keys must expire within " + strconv.Itoa(maxAPIKeyExpiryDays) + " days"}
+	}
+
+	seen := map[string]bool{}
+	scopes := []string{}
+	for _, scope := range request.Scopes {
+		if _, ok := domain.AllPermissions[scope]; !ok {
+			return domain.CreatedAPIKey{}, domain.ErrorResponse{StatusCode: 400, Message: "Unknown permission " + scope}
+		}
+		if scope == domain.PermAPIKeysManage || scope == domain.PermUsersImpersonate {
+			return domain.CreatedAPIKey{}, domain.ErrorResponse{StatusCode: 400, Message: "API keys can't be given " + scope}
+		}
+		ok, err := a.roleUsecase.HasPermission(actorRole, scope)
+		if err != nil {
+			return domain.CreatedAPIKey{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to check permissions"}
+		}
+		if !ok {
+			return domain.CreatedAPIKey{}, domain.ErrorResponse{StatusCode: 403, Message: "You can't grant " + scope + " because you don't have it"}
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	secret, err := infrastracture.GenerateActivationToken()
+	if err != nil {
+		return domain.CreatedAPIKey{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to generate key"}
+	}
+	rawKey := apiKeyPrefix + secret
+
+	now := time.Now()
+	key, err := a.apiKeyRepo.CreateKey(domain.APIKey{
+		Name:      request.Name,
+		Prefix:    rawKey[:len(apiKeyPrefix)+8],
+		KeyHash:   infrastracture.HashToken(rawKey),
+		OwnerID:   actorID,
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: now.AddDate(0, 0, request.ExpiresInDays),
+	})
+	if err != nil {
+		return domain.CreatedAPIKey{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to create key"}
+	}
+
+	a.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "API Key Created",
+		Details:   "Admin " + actorID + " created API key " + key.Prefix + " (" + key.Name + ") with scopes " + strings.Join(scopes, ", "),
+	})
+
+	return domain.CreatedAPIKey{APIKey: key, Key: rawKey}, domain.ErrorResponse{}
+}
+
+func (a *APIKeyUsecaseImpl) GetKeys() ([]domain.APIKey, domain.ErrorResponse) {
+	keys, err := a.apiKeyRepo.GetKeys()
+	if err != nil {
+		return nil, domain.ErrorResponse{StatusCode: 500, Message: "Failed to get keys"}
+	}
+	return keys, domain.ErrorResponse{}
+}
+
+func (a *APIKeyUsecaseImpl) RevokeKey(actorID, id string) (domain.APIKey, domain.ErrorResponse) {
+	key, err := a.apiKeyRepo.RevokeKey(id, actorID, time.Now())
+	if err == mongo.ErrNoDocuments {
+		return domain.APIKey{}, domain.ErrorResponse{StatusCode: 404, Message: "Key not found or already revoked"}
+	}
+	if err != nil {
+		return domain.APIKey{}, domain.ErrorResponse{StatusCode: 400, Message: "Invalid key ID"}
+	}
+
+	a.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "API Key Revoked",
+		Details:   "Admin " + actorID + " revoked API key " + key.Prefix + " (" + key.Name + ")",
+	})
+
+	return key, domain.ErrorResponse{}
+}
+
+// AuthenticateAPIKey accepts live keys whose owner can still sign in. The owner's current role
+// applies, so demoting or suspending the owner also limits or stops their keys.
+func (a *APIKeyUsecaseImpl) AuthenticateAPIKey(rawKey string) (domain.APIKeyPrincipal, error) {
+	if !strings.HasPrefix(rawKey, apiKeyPrefix) {
+		return domain.APIKeyPrincipal{}, domain.ErrInvalidAPIKey
+	}
+
+	key, err := a.apiKeyRepo.GetKeyByHash(infrastracture.HashToken(rawKey))
+	if err == mongo.ErrNoDocuments {
+		return domain.APIKeyPrincipal{}, domain.ErrInvalidAPIKey
+	}
+	if err != nil {
+		return domain.APIKeyPrincipal{}, err
+	}
+	now := time.Now()
+	if !key.RevokedAt.IsZero() || !now.Before(key.ExpiresAt) {
+		return domain.APIKeyPrincipal{}, domain.ErrInvalidAPIKey
+	}
+
+	owner, err := a.userRepo.GetUserByID(key.OwnerID)
+	if err != nil {
+		return domain.APIKeyPrincipal{}, domain.ErrInvalidAPIKey
+	}
+	if errResp := accountBlocked(owner); errResp.Message != "" {
+		return domain.APIKeyPrincipal{}, domain.ErrInvalidAPIKey
+	}
+
+	if now.Sub(key.LastUsedAt) > apiKeyTouchInterval {
+		if err := a.apiKeyRepo.TouchKey(key.ID, now); err != nil {
+			log.Printf("Error recording use of api key %s: %v", key.Prefix, err)
+		}
+		key.LastUsedAt = now
+	}
+
+	return domain.APIKeyPrincipal{Key: key, Owner: owner}, nil
+}
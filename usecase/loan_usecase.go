@@ -1,30 +1,159 @@
 package usecase
 
-import "loan-tracker-api/domain"
+import (
+	"context"
+	"loan-tracker-api/domain"
+	"loan-tracker-api/infrastracture"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
 
 type LoanUsecaseImpl struct {
-	loanRepo domain.LoanRepository
+	loanRepo    domain.LoanRepository
+	logRepo     domain.LogRepository
+	notifier    domain.NotificationUsecase
+	permissions domain.PermissionResolver
+	transactor  domain.Transactor
 }
 
-func NewLoanUsecase(loanRepo domain.LoanRepository) domain.LoanUsecase {
+func NewLoanUsecase(loanRepo domain.LoanRepository, logRepo domain.LogRepository, notifier domain.NotificationUsecase, permissions domain.PermissionResolver, transactor domain.Transactor) domain.LoanUsecase {
 	return &LoanUsecaseImpl{
-		loanRepo: loanRepo,
+		loanRepo:    loanRepo,
+		logRepo:     logRepo,
+		notifier:    notifier,
+		permissions: permissions,
+		transactor:  transactor,
 	}
 }
 
-func (l *LoanUsecaseImpl) CreateLoan(loan domain.Loan) (domain.Loan, domain.ErrorResponse) {
+// canReadLoan lets borrowers see their own loans, and staff whose role grants loans:read see any.
+func canReadLoan(permissions domain.PermissionResolver, loan domain.Loan, userID, role string) domain.ErrorResponse {
+	if loan.BorrowerID == userID {
+		return domain.ErrorResponse{}
+	}
 
-	if loan.Title == "" || loan.Description == "" || loan.BorrowerID == "" || loan.BorrowerName == "" || loan.Amount == 0 {
+	ok, err := permissions.HasPermission(role, domain.PermLoansRead)
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to check permissions"}
+	}
+	if !ok {
+		return domain.ErrorResponse{StatusCode: 401, Message: "Unauthorized"}
+	}
+	return domain.ErrorResponse{}
+}
+
+func (l *LoanUsecaseImpl) CreateLoan(borrowerID, borrowerName string, request domain.CreateLoanRequest) (domain.Loan, domain.ErrorResponse) {
+	loan := domain.Loan{
+		Title:              request.Title,
+		Description:        request.Description,
+		BorrowerID:         borrowerID,
+		BorrowerName:       borrowerName,
+		Amount:             request.Amount,
+		TermMonths:         request.TermMonths,
+		RepaymentFrequency: request.RepaymentFrequency,
+	}
+
+	if errResp := validateLoanTerms(&loan); errResp.Message != "" {
+		return domain.Loan{}, errResp
+	}
+
+	loan.Status = domain.LoanPending
+	loan.CreatedAt = primitive.Timestamp{T: uint32(time.Now().Unix())}
+	loan.UpdatedAt = loan.CreatedAt
+	loan.Schedule = nil
+	loan.Outstanding = domain.LoanBalance{}
+	loan.StatusHistory = []domain.LoanStatusChange{{
+		To:        domain.LoanPending,
+		ActorID:   loan.BorrowerID,
+		Reason:    "Loan application submitted",
+		Timestamp: time.Now(),
+	}}
+
+	createdLoan, err := l.loanRepo.CreateLoan(loan)
+	if err != nil {
 		return domain.Loan{}, domain.ErrorResponse{
+			StatusCode: 500,
+			Message:    "Internal Server Error",
+		}
+	}
+
+	return createdLoan, domain.ErrorResponse{}
+	
+}
+
+
+// validateLoanTerms checks the borrower supplied fields of a loan application and fills in defaults.
+func validateLoanTerms(loan *domain.Loan) domain.ErrorResponse {
+	if loan.Title == "" || loan.Description == "" || loan.BorrowerID == "" || loan.BorrowerName == "" || loan.Amount == 0 {
+		return domain.ErrorResponse{
 			StatusCode: 400,
 			Message:    "All fields are required",
 		}
-		
 	}
 
-	loan.Status = "pending"
+	if loan.Amount < 0 {
+		return domain.ErrorResponse{
+			StatusCode: 400,
+			Message:    "Amount must be greater than zero",
+		}
+	}
 
-	createdLoan, err := l.loanRepo.CreateLoan(loan)
+	if loan.TermMonths <= 0 {
+		return domain.ErrorResponse{
+			StatusCode: 400,
+			Message:    "Term must be a positive number of months",
+		}
+	}
+
+	if loan.RepaymentFrequency == "" {
+		loan.RepaymentFrequency = domain.MonthlyRepayment
+	}
+	if _, err := infrastracture.PeriodsPerYear(loan.RepaymentFrequency); err != nil {
+		return domain.ErrorResponse{
+			StatusCode: 400,
+			Message:    "Invalid repayment frequency",
+		}
+	}
+
+	return domain.ErrorResponse{}
+}
+
+func (l *LoanUsecaseImpl) UpdateLoan(userID, loanID string, update domain.LoanUpdateRequest) (domain.Loan, domain.ErrorResponse) {
+	loan, errResp := l.getPendingOwnLoan(userID, loanID)
+	if errResp.Message != "" {
+		return domain.Loan{}, errResp
+	}
+
+	if update.Title != nil {
+		loan.Title = *update.Title
+	}
+	if update.Description != nil {
+		loan.Description = *update.Description
+	}
+	if update.Amount != nil {
+		loan.Amount = *update.Amount
+	}
+	if update.TermMonths != nil {
+		loan.TermMonths = *update.TermMonths
+	}
+	if update.RepaymentFrequency != nil {
+		loan.RepaymentFrequency = *update.RepaymentFrequency
+	}
+
+	if errResp := validateLoanTerms(&loan); errResp.Message != "" {
+		return domain.Loan{}, errResp
+	}
+
+	loan.UpdatedAt = primitive.Timestamp{T: uint32(time.Now().Unix())}
+	updatedLoan, err := l.loanRepo.UpdateLoan(loan, loanID)
+	if err == mongo.ErrNoDocuments {
+		return domain.Loan{}, domain.ErrorResponse{
+			StatusCode: 409,
+			Message:    "Only pending loans can be edited",
+		}
+	}
 	if err != nil {
 		return domain.Loan{}, domain.ErrorResponse{
 			StatusCode: 500,
@@ -32,10 +161,90 @@ func (l *LoanUsecaseImpl) CreateLoan(loan domain.Loan) (domain.Loan, domain.Erro
 		}
 	}
 
-	return createdLoan, domain.ErrorResponse{}
-	
+	l.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Loan Update",
+		Details:   "User " + userID + " updated pending loan " + loanID,
+	})
+
+	return updatedLoan, domain.ErrorResponse{}
 }
 
+func (l *LoanUsecaseImpl) CancelLoan(userID, loanID, reason string) (domain.Loan, domain.ErrorResponse) {
+	if reason == "" {
+		return domain.Loan{}, domain.ErrorResponse{
+			StatusCode: 400,
+			Message:    "A cancellation reason is required",
+		}
+	}
+
+	_, errResp := l.getPendingOwnLoan(userID, loanID)
+	if errResp.Message != "" {
+		return domain.Loan{}, errResp
+	}
+
+	loan, err := l.loanRepo.UpdateLoanStatus(context.Background(), loanID, domain.LoanStatusChange{
+		From:      domain.LoanPending,
+		To:        domain.LoanCancelled,
+		ActorID:   userID,
+		Reason:    reason,
+		Timestamp: time.Now(),
+	})
+	if err == mongo.ErrNoDocuments {
+		return domain.Loan{}, domain.ErrorResponse{
+			StatusCode: 409,
+			Message:    "Only pending loans can be cancelled",
+		}
+	}
+	if err != nil {
+		return domain.Loan{}, domain.ErrorResponse{
+			StatusCode: 500,
+			Message:    "Internal Server Error",
+		}
+	}
+
+	l.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Loan Cancellation",
+		Details:   "User " + userID + " cancelled loan " + loanID + ": " + reason,
+	})
+
+	return loan, domain.ErrorResponse{}
+}
+
+// getPendingOwnLoan loads a loan the borrower is still allowed to change.
+func (l *LoanUsecaseImpl) getPendingOwnLoan(userID, loanID string) (domain.Loan, domain.ErrorResponse) {
+	if loanID == "" {
+		return domain.Loan{}, domain.ErrorResponse{
+			StatusCode: 400,
+			Message:    "ID is required",
+		}
+	}
+
+	loan, err := l.loanRepo.GetLoanByID(loanID)
+	if err != nil {
+		return domain.Loan{}, domain.ErrorResponse{
+			StatusCode: 404,
+			Message:    "Loan not found",
+		}
+	}
+
+	if loan.BorrowerID != userID {
+		return domain.Loan{}, domain.ErrorResponse{
+			StatusCode: 401,
+			Message:    "Unauthorized",
+		}
+	}
+
+	if loan.Status != domain.LoanPending {
+		return domain.Loan{}, domain.ErrorResponse{
+			StatusCode: 409,
+			Message:    "Loan can only be changed while it is pending",
+		}
+	}
+
+	return loan, domain.ErrorResponse{}
+}
 
 func (l *LoanUsecaseImpl) GetLoanByID( userID,Role ,id string) (domain.Loan, domain.ErrorResponse) {
 	if id == "" {
@@ -52,30 +261,95 @@ func (l *LoanUsecaseImpl) GetLoanByID( userID,Role ,id string) (domain.Loan, dom
 			Message:    "Internal Server Error",
 		}
 	}
-	if loan.BorrowerID != userID &&  Role != "admin" {
-		return domain.Loan{}, domain.ErrorResponse{
-			StatusCode: 401,
-			Message:    "Unauthorized",
-		}
+	if errResp := canReadLoan(l.permissions, loan, userID, Role); errResp.Message != "" {
+		return domain.Loan{}, errResp
 	}
 
 	return loan, domain.ErrorResponse{}
 }
 
-func (l *LoanUsecaseImpl) GetLoans() ([]domain.Loan, domain.ErrorResponse) {
-	loans, err := l.loanRepo.GetLoans()
+func (l *LoanUsecaseImpl) GetLoans(filter domain.LoanFilter) (domain.LoanPage, domain.ErrorResponse) {
+	if errResp := normalizeLoanFilter(&filter); errResp.Message != "" {
+		return domain.LoanPage{}, errResp
+	}
+
+	page, err := l.loanRepo.SearchLoans(filter)
+	if err == domain.ErrInvalidCursor {
+		return domain.LoanPage{}, domain.ErrorResponse{
+			StatusCode: 400,
+			Message:    "Invalid cursor",
+		}
+	}
 	if err != nil {
-		return []domain.Loan{}, domain.ErrorResponse{
+		return domain.LoanPage{}, domain.ErrorResponse{
 			StatusCode: 500,
 			Message:    "Internal Server Error",
 		}
 	}
 
-	return loans, domain.ErrorResponse{}
+	return page, domain.ErrorResponse{}
 }
 
 
-func (l *LoanUsecaseImpl) UpdateLoanStatus(newStatus, loanID string) (domain.Loan, domain.ErrorResponse) {
+func (l *LoanUsecaseImpl) GetUserLoans(borrowerID string, filter domain.LoanFilter) (domain.LoanPage, domain.ErrorResponse) {
+	if borrowerID == "" {
+		return domain.LoanPage{}, domain.ErrorResponse{
+			StatusCode: 401,
+			Message:    "Unauthorized",
+		}
+	}
+
+	// borrowers only ever see their own loans, whatever the query says
+	filter.BorrowerID = borrowerID
+	filter.BorrowerName = ""
+
+	return l.GetLoans(filter)
+}
+
+// normalizeLoanFilter validates a listing filter and fills in paging defaults.
+func normalizeLoanFilter(filter *domain.LoanFilter) domain.ErrorResponse {
+	if filter.Status != "" && !domain.IsValidLoanStatus(filter.Status) {
+		return domain.ErrorResponse{
+			StatusCode: 400,
+			Message:    "Invalid status",
+		}
+	}
+
+	if filter.SortBy != "" {
+		if _, ok := domain.LoanSortFields[filter.SortBy]; !ok {
+			return domain.ErrorResponse{
+				StatusCode: 400,
+				Message:    "Invalid sort field",
+			}
+		}
+	}
+
+	if filter.MinAmount > 0 && filter.MaxAmount > 0 && filter.MinAmount > filter.MaxAmount {
+		return domain.ErrorResponse{
+			StatusCode: 400,
+			Message:    "min_amount cannot be greater than max_amount",
+		}
+	}
+
+	if !filter.CreatedFrom.IsZero() && !filter.CreatedTo.IsZero() && filter.CreatedFrom.After(filter.CreatedTo) {
+		return domain.ErrorResponse{
+			StatusCode: 400,
+			Message:    "created_from cannot be after created_to",
+		}
+	}
+
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.Limit < 1 || filter.Limit > 100 {
+		filter.Limit = 10
+	}
+
+	return domain.ErrorResponse{}
+}
+
+func (l *LoanUsecaseImpl) UpdateLoanStatus(actorID, loanID string, request domain.LoanStatusRequest) (domain.Loan, domain.ErrorResponse) {
+	newStatus, reason := request.Status, request.Reason
 	if newStatus == "" || loanID == "" {
 		return domain.Loan{}, domain.ErrorResponse{
 			StatusCode: 400,
@@ -83,14 +357,14 @@ func (l *LoanUsecaseImpl) UpdateLoanStatus(newStatus, loanID string) (domain.Loa
 		}
 	}
 
-	if newStatus != "approved" && newStatus != "rejected" && newStatus != "pending" {
+	if !domain.IsValidLoanStatus(newStatus) {
 		return domain.Loan{}, domain.ErrorResponse{
 			StatusCode: 400,
 			Message:    "Invalid status",
 		}
 	}
 
-	_, err := l.loanRepo.GetLoanByID(loanID)
+	existingLoan, err := l.loanRepo.GetLoanByID(loanID)
 	if err != nil {
 		return domain.Loan{}, domain.ErrorResponse{
 			StatusCode: 500,
@@ -98,26 +372,152 @@ func (l *LoanUsecaseImpl) UpdateLoanStatus(newStatus, loanID string) (domain.Loa
 		}
 	}
 
-	
-	_, err = l.loanRepo.UpdateLoanStatus(newStatus, loanID)
-	if err != nil {
+	if !domain.CanTransitionLoan(existingLoan.Status, newStatus) {
 		return domain.Loan{}, domain.ErrorResponse{
-			StatusCode: 500,
-			Message:    "Internal Server Error",
+			StatusCode: 400,
+			Message:    "Cannot move a loan from " + existingLoan.Status + " to " + newStatus,
 		}
 	}
-	loan, err := l.loanRepo.GetLoanByID(loanID)
-	if err != nil {
+
+	// the rate is the lender's decision, so staff set it on approval rather than the borrower applying
+	if request.InterestRate != nil && newStatus != domain.LoanApproved {
 		return domain.Loan{}, domain.ErrorResponse{
-			StatusCode: 500,
-			Message:    "Internal Server Error",
+			StatusCode: 400,
+			Message:    "An interest rate can only be set when approving a loan",
+		}
+	}
+	var interestRate float64
+	if newStatus == domain.LoanApproved {
+		if request.InterestRate == nil {
+			return domain.Loan{}, domain.ErrorResponse{
+				StatusCode: 400,
+				Message:    "An interest rate is required to approve a loan",
+			}
+		}
+		interestRate = *request.InterestRate
+		if interestRate < 0 {
+			return domain.Loan{}, domain.ErrorResponse{
+				StatusCode: 400,
+				Message:    "Interest rate cannot be negative",
+			}
+		}
+	}
+
+	// the schedule is built before the status changes so a loan is never approved without one
+	var schedule []domain.Installment
+	if newStatus == domain.LoanApproved {
+		schedule, err = infrastracture.GenerateRepaymentSchedule(existingLoan.Amount, interestRate, existingLoan.TermMonths, existingLoan.RepaymentFrequency, time.Now())
+		if err != nil {
+			return domain.Loan{}, domain.ErrorResponse{
+				StatusCode: 400,
+				Message:    "Unable to generate repayment schedule: " + err.Error(),
+			}
+		}
+	}
+
+	// the status, the schedule and the borrower's email are saved together or not at all
+	var loan domain.Loan
+	errResp := inTransaction(l.transactor, func(ctx context.Context) error {
+		var err error
+		loan, err = l.loanRepo.UpdateLoanStatus(ctx, loanID, domain.LoanStatusChange{
+			From:      existingLoan.Status,
+			To:        newStatus,
+			ActorID:   actorID,
+			Reason:    reason,
+			Timestamp: time.Now(),
+		})
+		if err == mongo.ErrNoDocuments {
+			return abortWith(409, "Loan status was changed by another request, please retry", err)
+		}
+		if err != nil {
+			return abortWith(500, "Internal Server Error", err)
+		}
+
+		if schedule != nil {
+			outstanding := domain.LoanBalance{Principal: existingLoan.Amount}
+			for _, installment := range schedule {
+				outstanding.Interest += installment.Interest
+			}
+			outstanding.Interest = infrastracture.RoundCents(outstanding.Interest)
+
+			loan, err = l.loanRepo.UpdateLoanSchedule(ctx, loanID, interestRate, schedule, outstanding)
+			if err != nil {
+				return abortWith(500, "Internal Server Error", err)
+			}
+		}
+
+		if err := l.notifyDecision(ctx, loan, reason); err != nil {
+			return abortWith(500, "Failed to notify the borrower", err)
 		}
+		return nil
+	})
+	if errResp.Message != "" {
+		return domain.Loan{}, errResp
 	}
 
 	return loan, domain.ErrorResponse{}
 }
 
-func (l *LoanUsecaseImpl) DeleteLoan(loanID string) (domain.Loan, domain.ErrorResponse) {
+// notifyDecision queues the email telling the borrower their application was approved or rejected.
+func (l *LoanUsecaseImpl) notifyDecision(ctx context.Context, loan domain.Loan, reason string) error {
+	data := map[string]interface{}{
+		"LoanID":    loan.ID.Hex(),
+		"LoanTitle": loan.Title,
+		"Amount":    loan.Amount,
+	}
+
+	var templateName string
+	switch loan.Status {
+	case domain.LoanApproved:
+		templateName = domain.EmailLoanApproved
+		data["TermMonths"] = loan.TermMonths
+		data["InterestRate"] = loan.InterestRate
+		data["FirstDueDate"] = time.Time{}
+		if len(loan.Schedule) > 0 {
+			data["FirstDueDate"] = loan.Schedule[0].DueDate
+		}
+	case domain.LoanRejected:
+		templateName = domain.EmailLoanRejected
+		data["Reason"] = reason
+	default:
+		return nil
+	}
+
+	return l.notifier.NotifyUser(ctx, loan.BorrowerID, templateName, data)
+}
+
+func (l *LoanUsecaseImpl) GetLoanSchedule(userID, Role, loanID string) ([]domain.Installment, domain.ErrorResponse) {
+	loan, errResp := l.GetLoanByID(userID, Role, loanID)
+	if errResp.Message != "" {
+		return []domain.Installment{}, errResp
+	}
+
+	if len(loan.Schedule) == 0 {
+		return []domain.Installment{}, domain.ErrorResponse{
+			StatusCode: 404,
+			Message:    "Repayment schedule is only available for approved loans",
+		}
+	}
+
+	return loan.Schedule, domain.ErrorResponse{}
+}
+
+func (l *LoanUsecaseImpl) GetLoanHistory(userID, Role, loanID string) ([]domain.LoanStatusChange, domain.ErrorResponse) {
+	loan, errResp := l.GetLoanByID(userID, Role, loanID)
+	if errResp.Message != "" {
+		return []domain.LoanStatusChange{}, errResp
+	}
+
+	if loan.StatusHistory == nil {
+		return []domain.LoanStatusChange{}, domain.ErrorResponse{}
+	}
+
+	return loan.StatusHistory, domain.ErrorResponse{}
+}
+
+// DeleteLoan soft-deletes the loan; it is purged once the retention period has passed.
+// Active loans still have money in play and can't be deleted.
+func (l *LoanUsecaseImpl) DeleteLoan(actorID, loanID string) (domain.Loan, domain.ErrorResponse) {
 	if loanID == "" {
 		return domain.Loan{}, domain.ErrorResponse{
 			StatusCode: 400,
@@ -125,7 +525,53 @@ func (l *LoanUsecaseImpl) DeleteLoan(loanID string) (domain.Loan, domain.ErrorRe
 		}
 	}
 
-	loan, err := l.loanRepo.DeleteLoan(loanID)
+	existingLoan, err := l.loanRepo.GetLoanByID(loanID)
+	if err != nil {
+		return domain.Loan{}, domain.ErrorResponse{
+			StatusCode: 404,
+			Message:    "Loan not found",
+		}
+	}
+	for _, status := range domain.ActiveLoanStatuses {
+		if existingLoan.Status == status {
+			return domain.Loan{}, domain.ErrorResponse{
+				StatusCode: 409,
+				Message:    "Cannot delete a loan that is " + existingLoan.Status,
+			}
+		}
+	}
+
+	loan, err := l.loanRepo.SoftDeleteLoan(loanID, actorID, time.Now())
+	if err == mongo.ErrNoDocuments {
+		return domain.Loan{}, domain.ErrorResponse{
+			StatusCode: 404,
+			Message:    "Loan not found",
+		}
+	}
+	if err != nil {
+		return domain.Loan{}, domain.ErrorResponse{
+			StatusCode: 500,
+			Message:    "Internal Server Error",
+		}
+	}
+
+	l.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Loan Deleted",
+		Details:   "Admin " + actorID + " deleted loan " + loanID,
+	})
+
+	return loan, domain.ErrorResponse{}
+}
+
+func (l *LoanUsecaseImpl) RestoreLoan(actorID, loanID string) (domain.Loan, domain.ErrorResponse) {
+	loan, err := l.loanRepo.RestoreLoan(loanID)
+	if err == mongo.ErrNoDocuments {
+		return domain.Loan{}, domain.ErrorResponse{
+			StatusCode: 404,
+			Message:    "Deleted loan not found",
+		}
+	}
 	if err != nil {
 		return domain.Loan{}, domain.ErrorResponse{
 			StatusCode: 500,
@@ -133,5 +579,11 @@ func (l *LoanUsecaseImpl) DeleteLoan(loanID string) (domain.Loan, domain.ErrorRe
 		}
 	}
 
+	l.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Loan Restored",
+		Details:   "Admin " + actorID + " restored loan " + loanID,
+	})
+
 	return loan, domain.ErrorResponse{}
 }
\ No newline at end of file
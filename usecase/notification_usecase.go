@@ -0,0 +1,73 @@
+package usecase
+
+import (
+	"context"
+	"loan-tracker-api/domain"
+	"time"
+)
+
+type NotificationUsecaseImpl struct {
+	userRepo   domain.UserRepository
+	renderer   domain.EmailRenderer
+	outboxRepo domain.OutboxRepository
+}
+
+func NewNotificationUsecase(userRepo domain.UserRepository, renderer domain.EmailRenderer, outboxRepo domain.OutboxRepository) domain.NotificationUsecase {
+	return &NotificationUsecaseImpl{
+		userRepo:   userRepo,
+		renderer:   renderer,
+		outboxRepo: outboxRepo,
+	}
+}
+
+func (n *NotificationUsecaseImpl) SendEmail(ctx context.Context, recipient domain.User, templateName string, data map[string]interface{}) error {
+	values := map[string]interface{}{"Username": recipient.Username, "Email": recipient.Email}
+	for key, value := range data {
+		values[key] = value
+	}
+
+	message, err := n.renderer.Render(templateName, recipient.PreferredLanguage, values)
+	if err != nil {
+		return err
+	}
+	message.To = recipient.Email
+
+	now := time.Now()
+	_, err = n.outboxRepo.Enqueue(ctx, domain.OutboxMessage{
+		Template:      templateName,
+		Email:         message,
+		Status:        domain.OutboxPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	})
+	return err
+}
+
+func (n *NotificationUsecaseImpl) NotifyUser(ctx context.Context, userID, templateName string, data map[string]interface{}) error {
+	user, err := n.userRepo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	return n.SendEmail(ctx, user, templateName, data)
+}
+
+func (n *NotificationUsecaseImpl) ListEmailTemplates() domain.EmailTemplateCatalog {
+	return n.renderer.Catalog()
+}
+
+func (n *NotificationUsecaseImpl) PreviewEmail(templateName, locale string) (domain.EmailMessage, domain.ErrorResponse) {
+	known := false
+	for _, name := range n.renderer.Catalog().Templates {
+		known = known || name == templateName
+	}
+	if !known {
+		return domain.EmailMessage{}, domain.ErrorResponse{StatusCode: 404, Message: "Email template not found"}
+	}
+
+	message, err := n.renderer.Preview(templateName, locale)
+	if err != nil {
+		return domain.EmailMessage{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to render email template: " + err.Error()}
+	}
+	return message, domain.ErrorResponse{}
+}
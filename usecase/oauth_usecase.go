@@ -0,0 +1,211 @@
+package usecase
+
+import (
+	"context"
+	"crypto/subtle"
+	"loan-tracker-api/domain"
+	"loan-tracker-api/infrastracture"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (u *UserUsecase) StartOAuthLogin() (domain.OAuthStart, domain.ErrorResponse) {
+	flow, err := infrastracture.NewOAuthFlow()
+	if err != nil {
+		return domain.OAuthStart{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to start sign-in"}
+	}
+
+	return domain.OAuthStart{
+		AuthURL: u.OAuthClient.AuthCodeURL(flow.State, flow.Nonce, infrastracture.PKCEChallenge(flow.CodeVerifier)),
+		Flow:    flow,
+	}, domain.ErrorResponse{}
+}
+
+// OAuthLogin finishes a provider sign-in. The account is found by its provider ID first, then by
+// a verified email, which links the two; otherwise a new, already activated account is created.
+func (u *UserUsecase) OAuthLogin(callback domain.OAuthCallback, deviceID, clientIP string) (domain.LogInResponse, domain.ErrorResponse) {
+	if callback.Flow.State == "" || subtle.ConstantTimeCompare([]byte(callback.State), []byte(callback.Flow.State)) != 1 {
+		return domain.LogInResponse{}, domain.ErrorResponse{StatusCode: 400, Message: "Invalid or expired sign-in request"}
+	}
+	if callback.Code == "" {
+		return domain.LogInResponse{}, domain.ErrorResponse{StatusCode: 400, Message: "Authorization code is missing"}
+	}
+
+	identity, err := u.OAuthClient.Exchange(callback.Code, callback.Flow.CodeVerifier, callback.Flow.Nonce)
+	if err != nil {
+		log.Printf("OAuth code exchange failed: %v", err)
+		return domain.LogInResponse{}, domain.ErrorResponse{StatusCode: 401, Message: "Sign-in with the provider failed"}
+	}
+
+	user, errResp := u.oauthUser(identity)
+	if errResp.Message != "" {
+		return domain.LogInResponse{}, errResp
+	}
+
+	if errResp := accountBlocked(user); errResp.Message != "" {
+		return domain.LogInResponse{}, errResp
+	}
+
+	u.LogRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Login Attempt",
+		Details:   "User " + user.Email + " logged in with " + string(identity.Provider) + " from " + clientIP,
+	})
+
+	// the provider proves who the user is, not that they hold the second factor
+	if user.TwoFactorEnabled {
+		challengeToken, err := u.TokenGen.GenerateChallengeToken(user)
+		if err != nil {
+			return domain.LogInResponse{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to generate challenge token"}
+		}
+
+		return domain.LogInResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    challengeToken,
+		}, domain.ErrorResponse{}
+	}
+
+	return u.issueTokens(&user, deviceID)
+}
+
+func (u *UserUsecase) oauthUser(identity domain.OAuthIdentity) (domain.User, domain.ErrorResponse) {
+	if user, err := u.UserRepo.GetUserByGoogleID(identity.Subject); err == nil {
+		return user, domain.ErrorResponse{}
+	}
+
+	// an unverified address could belong to someone else, so it must never reach an existing account
+	if !identity.EmailVerified || !infrastracture.IsValidEmail(identity.Email) {
+		return domain.User{}, domain.ErrorResponse{StatusCode: 403, Message: "Your Google account email address is not verified"}
+	}
+
+	if user, err := u.UserRepo.GetUserByEmail(identity.Email); err == nil {
+		if user.GoogleID != "" {
+			return domain.User{}, domain.ErrorResponse{StatusCode: 409, Message: "This account is linked to another Google account"}
+		}
+
+		// an account that was never activated was registered by someone who never proved they own
+		// the address, so the password they chose must not survive the provider confirming it
+		user.GoogleID = identity.Subject
+		user.UpdatedAt = primitive.Timestamp{T: uint32(time.Now().Unix())}
+		// the account must still be unlinked, and in the activation state the decision was made on
+		change := domain.UserChange{
+			Set:   map[string]interface{}{"google_id": user.GoogleID, "updatedAt": user.UpdatedAt},
+			Where: map[string]interface{}{"google_id": nil, "is_active": user.IsActive},
+		}
+
+		reclaimed := !user.IsActive
+		if reclaimed {
+			hashedPassword, err := u.randomPasswordHash()
+			if err != nil {
+				return domain.User{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to reset password"}
+			}
+			user.Password = hashedPassword
+			user.IsActive = true
+			user.ActivationToken = ""
+			user.PasswordResetToken = ""
+			change.Set["password"] = hashedPassword
+			change.Set["is_active"] = true
+			change.Set["activation_token"] = ""
+			change.Set["password_reset_token"] = ""
+		}
+
+		err := u.UserRepo.UpdateUser(context.Background(), user.ID, change)
+		if err == mongo.ErrNoDocuments {
+			return domain.User{}, domain.ErrorResponse{StatusCode: 409, Message: "The account changed during sign-in, please try again"}
+		}
+		if err != nil {
+			return domain.User{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to update user"}
+		}
+		if reclaimed {
+			if err := u.UserRepo.DeleteAllRefreshTokens(context.Background(), &user); err != nil {
+				return domain.User{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to end sessions"}
+			}
+			if err := u.RevocationStore.RevokeUserTokens(user.ID.Hex(), time.Now()); err != nil {
+				return domain.User{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to revoke access tokens"}
+			}
+		}
+
+		u.LogRepo.CreateLog(domain.SystemLog{
+			Timestamp: time.Now().String(),
+			Event:     "Account Linked",
+			Details:   "User " + user.Email + " linked their " + string(identity.Provider) + " account",
+		})
+		return user, domain.ErrorResponse{}
+	}
+
+	return u.createOAuthUser(identity)
+}
+
+func (u *UserUsecase) createOAuthUser(identity domain.OAuthIdentity) (domain.User, domain.ErrorResponse) {
+	username, err := u.availableUsername(identity.Email)
+	if err != nil {
+		return domain.User{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to create user account"}
+	}
+
+	hashedPassword, err := u.randomPasswordHash()
+	if err != nil {
+		return domain.User{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to generate password"}
+	}
+
+	user := domain.User{
+		ID:        primitive.NewObjectID(),
+		Username:  username,
+		Email:     identity.Email,
+		Password:  hashedPassword,
+		Role:      string(domain.UserRole),
+		IsActive:  true,
+		GoogleID:  identity.Subject,
+		CreatedAt: primitive.Timestamp{T: uint32(time.Now().Unix())},
+	}
+	if err := u.UserRepo.Register(context.Background(), user); err != nil {
+		return domain.User{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to create user account"}
+	}
+
+	u.LogRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "User Registered",
+		Details:   "User " + user.Email + " signed up with " + string(identity.Provider),
+	})
+	return user, domain.ErrorResponse{}
+}
+
+// randomPasswordHash hashes a random password that is never handed out. Accounts that sign in
+// through the provider can still set a password later through the reset flow.
+func (u *UserUsecase) randomPasswordHash() (string, error) {
+	random, err := infrastracture.GenerateActivationToken()
+	if err != nil {
+		return "", err
+	}
+	return u.PasswordSvc.HashPassword(random)
+}
+
+// availableUsername derives a username from the email's local part, adding a random suffix when
+// that name is taken.
+func (u *UserUsecase) availableUsername(email string) (string, error) {
+	base := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-' {
+			return r
+		}
+		return -1
+	}, strings.ToLower(strings.SplitN(email, "@", 2)[0]))
+	if base == "" {
+		base = "user"
+	}
+
+	username := base
+	for attempt := 0; attempt < 5; attempt++ {
+		if _, err := u.UserRepo.GetUserByUsername(username); err != nil {
+			return username, nil
+		}
+		suffix, err := infrastracture.GenerateActivationToken()
+		if err != nil {
+			return "", err
+		}
+		username = base + "-" + suffix[:6]
+	}
+	return username, nil
+}
@@ -0,0 +1,487 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"loan-tracker-api/config"
+	"loan-tracker-api/domain"
+	"loan-tracker-api/infrastracture"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	testClientID    = "loan-tracker-test"
+	testRedirectURL = "http://app.test/auth/google/callback"
+)
+
+// fakeOIDCProvider is an OpenID Connect server with an authorization and a token endpoint. It
+// checks PKCE and the client credentials the way a real provider would and signs the user in as
+// identity.
+type fakeOIDCProvider struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	identity      map[string]interface{}
+	wrongNonce    bool
+	tokenRequests int
+	codes         map[string]authorization
+}
+
+type authorization struct {
+	nonce         string
+	codeChallenge string
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	p := &fakeOIDCProvider{codes: map[string]authorization{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *fakeOIDCProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != testClientID || query.Get("redirect_uri") != testRedirectURL ||
+		query.Get("code_challenge_method") != "S256" || query.Get("response_type") != "code" {
+		http.Error(w, "bad authorization request", http.StatusBadRequest)
+		return
+	}
+
+	p.mu.Lock()
+	code := fmt.Sprintf("code-%d", len(p.codes))
+	p.codes[code] = authorization{nonce: query.Get("nonce"), codeChallenge: query.Get("code_challenge")}
+	p.mu.Unlock()
+
+	callback := url.Values{"code": {code}, "state": {query.Get("state")}}
+	http.Redirect(w, r, testRedirectURL+"?"+callback.Encode(), http.StatusFound)
+}
+
+func (p *fakeOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tokenRequests++
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad form", http.StatusBadRequest)
+		return
+	}
+	auth, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("client_id") != testClientID ||
+		r.PostForm.Get("redirect_uri") != testRedirectURL ||
+		base64.RawURLEncoding.EncodeToString(challenge[:]) != auth.codeChallenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	claims := map[string]interface{}{
+		"iss":   p.URL,
+		"aud":   testClientID,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": auth.nonce,
+	}
+	if p.wrongNonce {
+		claims["nonce"] = "another-login"
+	}
+	for name, value := range p.identity {
+		claims[name] = value
+	}
+	payload, _ := json.Marshal(claims)
+	idToken := "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(payload) + ".c2lnbmF0dXJl"
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "id_token": idToken})
+}
+
+// useProviderConfig loads a config file that points Google sign-in at the fake provider.
+func useProviderConfig(t *testing.T, provider *fakeOIDCProvider) {
+	t.Helper()
+	dir := t.TempDir()
+	settings := fmt.Sprintf("GOOGLE_CLIENT_ID=%s\nGOOGLE_CLIENT_SECRET=secret\nGOOGLE_REDIRECT_URL=%s\n"+
+		"GOOGLE_ISSUER=%s\nGOOGLE_AUTH_URL=%s/authorize\nGOOGLE_TOKEN_URL=%s/token\n",
+		testClientID, testRedirectURL, provider.URL, provider.URL, provider.URL)
+	if err := os.WriteFile(filepath.Join(dir, "app.env"), []byte(settings), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	previous := config.EnvConfigs
+	config.InitiEnvConfigs()
+	t.Cleanup(func() { config.EnvConfigs = previous })
+}
+
+type fakeUserRepo struct {
+	domain.UserRepository
+	users         map[string]*domain.User
+	registered    []domain.User
+	sessionsEnded []string
+	refreshTokens map[primitive.ObjectID]int
+}
+
+func newFakeUserRepo(users ...domain.User) *fakeUserRepo {
+	repo := &fakeUserRepo{users: map[string]*domain.User{}, refreshTokens: map[primitive.ObjectID]int{}}
+	for i := range users {
+		user := users[i]
+		repo.users[user.Email] = &user
+	}
+	return repo
+}
+
+func (r *fakeUserRepo) find(match func(domain.User) bool) (domain.User, error) {
+	for _, user := range r.users {
+		if match(*user) {
+			return *user, nil
+		}
+	}
+	return domain.User{}, mongo.ErrNoDocuments
+}
+
+func (r *fakeUserRepo) GetUserByGoogleID(googleID string) (domain.User, error) {
+	return r.find(func(u domain.User) bool { return u.GoogleID != "" && u.GoogleID == googleID })
+}
+
+func (r *fakeUserRepo) GetUserByEmail(email string) (domain.User, error) {
+	return r.find(func(u domain.User) bool { return u.Email == email })
+}
+
+func (r *fakeUserRepo) GetUserByUsername(username string) (domain.User, error) {
+	return r.find(func(u domain.User) bool { return u.Username == username })
+}
+
+func (r *fakeUserRepo) Register(ctx context.Context, user domain.User) error {
+	r.registered = append(r.registered, user)
+	r.users[user.Email] = &user
+	return nil
+}
+
+// UpdateUser applies the change to the stored document the way the Mongo filter and $set would.
+func (r *fakeUserRepo) UpdateUser(ctx context.Context, userID primitive.ObjectID, change domain.UserChange) error {
+	for email, user := range r.users {
+		if user.ID != userID {
+			continue
+		}
+
+		doc := bson.M{}
+		data, _ := bson.Marshal(user)
+		if err := bson.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		for field, want := range change.Where {
+			if got, ok := doc[field]; (want == nil && ok) || (want != nil && got != want) {
+				return mongo.ErrNoDocuments
+			}
+		}
+		for field, value := range change.Set {
+			doc[field] = value
+		}
+
+		var updated domain.User
+		data, _ = bson.Marshal(doc)
+		if err := bson.Unmarshal(data, &updated); err != nil {
+			return err
+		}
+		delete(r.users, email)
+		r.users[updated.Email] = &updated
+		return nil
+	}
+	return mongo.ErrNoDocuments
+}
+
+func (r *fakeUserRepo) DeleteAllRefreshTokens(ctx context.Context, user *domain.User) error {
+	r.sessionsEnded = append(r.sessionsEnded, user.ID.Hex())
+	r.refreshTokens[user.ID] = 0
+	return nil
+}
+
+func (r *fakeUserRepo) AddRefreshToken(userID primitive.ObjectID, token domain.RefreshToken) error {
+	r.refreshTokens[userID]++
+	return nil
+}
+
+type fakeRevocationStore struct {
+	domain.TokenRevocationStore
+	revokedUsers []string
+}
+
+func (s *fakeRevocationStore) RevokeUserTokens(userID string, issuedBefore time.Time) error {
+	s.revokedUsers = append(s.revokedUsers, userID)
+	return nil
+}
+
+type fakeTokenGen struct{ domain.TokenGenerator }
+
+func (fakeTokenGen) GenerateToken(user domain.User) (string, error) {
+	return "access-" + user.Username, nil
+}
+func (fakeTokenGen) GenerateRefreshToken(user domain.User) (string, error) {
+	return "refresh-" + user.Username, nil
+}
+func (fakeTokenGen) GenerateChallengeToken(user domain.User) (string, error) {
+	return "challenge-" + user.Username, nil
+}
+
+type fakePasswordService struct{ domain.PasswordService }
+
+func (fakePasswordService) HashPassword(password string) (string, error) {
+	return "hash:" + password, nil
+}
+
+type fakeLogRepo struct{ domain.LogRepository }
+
+func (fakeLogRepo) CreateLog(log domain.SystemLog) error { return nil }
+
+type fakeLoginThrottle struct{ domain.LoginThrottle }
+
+func (fakeLoginThrottle) RegisterSuccess(email string) error { return nil }
+
+// signInWithProvider runs the browser's part of the flow: it follows the authorization URL to the
+// provider and returns the callback the provider redirects back with.
+func signInWithProvider(t *testing.T, authURL string) (state, code string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorization endpoint answered %s", resp.Status)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query().Get("state"), location.Query().Get("code")
+}
+
+func TestOAuthLogin(t *testing.T) {
+	provider := newFakeOIDCProvider(t)
+	useProviderConfig(t, provider)
+
+	inactive := domain.User{ID: primitive.NewObjectID(), Username: "mallory", Email: "victim@example.com",
+		Password: "hash:chosen-by-mallory", ActivationToken: "pending", Role: "user"}
+	active := domain.User{ID: primitive.NewObjectID(), Username: "victim", Email: "victim@example.com",
+		Password: "hash:own-password", IsActive: true, Role: "user"}
+	linked := domain.User{ID: primitive.NewObjectID(), Username: "linked", Email: "linked@example.com",
+		IsActive: true, Role: "user", GoogleID: "google-linked"}
+
+	verified := func(sub, email string) map[string]interface{} {
+		return map[string]interface{}{"sub": sub, "email": email, "email_verified": true, "name": "Test"}
+	}
+
+	tests := []struct {
+		name          string
+		users         []domain.User
+		identity      map[string]interface{}
+		tamperState   bool
+		wrongNonce    bool
+		wantStatus    int
+		wantChallenge bool
+		check         func(t *testing.T, repo *fakeUserRepo, revocations *fakeRevocationStore)
+	}{
+		{
+			name:     "new user is created and activated",
+			identity: verified("google-new", "newcomer@example.com"),
+			check: func(t *testing.T, repo *fakeUserRepo, revocations *fakeRevocationStore) {
+				if len(repo.registered) != 1 {
+					t.Fatalf("registered %d users, want 1", len(repo.registered))
+				}
+				user := repo.registered[0]
+				if user.GoogleID != "google-new" || !user.IsActive || user.Username != "newcomer" {
+					t.Errorf("created user = %+v", user)
+				}
+			},
+		},
+		{
+			name:     "user linked before signs in by Google ID",
+			users:    []domain.User{linked},
+			identity: map[string]interface{}{"sub": "google-linked", "email": "changed@example.com"},
+			check: func(t *testing.T, repo *fakeUserRepo, revocations *fakeRevocationStore) {
+				if len(repo.registered) != 0 {
+					t.Error("a second account was created")
+				}
+			},
+		},
+		{
+			name:     "verified email links an active account and keeps its password",
+			users:    []domain.User{active},
+			identity: verified("google-victim", "victim@example.com"),
+			check: func(t *testing.T, repo *fakeUserRepo, revocations *fakeRevocationStore) {
+				user := repo.users["victim@example.com"]
+				if user.GoogleID != "google-victim" || user.Password != active.Password {
+					t.Errorf("linked user = %+v", *user)
+				}
+				if len(revocations.revokedUsers) != 0 || len(repo.sessionsEnded) != 0 {
+					t.Error("the sessions of an active account were ended")
+				}
+			},
+		},
+		{
+			name:     "verified email reclaims an inactive account from whoever registered it",
+			users:    []domain.User{inactive},
+			identity: verified("google-victim", "victim@example.com"),
+			check: func(t *testing.T, repo *fakeUserRepo, revocations *fakeRevocationStore) {
+				user := repo.users["victim@example.com"]
+				if user.Password == inactive.Password {
+					t.Error("the password chosen at registration survived")
+				}
+				if !user.IsActive || user.ActivationToken != "" || user.GoogleID != "google-victim" {
+					t.Errorf("reclaimed user = %+v", *user)
+				}
+				if len(repo.sessionsEnded) != 1 || len(revocations.revokedUsers) != 1 || revocations.revokedUsers[0] != inactive.ID.Hex() {
+					t.Errorf("sessions ended for %v, tokens revoked for %v", repo.sessionsEnded, revocations.revokedUsers)
+				}
+			},
+		},
+		{
+			name:       "unverified email never reaches an existing account",
+			users:      []domain.User{active},
+			identity:   map[string]interface{}{"sub": "google-attacker", "email": "victim@example.com", "email_verified": false},
+			wantStatus: 403,
+			check: func(t *testing.T, repo *fakeUserRepo, revocations *fakeRevocationStore) {
+				if user := repo.users["victim@example.com"]; user.GoogleID != "" {
+					t.Errorf("account was linked to %q", user.GoogleID)
+				}
+			},
+		},
+		{
+			name:     "email verified as a string is accepted",
+			identity: map[string]interface{}{"sub": "google-string", "email": "string@example.com", "email_verified": "true"},
+		},
+		{
+			name:       "account linked to another Google account",
+			users:      []domain.User{linked},
+			identity:   verified("google-other", "linked@example.com"),
+			wantStatus: 409,
+		},
+		{
+			name:          "two-factor users get a challenge instead of tokens",
+			users:         []domain.User{{ID: primitive.NewObjectID(), Username: "careful", Email: "careful@example.com", IsActive: true, TwoFactorEnabled: true, GoogleID: "google-careful"}},
+			identity:      verified("google-careful", "careful@example.com"),
+			wantChallenge: true,
+			check: func(t *testing.T, repo *fakeUserRepo, revocations *fakeRevocationStore) {
+				if len(repo.refreshTokens) != 0 {
+					t.Error("a session was started before the second factor")
+				}
+			},
+		},
+		{
+			name:        "state that does not match the flow",
+			identity:    verified("google-new", "newcomer@example.com"),
+			tamperState: true,
+			wantStatus:  400,
+		},
+		{
+			name:       "ID token of another login",
+			identity:   verified("google-new", "newcomer@example.com"),
+			wrongNonce: true,
+			wantStatus: 401,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider.mu.Lock()
+			provider.identity = tt.identity
+			provider.wrongNonce = tt.wrongNonce
+			provider.tokenRequests = 0
+			provider.mu.Unlock()
+
+			repo := newFakeUserRepo(tt.users...)
+			revocations := &fakeRevocationStore{}
+			usecase := &UserUsecase{
+				UserRepo:        repo,
+				TokenGen:        fakeTokenGen{},
+				PasswordSvc:     fakePasswordService{},
+				LogRepo:         fakeLogRepo{},
+				RevocationStore: revocations,
+				LoginThrottle:   fakeLoginThrottle{},
+				OAuthClient:     infrastracture.NewGoogleOAuthClient(),
+			}
+
+			start, errResp := usecase.StartOAuthLogin()
+			if errResp.Message != "" {
+				t.Fatalf("StartOAuthLogin: %s", errResp.Message)
+			}
+			state, code := signInWithProvider(t, start.AuthURL)
+			if tt.tamperState {
+				state = "forged"
+			}
+
+			response, errResp := usecase.OAuthLogin(domain.OAuthCallback{State: state, Code: code, Flow: start.Flow}, "device", "127.0.0.1")
+			if errResp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d (%s), want %d", errResp.StatusCode, errResp.Message, tt.wantStatus)
+			}
+			if tt.tamperState && provider.tokenRequests != 0 {
+				t.Error("the code was redeemed despite the state mismatch")
+			}
+			if tt.wantStatus == 0 {
+				if tt.wantChallenge {
+					if !response.TwoFactorRequired || response.ChallengeToken == "" || response.AccessToken != "" {
+						t.Errorf("response = %+v, want a two-factor challenge", response)
+					}
+				} else if response.AccessToken == "" || response.RefreshToken == "" {
+					t.Errorf("response = %+v, want tokens", response)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, repo, revocations)
+			}
+		})
+	}
+}
+
+// A code can be redeemed once; replaying the callback fails at the provider.
+func TestOAuthLoginRejectsReplayedCode(t *testing.T) {
+	provider := newFakeOIDCProvider(t)
+	useProviderConfig(t, provider)
+	provider.identity = map[string]interface{}{"sub": "google-new", "email": "newcomer@example.com", "email_verified": true}
+
+	usecase := &UserUsecase{
+		UserRepo:        newFakeUserRepo(),
+		TokenGen:        fakeTokenGen{},
+		PasswordSvc:     fakePasswordService{},
+		LogRepo:         fakeLogRepo{},
+		RevocationStore: &fakeRevocationStore{},
+		LoginThrottle:   fakeLoginThrottle{},
+		OAuthClient:     infrastracture.NewGoogleOAuthClient(),
+	}
+
+	start, _ := usecase.StartOAuthLogin()
+	state, code := signInWithProvider(t, start.AuthURL)
+	callback := domain.OAuthCallback{State: state, Code: code, Flow: start.Flow}
+
+	if _, errResp := usecase.OAuthLogin(callback, "device", "127.0.0.1"); errResp.Message != "" {
+		t.Fatalf("first sign-in failed: %s", errResp.Message)
+	}
+	if _, errResp := usecase.OAuthLogin(callback, "device", "127.0.0.1"); errResp.StatusCode != 401 {
+		t.Errorf("replayed callback: status = %d, want 401", errResp.StatusCode)
+	}
+}
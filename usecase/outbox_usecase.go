@@ -0,0 +1,160 @@
+package usecase
+
+import (
+	"loan-tracker-api/config"
+	"loan-tracker-api/domain"
+	"log"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultOutboxMaxAttempts = 8
+	defaultOutboxBackoff     = 30 * time.Second
+	maxOutboxBackoff         = 6 * time.Hour
+	// outboxLease is how long a claimed message is hidden from other workers while it is being sent
+	outboxLease = 2 * time.Minute
+)
+
+type OutboxUsecaseImpl struct {
+	outboxRepo  domain.OutboxRepository
+	mailer      domain.Mailer
+	logRepo     domain.LogRepository
+	maxAttempts int
+	backoff     time.Duration
+}
+
+func NewOutboxUsecase(outboxRepo domain.OutboxRepository, mailer domain.Mailer, logRepo domain.LogRepository) domain.OutboxUsecase {
+	maxAttempts := config.EnvConfigs.OutboxMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultOutboxMaxAttempts
+	}
+	backoff := time.Duration(config.EnvConfigs.OutboxBackoffSeconds) * time.Second
+	if backoff <= 0 {
+		backoff = defaultOutboxBackoff
+	}
+
+	return &OutboxUsecaseImpl{
+		outboxRepo:  outboxRepo,
+		mailer:      mailer,
+		logRepo:     logRepo,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+	}
+}
+
+func (o *OutboxUsecaseImpl) DeliverDue(now time.Time) (int, domain.ErrorResponse) {
+	delivered := 0
+	for {
+		message, err := o.outboxRepo.ClaimNext(now, outboxLease)
+		if err == mongo.ErrNoDocuments {
+			return delivered, domain.ErrorResponse{}
+		}
+		if err != nil {
+			return delivered, domain.ErrorResponse{StatusCode: 500, Message: "Failed to claim outbox message"}
+		}
+
+		if err := o.mailer.Send(message.Email); err != nil {
+			o.scheduleRetry(message, err)
+			continue
+		}
+
+		if err := o.outboxRepo.MarkSent(message, time.Now()); err == mongo.ErrNoDocuments {
+			log.Printf("Outbox message %s was sent after its lease ran out; another worker owns it now", message.ID.Hex())
+		} else if err != nil {
+			log.Printf("Error marking outbox message %s as sent: %v", message.ID.Hex(), err)
+		}
+		delivered++
+	}
+}
+
+// scheduleRetry backs off exponentially from the configured base delay, and dead-letters the
+// message once it has used up its attempts.
+func (o *OutboxUsecaseImpl) scheduleRetry(message domain.OutboxMessage, sendErr error) {
+	if message.Attempts >= o.maxAttempts {
+		log.Printf("Giving up on outbox message %s to %s after %d attempts: %v", message.ID.Hex(), message.Email.To, message.Attempts, sendErr)
+		if err := o.outboxRepo.MarkFailed(message, domain.OutboxDead, sendErr.Error(), message.NextAttemptAt); err == mongo.ErrNoDocuments {
+			// the lease ran out and another worker is trying again, so the message is not dead
+			return
+		} else if err != nil {
+			log.Printf("Error dead-lettering outbox message %s: %v", message.ID.Hex(), err)
+		}
+		o.logRepo.CreateLog(domain.SystemLog{
+			Timestamp: time.Now().String(),
+			Event:     "Email Dead-Lettered",
+			Details:   "Outbox message " + message.ID.Hex() + " (" + message.Template + ") to " + message.Email.To + " failed " + strconv.Itoa(message.Attempts) + " times: " + sendErr.Error(),
+		})
+		return
+	}
+
+	delay := o.backoff << (message.Attempts - 1)
+	if delay > maxOutboxBackoff || delay <= 0 {
+		delay = maxOutboxBackoff
+	}
+	if err := o.outboxRepo.MarkFailed(message, domain.OutboxPending, sendErr.Error(), time.Now().Add(delay)); err != nil && err != mongo.ErrNoDocuments {
+		log.Printf("Error rescheduling outbox message %s: %v", message.ID.Hex(), err)
+	}
+}
+
+func (o *OutboxUsecaseImpl) GetMessages(status, page, limit string) ([]domain.OutboxMessage, int64, domain.ErrorResponse) {
+	if status != "" && status != domain.OutboxPending && status != domain.OutboxProcessing && status != domain.OutboxSent && status != domain.OutboxDead {
+		return nil, 0, domain.ErrorResponse{StatusCode: 400, Message: "Invalid status"}
+	}
+
+	pageNumber, err := strconv.Atoi(page)
+	if err != nil || pageNumber < 1 {
+		return nil, 0, domain.ErrorResponse{StatusCode: 400, Message: "Invalid page"}
+	}
+	limitNumber, err := strconv.Atoi(limit)
+	if err != nil || limitNumber < 1 || limitNumber > 100 {
+		return nil, 0, domain.ErrorResponse{StatusCode: 400, Message: "Limit must be between 1 and 100"}
+	}
+
+	messages, total, err := o.outboxRepo.GetMessages(status, pageNumber, limitNumber)
+	if err != nil {
+		return nil, 0, domain.ErrorResponse{StatusCode: 500, Message: "Internal Server Error"}
+	}
+	for i := range messages {
+		messages[i] = withoutBody(messages[i])
+	}
+	return messages, total, domain.ErrorResponse{}
+}
+
+// withoutBody removes the rendered bodies before a message leaves the API. They hold the raw
+// activation, password reset and email change links, which would let anyone reading the outbox
+// take over the recipient's account; the template name says which email it is.
+func withoutBody(message domain.OutboxMessage) domain.OutboxMessage {
+	message.Email.HTMLBody = ""
+	message.Email.TextBody = ""
+	return message
+}
+
+func (o *OutboxUsecaseImpl) GetMessageByID(id string) (domain.OutboxMessage, domain.ErrorResponse) {
+	message, err := o.outboxRepo.GetMessageByID(id)
+	if err != nil {
+		return domain.OutboxMessage{}, domain.ErrorResponse{StatusCode: 404, Message: "Outbox message not found"}
+	}
+	return withoutBody(message), domain.ErrorResponse{}
+}
+
+func (o *OutboxUsecaseImpl) RedriveMessage(adminID, id string) (domain.OutboxMessage, domain.ErrorResponse) {
+	message, err := o.outboxRepo.Redrive(id, time.Now())
+	if err == mongo.ErrNoDocuments {
+		if _, err := o.outboxRepo.GetMessageByID(id); err == nil {
+			return domain.OutboxMessage{}, domain.ErrorResponse{StatusCode: 409, Message: "Only dead-lettered messages can be re-driven"}
+		}
+	}
+	if err != nil {
+		return domain.OutboxMessage{}, domain.ErrorResponse{StatusCode: 404, Message: "Outbox message not found"}
+	}
+
+	o.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Email Re-driven",
+		Details:   "Admin " + adminID + " re-queued outbox message " + id + " to " + message.Email.To,
+	})
+
+	return withoutBody(message), domain.ErrorResponse{}
+}
@@ -0,0 +1,388 @@
+package usecase
+
+import (
+	"context"
+	"loan-tracker-api/domain"
+	"loan-tracker-api/config"
+	"loan-tracker-api/infrastracture"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type PaymentUsecaseImpl struct {
+	paymentRepo domain.PaymentRepository
+	loanRepo    domain.LoanRepository
+	logRepo     domain.LogRepository
+	notifier    domain.NotificationUsecase
+	transactor  domain.Transactor
+	permissions domain.PermissionResolver
+}
+
+func NewPaymentUsecase(paymentRepo domain.PaymentRepository, loanRepo domain.LoanRepository, logRepo domain.LogRepository, notifier domain.NotificationUsecase, transactor domain.Transactor, permissions domain.PermissionResolver) domain.PaymentUsecase {
+	return &PaymentUsecaseImpl{
+		paymentRepo: paymentRepo,
+		loanRepo:    loanRepo,
+		logRepo:     logRepo,
+		notifier:    notifier,
+		transactor:  transactor,
+		permissions: permissions,
+	}
+}
+
+func (p *PaymentUsecaseImpl) getOwnedLoan(userID, Role, loanID string) (domain.Loan, domain.ErrorResponse) {
+	if loanID == "" {
+		return domain.Loan{}, domain.ErrorResponse{StatusCode: 400, Message: "ID is required"}
+	}
+
+	loan, err := p.loanRepo.GetLoanByID(loanID)
+	if err != nil {
+		return domain.Loan{}, domain.ErrorResponse{StatusCode: 404, Message: "Loan not found"}
+	}
+
+	if errResp := canReadLoan(p.permissions, loan, userID, Role); errResp.Message != "" {
+		return domain.Loan{}, errResp
+	}
+
+	return loan, domain.ErrorResponse{}
+}
+
+func (p *PaymentUsecaseImpl) RecordPayment(actorID, loanID string, request domain.PaymentRequest) (domain.Payment, domain.ErrorResponse) {
+	if loanID == "" {
+		return domain.Payment{}, domain.ErrorResponse{StatusCode: 400, Message: "ID is required"}
+	}
+
+	loan, err := p.loanRepo.GetLoanByID(loanID)
+	if err != nil {
+		return domain.Payment{}, domain.ErrorResponse{StatusCode: 404, Message: "Loan not found"}
+	}
+
+	if loan.Status != domain.LoanDisbursed && loan.Status != domain.LoanActive && loan.Status != domain.LoanDefaulted {
+		return domain.Payment{}, domain.ErrorResponse{StatusCode: 400, Message: "Payments can only be recorded against disbursed loans"}
+	}
+
+	amount := infrastracture.RoundCents(request.Amount)
+	if amount <= 0 {
+		return domain.Payment{}, domain.ErrorResponse{StatusCode: 400, Message: "Amount must be greater than zero"}
+	}
+
+	outstanding := infrastracture.RoundCents(loan.Outstanding.Total())
+	if amount > outstanding {
+		return domain.Payment{}, domain.ErrorResponse{StatusCode: 400, Message: "Amount exceeds the outstanding balance"}
+	}
+
+	// fees are settled first, then interest, and whatever is left reduces the principal
+	remaining := amount
+	allocation := domain.LoanBalance{}
+	allocation.Fees = math.Min(remaining, loan.Outstanding.Fees)
+	remaining = infrastracture.RoundCents(remaining - allocation.Fees)
+	allocation.Interest = math.Min(remaining, loan.Outstanding.Interest)
+	remaining = infrastracture.RoundCents(remaining - allocation.Interest)
+	allocation.Principal = remaining
+
+	// the ledger entry, the balance, the status and the receipt change together or not at all
+	var payment domain.Payment
+	var updatedLoan domain.Loan
+	errResp := inTransaction(p.transactor, func(ctx context.Context) error {
+		var err error
+		payment, err = p.paymentRepo.CreatePayment(ctx, domain.Payment{
+			LoanID:     loanID,
+			Type:       domain.PaymentEntry,
+			Amount:     amount,
+			Allocation: allocation,
+			Note:       request.Note,
+			RecordedBy: actorID,
+			CreatedAt:  time.Now(),
+		})
+		if err != nil {
+			return abortWith(500, "Failed to record payment", err)
+		}
+
+		updatedLoan, err = p.loanRepo.AdjustLoanBalance(ctx, loanID, negateBalance(allocation))
+		if err == mongo.ErrNoDocuments {
+			return abortWith(409, "The loan balance changed while recording the payment, please retry", err)
+		}
+		if err != nil {
+			return abortWith(500, "Failed to update loan balance", err)
+		}
+
+		status := updatedLoan.Status
+		if status == domain.LoanDisbursed {
+			if err := p.transition(ctx, loanID, status, domain.LoanActive, actorID, "First repayment received"); err != nil {
+				return err
+			}
+			status = domain.LoanActive
+		}
+
+		if infrastracture.RoundCents(updatedLoan.Outstanding.Total()) <= 0 {
+			if err := p.transition(ctx, loanID, status, domain.LoanRepaid, actorID, "Outstanding balance fully repaid"); err != nil {
+				return err
+			}
+		}
+
+		err = p.notifier.NotifyUser(ctx, loan.BorrowerID, domain.EmailPaymentReceived, map[string]interface{}{
+			"LoanID":      loanID,
+			"LoanTitle":   loan.Title,
+			"PaymentID":   payment.ID.Hex(),
+			"Amount":      amount,
+			"Outstanding": infrastracture.RoundCents(updatedLoan.Outstanding.Total()),
+		})
+		if err != nil {
+			return abortWith(500, "Failed to send payment receipt", err)
+		}
+		return nil
+	})
+	if errResp.Message != "" {
+		return domain.Payment{}, errResp
+	}
+
+	return payment, domain.ErrorResponse{}
+}
+
+func (p *PaymentUsecaseImpl) GetLoanPayments(userID, Role, loanID string) ([]domain.Payment, domain.ErrorResponse) {
+	_, errResp := p.getOwnedLoan(userID, Role, loanID)
+	if errResp.Message != "" {
+		return []domain.Payment{}, errResp
+	}
+
+	payments, err := p.paymentRepo.GetPaymentsByLoanID(loanID)
+	if err != nil {
+		return []domain.Payment{}, domain.ErrorResponse{StatusCode: 500, Message: "Internal Server Error"}
+	}
+
+	return payments, domain.ErrorResponse{}
+}
+
+func (p *PaymentUsecaseImpl) ReversePayment(adminID, loanID, paymentID, reason string) (domain.Payment, domain.ErrorResponse) {
+	if reason == "" {
+		return domain.Payment{}, domain.ErrorResponse{StatusCode: 400, Message: "A reason is required to reverse a payment"}
+	}
+
+	if _, err := p.loanRepo.GetLoanByID(loanID); err != nil {
+		return domain.Payment{}, domain.ErrorResponse{StatusCode: 404, Message: "Loan not found"}
+	}
+
+	payment, err := p.paymentRepo.GetPaymentByID(paymentID)
+	if err != nil || payment.LoanID != loanID {
+		return domain.Payment{}, domain.ErrorResponse{StatusCode: 404, Message: "Payment not found"}
+	}
+
+	if payment.Type != domain.PaymentEntry {
+		return domain.Payment{}, domain.ErrorResponse{StatusCode: 400, Message: "Only payments can be reversed"}
+	}
+
+	reversal := domain.Payment{
+		ID:         primitive.NewObjectID(),
+		LoanID:     loanID,
+		Type:       domain.ReversalEntry,
+		Amount:     -payment.Amount,
+		Allocation: negateBalance(payment.Allocation),
+		Note:       reason,
+		RecordedBy: adminID,
+		ReversalOf: payment.ID.Hex(),
+		CreatedAt:  time.Now(),
+	}
+
+	// a payment marked as reversed always has its reversal entry and balance change, so a failed
+	// attempt leaves nothing behind and can be retried
+	errResp := inTransaction(p.transactor, func(ctx context.Context) error {
+		err := p.paymentRepo.MarkPaymentReversed(ctx, paymentID, reversal.ID.Hex())
+		if err == mongo.ErrNoDocuments {
+			return abortWith(409, "Payment has already been reversed", err)
+		}
+		if err != nil {
+			return abortWith(500, "Failed to record reversal", err)
+		}
+
+		if _, err := p.paymentRepo.CreatePayment(ctx, reversal); err != nil {
+			return abortWith(500, "Failed to record reversal", err)
+		}
+
+		updatedLoan, err := p.loanRepo.AdjustLoanBalance(ctx, loanID, payment.Allocation)
+		if err != nil {
+			return abortWith(500, "Failed to update loan balance", err)
+		}
+
+		// the status is judged on the balance this reversal produced, not on the loan read earlier
+		if updatedLoan.Status == domain.LoanRepaid && infrastracture.RoundCents(updatedLoan.Outstanding.Total()) > 0 {
+			return p.transition(ctx, loanID, domain.LoanRepaid, domain.LoanActive, adminID, "Payment reversed: "+reason)
+		}
+		return nil
+	})
+	if errResp.Message != "" {
+		return domain.Payment{}, errResp
+	}
+
+	p.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Payment Reversal",
+		Details:   "Admin " + adminID + " reversed payment " + paymentID + " on loan " + loanID + ": " + reason,
+	})
+
+	return reversal, domain.ErrorResponse{}
+}
+
+// transition changes the loan's status as part of a payment transaction and aborts it on failure.
+func (p *PaymentUsecaseImpl) transition(ctx context.Context, loanID, from, to, actorID, reason string) error {
+	_, err := p.loanRepo.UpdateLoanStatus(ctx, loanID, domain.LoanStatusChange{
+		From:      from,
+		To:        to,
+		ActorID:   actorID,
+		Reason:    reason,
+		Timestamp: time.Now(),
+	})
+	if err == mongo.ErrNoDocuments {
+		return abortWith(409, "Loan status was changed by another request, please retry", err)
+	}
+	if err != nil {
+		return abortWith(500, "Failed to update loan status", err)
+	}
+	return nil
+}
+
+func negateBalance(balance domain.LoanBalance) domain.LoanBalance {
+	return domain.LoanBalance{
+		Fees:      -balance.Fees,
+		Interest:  -balance.Interest,
+		Principal: -balance.Principal,
+	}
+}
+
+func (p *PaymentUsecaseImpl) SendOverdueReminders(now time.Time) (int, domain.ErrorResponse) {
+	interval := time.Duration(config.EnvConfigs.OverdueReminderIntervalHours) * time.Hour
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+
+	sent := 0
+	for _, status := range []string{domain.LoanDisbursed, domain.LoanActive} {
+		filter := domain.LoanFilter{Status: status, Page: 1, Limit: 100}
+		for {
+			page, err := p.loanRepo.SearchLoans(filter)
+			if err != nil {
+				return sent, domain.ErrorResponse{StatusCode: 500, Message: "Failed to load loans"}
+			}
+
+			for _, loan := range page.Loans {
+				if now.Sub(loan.OverdueNotifiedAt) < interval {
+					continue
+				}
+				amountDue, dueDate := overdueAmount(loan, now)
+				if amountDue <= 0 {
+					continue
+				}
+
+				lateFee := 0.0
+				late, through := lateInstallments(loan, now)
+				if late > 0 && config.EnvConfigs.LateFeeAmount > 0 {
+					lateFee = infrastracture.RoundCents(config.EnvConfigs.LateFeeAmount * float64(late))
+				}
+
+				// the reminder, the late fee it announces and the time it was sent are saved together,
+				// so none of them is repeated or lost
+				err := p.transactor.WithTransaction(func(ctx context.Context) error {
+					if lateFee > 0 {
+						if err := p.chargeLateFee(ctx, loan, through, lateFee, late, now); err != nil {
+							return err
+						}
+					}
+					err := p.notifier.NotifyUser(ctx, loan.BorrowerID, domain.EmailPaymentOverdue, map[string]interface{}{
+						"LoanID":    loan.ID.Hex(),
+						"LoanTitle": loan.Title,
+						"AmountDue": amountDue,
+						"DueDate":   dueDate,
+						"LateFee":   lateFee,
+					})
+					if err != nil {
+						return err
+					}
+					return p.loanRepo.MarkOverdueNotified(ctx, loan.ID.Hex(), now)
+				})
+				if err != nil {
+					log.Printf("Error sending overdue reminder for loan %s: %v", loan.ID.Hex(), err)
+					continue
+				}
+				sent++
+			}
+
+			if page.NextCursor == "" {
+				break
+			}
+			filter.Cursor = page.NextCursor
+		}
+	}
+
+	return sent, domain.ErrorResponse{}
+}
+
+// chargeLateFee adds the fee to the loan's balance and books it in the ledger. Another instance
+// charging the same installments first makes it fail, which skips this reminder.
+func (p *PaymentUsecaseImpl) chargeLateFee(ctx context.Context, loan domain.Loan, through time.Time, fee float64, installments int, now time.Time) error {
+	if _, err := p.loanRepo.AssessLateFees(ctx, loan.ID.Hex(), loan.LateFeesAssessedThrough, through, fee); err != nil {
+		return err
+	}
+	_, err := p.paymentRepo.CreatePayment(ctx, domain.Payment{
+		LoanID:     loan.ID.Hex(),
+		Type:       domain.FeeEntry,
+		Amount:     fee,
+		Allocation: domain.LoanBalance{Fees: fee},
+		Note:       "Late fee for " + strconv.Itoa(installments) + " overdue installment(s)",
+		CreatedAt:  now,
+	})
+	return err
+}
+
+// repaidAmount is how much of the scheduled principal and interest has been paid so far; fees
+// are left out, they aren't part of the schedule.
+func repaidAmount(loan domain.Loan) float64 {
+	scheduled := 0.0
+	for _, installment := range loan.Schedule {
+		scheduled += installment.Principal + installment.Interest
+	}
+	return scheduled - (loan.Outstanding.Principal + loan.Outstanding.Interest)
+}
+
+// overdueAmount compares what the schedule expected to be repaid by now with what has been
+// repaid, and returns the shortfall along with the due date of the oldest uncovered installment.
+func overdueAmount(loan domain.Loan, now time.Time) (float64, time.Time) {
+	repaid := repaidAmount(loan)
+
+	due := 0.0
+	var oldest time.Time
+	for _, installment := range loan.Schedule {
+		if installment.DueDate.After(now) {
+			break
+		}
+		due += installment.Principal + installment.Interest
+		if oldest.IsZero() && infrastracture.RoundCents(due-repaid) > 0 {
+			oldest = installment.DueDate
+		}
+	}
+
+	return infrastracture.RoundCents(due - repaid), oldest
+}
+
+// lateInstallments counts the installments due by now that repayments don't fully cover and that
+// no late fee was charged for yet, and returns the due date of the last of them.
+func lateInstallments(loan domain.Loan, now time.Time) (int, time.Time) {
+	repaid := repaidAmount(loan)
+
+	count := 0
+	var last time.Time
+	due := 0.0
+	for _, installment := range loan.Schedule {
+		if installment.DueDate.After(now) {
+			break
+		}
+		due += installment.Principal + installment.Interest
+		if infrastracture.RoundCents(due-repaid) > 0 && installment.DueDate.After(loan.LateFeesAssessedThrough) {
+			count++
+			last = installment.DueDate
+		}
+	}
+	return count, last
+}
@@ -0,0 +1,226 @@
+package usecase
+
+import (
+	"context"
+	"io"
+	"loan-tracker-api/config"
+	"loan-tracker-api/domain"
+	"loan-tracker-api/infrastracture"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// imageProcessingSlots bounds how many uploads are decoded and resized at once. A decoded image
+// can take tens of megabytes, so unbounded parallel uploads could exhaust memory.
+var imageProcessingSlots = make(chan struct{}, 2)
+
+// imageSlotWait is how long an upload waits for a free slot before it is turned away.
+const imageSlotWait = 10 * time.Second
+
+type ProfileImageUsecaseImpl struct {
+	userRepo  domain.UserRepository
+	blobStore domain.BlobStore
+	logRepo   domain.LogRepository
+}
+
+func NewProfileImageUsecase(userRepo domain.UserRepository, blobStore domain.BlobStore, logRepo domain.LogRepository) domain.ProfileImageUsecase {
+	return &ProfileImageUsecaseImpl{
+		userRepo:  userRepo,
+		blobStore: blobStore,
+		logRepo:   logRepo,
+	}
+}
+
+func profileImageURL(userID, version string) string {
+	baseURL := strings.TrimRight(config.EnvConfigs.PublicBaseURL, "/")
+	if baseURL == "" {
+		baseURL = "http://localhost" + config.EnvConfigs.LocalServerPort
+	}
+	// the version changes with every upload so clients never show a cached old image
+	return baseURL + "/users/" + userID + "/image?v=" + version
+}
+
+// UploadImage stores a resized copy of the image for every size in domain.ProfileImageSizes.
+// Each upload gets a fresh key prefix, so the old image stays readable until the user points at
+// the new one and is only removed afterwards. Of two concurrent uploads only the first to save
+// wins; the other gets a 409 and its files are removed, so no upload leaves orphans behind.
+func (p *ProfileImageUsecaseImpl) UploadImage(userID, contentType string, data []byte) (domain.ReturnUser, domain.ErrorResponse) {
+	if int64(len(data)) > infrastracture.ProfileImageMaxBytes() {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 413, Message: "Image is too large"}
+	}
+	if contentType != "" && !strings.HasPrefix(contentType, "image/") {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 415, Message: "Only JPEG, PNG and GIF images are supported"}
+	}
+
+	user, err := p.userRepo.GetUserByID(userID)
+	if err != nil {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 400, Message: "User not found"}
+	}
+
+	select {
+	case imageProcessingSlots <- struct{}{}:
+		defer func() { <-imageProcessingSlots }()
+	case <-time.After(imageSlotWait):
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 503, Message: "Too many image uploads in progress, please try again shortly"}
+	}
+
+	// the declared content type is only a hint; the decoders decide what the bytes really are
+	img, format, err := infrastracture.DecodeImage(data)
+	if err == infrastracture.ErrImageTooLarge {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 413, Message: "Image must not be larger than 4096x4096 pixels"}
+	}
+	if err != nil {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 415, Message: "Only JPEG, PNG and GIF images are supported"}
+	}
+
+	token, err := infrastracture.GenerateActivationToken()
+	if err != nil {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to store image"}
+	}
+	version := token[:16]
+	prefix := "profile-images/" + userID + "/" + version
+
+	storedType := "image/png"
+	if format == "jpg" {
+		storedType = "image/jpeg"
+	}
+	for size, pixels := range domain.ProfileImageSizes {
+		encoded, err := infrastracture.EncodeImage(infrastracture.ResizeToFit(img, pixels), format)
+		if err == nil {
+			err = p.blobStore.Put(prefix+"/"+size+"."+format, storedType, encoded)
+		}
+		if err != nil {
+			log.Printf("failed to store profile image of user %s: %v", userID, err)
+			p.deleteBlobs(prefix, format)
+			return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to store image"}
+		}
+	}
+
+	oldPrefix, oldFormat := user.ImageKey, user.ImageFormat
+	user.ImageKey = prefix
+	user.ImageFormat = format
+	user.Image = profileImageURL(userID, version)
+	user.UpdatedAt = primitive.Timestamp{T: uint32(time.Now().Unix())}
+	err = p.userRepo.UpdateUser(context.Background(), user.ID, domain.UserChange{
+		Set:   imageFields(user),
+		Where: map[string]interface{}{"image_key": imageKeyIs(oldPrefix)},
+	})
+	if err == mongo.ErrNoDocuments {
+		p.deleteBlobs(prefix, format)
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 409, Message: "The profile image was changed meanwhile, please try again"}
+	}
+	if err != nil {
+		p.deleteBlobs(prefix, format)
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to update user"}
+	}
+
+	if oldPrefix != "" {
+		p.deleteBlobs(oldPrefix, oldFormat)
+	}
+
+	p.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Profile Image Updated",
+		Details:   "User " + userID + " uploaded a profile image",
+	})
+
+	return toReturnUser(user), domain.ErrorResponse{}
+}
+
+func (p *ProfileImageUsecaseImpl) DeleteImage(userID string) domain.ErrorResponse {
+	user, err := p.userRepo.GetUserByID(userID)
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 400, Message: "User not found"}
+	}
+	if user.ImageKey == "" {
+		return domain.ErrorResponse{StatusCode: 404, Message: "No profile image"}
+	}
+
+	prefix, format := user.ImageKey, user.ImageFormat
+	user.ImageKey = ""
+	user.ImageFormat = ""
+	user.Image = ""
+	user.UpdatedAt = primitive.Timestamp{T: uint32(time.Now().Unix())}
+	// the files are only removed when they still are the current image
+	err = p.userRepo.UpdateUser(context.Background(), user.ID, domain.UserChange{
+		Set:   imageFields(user),
+		Where: map[string]interface{}{"image_key": prefix},
+	})
+	if err == mongo.ErrNoDocuments {
+		return domain.ErrorResponse{StatusCode: 409, Message: "The profile image was changed meanwhile, please try again"}
+	}
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to update user"}
+	}
+	p.deleteBlobs(prefix, format)
+
+	p.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Profile Image Deleted",
+		Details:   "User " + userID + " removed their profile image",
+	})
+
+	return domain.ErrorResponse{}
+}
+
+// GetImage returns the requested size of a user's image, medium when size is empty.
+func (p *ProfileImageUsecaseImpl) GetImage(userID, size string) (io.ReadCloser, string, domain.ErrorResponse) {
+	if size == "" {
+		size = domain.ImageSizeMedium
+	}
+	if _, ok := domain.ProfileImageSizes[size]; !ok {
+		return nil, "", domain.ErrorResponse{StatusCode: 400, Message: "Size must be small, medium or large"}
+	}
+
+	user, err := p.userRepo.GetUserByID(userID)
+	if err != nil || user.ImageKey == "" {
+		return nil, "", domain.ErrorResponse{StatusCode: 404, Message: "No profile image"}
+	}
+
+	reader, contentType, err := p.blobStore.Get(user.ImageKey + "/" + size + "." + user.ImageFormat)
+	if err == domain.ErrBlobNotFound {
+		return nil, "", domain.ErrorResponse{StatusCode: 404, Message: "No profile image"}
+	}
+	if err != nil {
+		log.Printf("failed to read profile image of user %s: %v", userID, err)
+		return nil, "", domain.ErrorResponse{StatusCode: 500, Message: "Failed to read image"}
+	}
+	return reader, contentType, domain.ErrorResponse{}
+}
+
+func (p *ProfileImageUsecaseImpl) deleteBlobs(prefix, format string) {
+	deleteProfileImageBlobs(p.blobStore, prefix, format)
+}
+
+// deleteProfileImageBlobs removes every size stored under prefix. Failures only leave orphaned
+// files behind, so they are logged rather than returned.
+func deleteProfileImageBlobs(blobStore domain.BlobStore, prefix, format string) {
+	for size := range domain.ProfileImageSizes {
+		if err := blobStore.Delete(prefix + "/" + size + "." + format); err != nil {
+			log.Printf("failed to delete blob %s/%s.%s: %v", prefix, size, format, err)
+		}
+	}
+}
+
+// imageKeyIs matches the image key of a user whose image is key. Accounts that never had an image
+// may lack the field instead of holding an empty key.
+func imageKeyIs(key string) interface{} {
+	if key == "" {
+		return map[string]interface{}{"$in": []interface{}{nil, ""}}
+	}
+	return key
+}
+
+// imageFields are the fields an upload or removal of the profile image changes.
+func imageFields(user domain.User) map[string]interface{} {
+	return map[string]interface{}{
+		"image_key":    user.ImageKey,
+		"image_format": user.ImageFormat,
+		"image":        user.Image,
+		"updatedAt":    user.UpdatedAt,
+	}
+}
@@ -0,0 +1,129 @@
+package usecase
+
+import (
+	"loan-tracker-api/config"
+	"loan-tracker-api/domain"
+	"log"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultDeletedRecordRetention = 2555 * 24 * time.Hour
+	purgeBatchSize                = 100
+)
+
+type RetentionUsecaseImpl struct {
+	userRepo    domain.UserRepository
+	loanRepo    domain.LoanRepository
+	paymentRepo domain.PaymentRepository
+	logRepo     domain.LogRepository
+	blobStore   domain.BlobStore
+	retention   time.Duration
+}
+
+func NewRetentionUsecase(userRepo domain.UserRepository, loanRepo domain.LoanRepository, paymentRepo domain.PaymentRepository, logRepo domain.LogRepository, blobStore domain.BlobStore) domain.RetentionUsecase {
+	retention := time.Duration(config.EnvConfigs.DeletedRecordRetentionDays) * 24 * time.Hour
+	if retention <= 0 {
+		retention = defaultDeletedRecordRetention
+	}
+
+	return &RetentionUsecaseImpl{
+		userRepo:    userRepo,
+		loanRepo:    loanRepo,
+		paymentRepo: paymentRepo,
+		logRepo:     logRepo,
+		blobStore:   blobStore,
+		retention:   retention,
+	}
+}
+
+// PurgeDeleted removes loans first, then users. A user is only purged while none of their loans
+// is active; their remaining closed loans and the payments on them go with them, so nothing is
+// left pointing at a missing borrower.
+func (r *RetentionUsecaseImpl) PurgeDeleted(now time.Time) (domain.PurgeResult, domain.ErrorResponse) {
+	result := domain.PurgeResult{}
+	cutoff := now.Add(-r.retention)
+
+	for {
+		loans, err := r.loanRepo.GetLoansDeletedBefore(cutoff, purgeBatchSize)
+		if err != nil {
+			return result, domain.ErrorResponse{StatusCode: 500, Message: "Failed to list deleted loans"}
+		}
+		for _, loan := range loans {
+			if err := r.purgeLoan(loan.ID.Hex()); err != nil {
+				log.Printf("Error purging loan %s: %v", loan.ID.Hex(), err)
+				return result, domain.ErrorResponse{StatusCode: 500, Message: "Failed to purge loan"}
+			}
+			result.Loans++
+			r.logPurge("loan " + loan.ID.Hex() + ", deleted by " + loan.DeletedBy + " on " + loan.DeletedAt.Format(time.RFC3339))
+		}
+		if len(loans) < purgeBatchSize {
+			break
+		}
+	}
+
+	// users that still have active loans stay at the front of the listing, so page past them
+	skipped := 0
+	for {
+		users, err := r.userRepo.GetUsersDeletedBefore(cutoff, skipped, purgeBatchSize)
+		if err != nil {
+			return result, domain.ErrorResponse{StatusCode: 500, Message: "Failed to list deleted users"}
+		}
+		for _, user := range users {
+			userID := user.ID.Hex()
+			activeLoans, err := r.loanRepo.CountActiveLoans(userID)
+			if err != nil {
+				return result, domain.ErrorResponse{StatusCode: 500, Message: "Failed to count active loans"}
+			}
+			if activeLoans > 0 {
+				skipped++
+				continue
+			}
+
+			loanIDs, err := r.loanRepo.GetBorrowerLoanIDs(userID)
+			if err != nil {
+				return result, domain.ErrorResponse{StatusCode: 500, Message: "Failed to list loans"}
+			}
+			for _, loanID := range loanIDs {
+				if err := r.purgeLoan(loanID); err != nil {
+					log.Printf("Error purging loan %s of user %s: %v", loanID, userID, err)
+					return result, domain.ErrorResponse{StatusCode: 500, Message: "Failed to purge loan"}
+				}
+				result.Loans++
+			}
+
+			if _, err := r.userRepo.DeleteUser(userID); err != nil {
+				log.Printf("Error purging user %s: %v", userID, err)
+				return result, domain.ErrorResponse{StatusCode: 500, Message: "Failed to purge user"}
+			}
+			if user.ImageKey != "" {
+				deleteProfileImageBlobs(r.blobStore, user.ImageKey, user.ImageFormat)
+			}
+			result.Users++
+			r.logPurge("user " + userID + " with " + strconv.Itoa(len(loanIDs)) + " loans, deleted by " + user.DeletedBy + " on " + user.DeletedAt.Format(time.RFC3339))
+		}
+		if len(users) < purgeBatchSize {
+			break
+		}
+	}
+
+	return result, domain.ErrorResponse{}
+}
+
+// purgeLoan deletes the payments before the loan, so a failure never leaves orphaned payments.
+func (r *RetentionUsecaseImpl) purgeLoan(loanID string) error {
+	if err := r.paymentRepo.DeletePaymentsByLoanID(loanID); err != nil {
+		return err
+	}
+	_, err := r.loanRepo.DeleteLoan(loanID)
+	return err
+}
+
+func (r *RetentionUsecaseImpl) logPurge(details string) {
+	r.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Record Purged",
+		Details:   "Purged " + details,
+	})
+}
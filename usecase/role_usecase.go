@@ -0,0 +1,370 @@
+package usecase
+
+import (
+	"context"
+	"loan-tracker-api/domain"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// roles are cached per process; edits made on another instance show up within this window
+const permissionCacheTTL = 30 * time.Second
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+type RoleUsecaseImpl struct {
+	roleRepo        domain.RoleRepository
+	userRepo        domain.UserRepository
+	logRepo         domain.LogRepository
+	revocationStore domain.TokenRevocationStore
+	transactor      domain.Transactor
+
+	mu       sync.Mutex
+	cache    map[string]map[string]bool
+	cachedAt time.Time
+}
+
+// NewRoleUsecase seeds the built-in roles: "user" without permissions and "admin" with all of them.
+// The admin role is refreshed on every start so permissions added later are granted to it too.
+func NewRoleUsecase(roleRepo domain.RoleRepository, userRepo domain.UserRepository, logRepo domain.LogRepository, revocationStore domain.TokenRevocationStore, transactor domain.Transactor) domain.RoleUsecase {
+	r := &RoleUsecaseImpl{
+		roleRepo:        roleRepo,
+		userRepo:        userRepo,
+		logRepo:         logRepo,
+		revocationStore: revocationStore,
+		transactor:      transactor,
+	}
+
+	now := time.Now()
+	builtIn := []domain.RoleDefinition{
+		{Name: string(domain.UserRole), Description: "Borrower", Permissions: []string{}, BuiltIn: true, CreatedAt: now, UpdatedAt: now},
+		{Name: string(domain.AdminRole), Description: "Full access", Permissions: allPermissionNames(), BuiltIn: true, CreatedAt: now, UpdatedAt: now},
+	}
+	for _, role := range builtIn {
+		if err := roleRepo.SeedRole(role); err != nil {
+			log.Printf("Error seeding role %s: %v", role.Name, err)
+		}
+	}
+	if _, err := roleRepo.UpdateRole(builtIn[1]); err != nil {
+		log.Printf("Error refreshing admin permissions: %v", err)
+	}
+
+	return r
+}
+
+func allPermissionNames() []string {
+	names := make([]string, 0, len(domain.AllPermissions))
+	for name := range domain.AllPermissions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *RoleUsecaseImpl) HasPermission(role, permission string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cache == nil || time.Since(r.cachedAt) > permissionCacheTTL {
+		roles, err := r.roleRepo.GetRoles()
+		if err != nil {
+			return false, err
+		}
+		r.cache = map[string]map[string]bool{}
+		for _, definition := range roles {
+			granted := map[string]bool{}
+			for _, p := range definition.Permissions {
+				granted[p] = true
+			}
+			r.cache[definition.Name] = granted
+		}
+		r.cachedAt = time.Now()
+	}
+
+	return r.cache[role][permission], nil
+}
+
+func (r *RoleUsecaseImpl) invalidateCache() {
+	r.mu.Lock()
+	r.cache = nil
+	r.mu.Unlock()
+}
+
+// checkGrantable stops an actor from handing out permissions they don't hold themselves.
+func (r *RoleUsecaseImpl) checkGrantable(actorRole string, permissions []string) domain.ErrorResponse {
+	for _, permission := range permissions {
+		ok, err := r.HasPermission(actorRole, permission)
+		if err != nil {
+			return domain.ErrorResponse{StatusCode: 500, Message: "Internal Server Error"}
+		}
+		if !ok {
+			return domain.ErrorResponse{StatusCode: 403, Message: "You can't grant the " + permission + " permission"}
+		}
+	}
+	return domain.ErrorResponse{}
+}
+
+func normalizePermissions(permissions []string) ([]string, domain.ErrorResponse) {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, permission := range permissions {
+		if _, ok := domain.AllPermissions[permission]; !ok {
+			return nil, domain.ErrorResponse{StatusCode: 400, Message: "Unknown permission " + permission}
+		}
+		if !seen[permission] {
+			seen[permission] = true
+			normalized = append(normalized, permission)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized, domain.ErrorResponse{}
+}
+
+func (r *RoleUsecaseImpl) GetPermissions() map[string]string {
+	return domain.AllPermissions
+}
+
+func (r *RoleUsecaseImpl) GetRoles() ([]domain.RoleDefinition, domain.ErrorResponse) {
+	roles, err := r.roleRepo.GetRoles()
+	if err != nil {
+		return nil, domain.ErrorResponse{StatusCode: 500, Message: "Internal Server Error"}
+	}
+	return roles, domain.ErrorResponse{}
+}
+
+func (r *RoleUsecaseImpl) CreateRole(actorID, actorRole string, request domain.RoleRequest) (domain.RoleDefinition, domain.ErrorResponse) {
+	if !roleNamePattern.MatchString(request.Name) {
+		return domain.RoleDefinition{}, domain.ErrorResponse{StatusCode: 400, Message: "Role name must be 2-32 lowercase letters, digits, - or _ and start with a letter"}
+	}
+
+	permissions, errResp := normalizePermissions(request.Permissions)
+	if errResp.Message != "" {
+		return domain.RoleDefinition{}, errResp
+	}
+	if errResp := r.checkGrantable(actorRole, permissions); errResp.Message != "" {
+		return domain.RoleDefinition{}, errResp
+	}
+
+	now := time.Now()
+	role, err := r.roleRepo.CreateRole(domain.RoleDefinition{
+		Name:        request.Name,
+		Description: request.Description,
+		Permissions: permissions,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return domain.RoleDefinition{}, domain.ErrorResponse{StatusCode: 409, Message: "Role already exists"}
+	}
+	if err != nil {
+		return domain.RoleDefinition{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to create role"}
+	}
+	r.invalidateCache()
+
+	r.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: now.String(),
+		Event:     "Role Created",
+		Details:   "Admin " + actorID + " created role " + role.Name,
+	})
+
+	return role, domain.ErrorResponse{}
+}
+
+func (r *RoleUsecaseImpl) UpdateRole(actorID, actorRole, name string, request domain.RoleRequest) (domain.RoleDefinition, domain.ErrorResponse) {
+	if name == string(domain.AdminRole) {
+		return domain.RoleDefinition{}, domain.ErrorResponse{StatusCode: 400, Message: "The admin role always has every permission and can't be edited"}
+	}
+	// like AssignRole: the actor must already hold every permission the role grants to its members
+	ok, err := r.CanManageRole(actorRole, name)
+	if err == mongo.ErrNoDocuments {
+		return domain.RoleDefinition{}, domain.ErrorResponse{StatusCode: 404, Message: "Role not found"}
+	}
+	if err != nil {
+		return domain.RoleDefinition{}, domain.ErrorResponse{StatusCode: 500, Message: "Internal Server Error"}
+	}
+	if !ok {
+		return domain.RoleDefinition{}, domain.ErrorResponse{StatusCode: 403, Message: "You can't edit a role with more permissions than you"}
+	}
+
+	permissions, errResp := normalizePermissions(request.Permissions)
+	if errResp.Message != "" {
+		return domain.RoleDefinition{}, errResp
+	}
+	if errResp := r.checkGrantable(actorRole, permissions); errResp.Message != "" {
+		return domain.RoleDefinition{}, errResp
+	}
+
+	role, err := r.roleRepo.UpdateRole(domain.RoleDefinition{
+		Name:        name,
+		Description: request.Description,
+		Permissions: permissions,
+		UpdatedAt:   time.Now(),
+	})
+	if err == mongo.ErrNoDocuments {
+		return domain.RoleDefinition{}, domain.ErrorResponse{StatusCode: 404, Message: "Role not found"}
+	}
+	if err != nil {
+		return domain.RoleDefinition{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to update role"}
+	}
+	r.invalidateCache()
+
+	r.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Role Updated",
+		Details:   "Admin " + actorID + " updated role " + name,
+	})
+
+	return role, domain.ErrorResponse{}
+}
+
+// DeleteRole removes a role nobody holds. The count and the delete share a transaction, and
+// assignments lock the role they hand out, so a user can't be given the role while it's deleted.
+func (r *RoleUsecaseImpl) DeleteRole(actorID, name string) domain.ErrorResponse {
+	errResp := inTransaction(r.transactor, func(ctx context.Context) error {
+		assigned, err := r.userRepo.CountUsersByRole(ctx, name)
+		if err != nil {
+			return abortWith(500, "Internal Server Error", err)
+		}
+		if assigned > 0 {
+			return abortWith(409, "Role is still assigned to users", nil)
+		}
+
+		err = r.roleRepo.DeleteRole(ctx, name)
+		if err == mongo.ErrNoDocuments {
+			return abortWith(404, "Role not found or built in", nil)
+		}
+		if err != nil {
+			return abortWith(500, "Failed to delete role", err)
+		}
+		return nil
+	})
+	if errResp.Message != "" {
+		return errResp
+	}
+	r.invalidateCache()
+
+	r.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Role Deleted",
+		Details:   "Admin " + actorID + " deleted role " + name,
+	})
+
+	return domain.ErrorResponse{}
+}
+
+// AssignRole changes a user's role and revokes their access tokens, which carry the old role.
+// The actor must hold every permission of both the old and the new role.
+func (r *RoleUsecaseImpl) AssignRole(actorID, actorRole, userID, roleName string) (domain.ReturnUser, domain.ErrorResponse) {
+	newRole, err := r.roleRepo.GetRole(roleName)
+	if err != nil {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 400, Message: "Role not found"}
+	}
+
+	user, err := r.userRepo.GetUserByID(userID)
+	if err != nil {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 404, Message: "User not found"}
+	}
+	if user.Role == roleName {
+		return toReturnUser(user), domain.ErrorResponse{}
+	}
+
+	if errResp := r.checkGrantable(actorRole, newRole.Permissions); errResp.Message != "" {
+		return domain.ReturnUser{}, errResp
+	}
+	if oldRole, err := r.roleRepo.GetRole(user.Role); err == nil {
+		if errResp := r.checkGrantable(actorRole, oldRole.Permissions); errResp.Message != "" {
+			return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 403, Message: "You can't change the role of a user with more permissions than you"}
+		}
+	}
+
+	previousRole := user.Role
+	errResp := inTransaction(r.transactor, func(ctx context.Context) error {
+		// locking both roles makes this conflict with a concurrent deletion of the new role and
+		// with other demotions counting the admins, so the count below holds until commit
+		err := r.roleRepo.LockRole(ctx, roleName)
+		if err == mongo.ErrNoDocuments {
+			return abortWith(400, "Role not found", nil)
+		}
+		if err != nil {
+			return abortWith(500, "Internal Server Error", err)
+		}
+		if err := r.roleRepo.LockRole(ctx, previousRole); err != nil && err != mongo.ErrNoDocuments {
+			return abortWith(500, "Internal Server Error", err)
+		}
+
+		if previousRole == string(domain.AdminRole) {
+			admins, err := r.userRepo.CountUsersByRole(ctx, string(domain.AdminRole))
+			if err != nil {
+				return abortWith(500, "Internal Server Error", err)
+			}
+			if admins <= 1 {
+				return abortWith(409, "Can't remove the last admin", nil)
+			}
+		}
+
+		// the permission checks above were made against the previous role
+		err = r.userRepo.UpdateUser(ctx, user.ID, domain.UserChange{
+			Set:   map[string]interface{}{"role": roleName},
+			Where: map[string]interface{}{"role": previousRole},
+		})
+		if err == mongo.ErrNoDocuments {
+			return abortWith(409, "The user's role was changed meanwhile, please try again", nil)
+		}
+		if err != nil {
+			return abortWith(500, "Failed to update user", err)
+		}
+		return nil
+	})
+	if errResp.Message != "" {
+		return domain.ReturnUser{}, errResp
+	}
+	user.Role = roleName
+
+	if err := r.revocationStore.RevokeUserTokens(userID, time.Now()); err != nil {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to revoke access tokens"}
+	}
+
+	r.logRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Role Assigned",
+		Details:   "Admin " + actorID + " changed the role of " + user.Email + " from " + previousRole + " to " + roleName,
+	})
+
+	return toReturnUser(user), domain.ErrorResponse{}
+}
+
+func (r *RoleUsecaseImpl) CanManageRole(actorRole, targetRole string) (bool, error) {
+	role, err := r.roleRepo.GetRole(targetRole)
+	if err != nil {
+		return false, err
+	}
+	for _, permission := range role.Permissions {
+		ok, err := r.HasPermission(actorRole, permission)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func toReturnUser(user domain.User) domain.ReturnUser {
+	returnUser := domain.ReturnUser{
+		ID:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Role:      user.Role,
+		CreatedAt: user.CreatedAt,
+		Image:     user.Image,
+	}
+	if !user.DeletedAt.IsZero() {
+		deletedAt := user.DeletedAt
+		returnUser.DeletedAt = &deletedAt
+		returnUser.DeletedBy = user.DeletedBy
+	}
+	return returnUser
+}
@@ -0,0 +1,46 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"loan-tracker-api/domain"
+	"log"
+)
+
+// txError aborts a transaction with the response the caller should get. It keeps the database
+// error so the driver can still retry transient failures.
+type txError struct {
+	response domain.ErrorResponse
+	err      error
+}
+
+func (e *txError) Error() string {
+	if e.err != nil {
+		return e.response.Message + ": " + e.err.Error()
+	}
+	return e.response.Message
+}
+
+func (e *txError) Unwrap() error {
+	return e.err
+}
+
+func abortWith(statusCode int, message string, err error) error {
+	return &txError{response: domain.ErrorResponse{StatusCode: statusCode, Message: message}, err: err}
+}
+
+// inTransaction runs fn in a transaction and returns the response of the step that aborted it,
+// or a 500 when the transaction itself could not be committed.
+func inTransaction(transactor domain.Transactor, fn func(ctx context.Context) error) domain.ErrorResponse {
+	err := transactor.WithTransaction(fn)
+	if err == nil {
+		return domain.ErrorResponse{}
+	}
+
+	var failure *txError
+	if errors.As(err, &failure) {
+		return failure.response
+	}
+	log.Printf("Error committing transaction: %v", err)
+	return domain.ErrorResponse{StatusCode: 500, Message: "Failed to save changes"}
+}
@@ -0,0 +1,198 @@
+package usecase
+
+import (
+	"context"
+	"loan-tracker-api/domain"
+	"loan-tracker-api/infrastracture"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// totpIssuer is the account issuer shown in authenticator apps
+const totpIssuer = "Loan Tracker API"
+
+// recoveryCodeCount is how many backup codes are handed out when two-factor authentication is enabled
+const recoveryCodeCount = 10
+
+func (u *UserUsecase) EnrollTwoFactor(userID string) (domain.TwoFactorEnrollment, domain.ErrorResponse) {
+	user, err := u.UserRepo.GetUserByID(userID)
+	if err != nil {
+		return domain.TwoFactorEnrollment{}, domain.ErrorResponse{StatusCode: 400, Message: "User not found"}
+	}
+
+	if user.TwoFactorEnabled {
+		return domain.TwoFactorEnrollment{}, domain.ErrorResponse{StatusCode: 400, Message: "Two-factor authentication is already enabled"}
+	}
+
+	secret, err := infrastracture.GenerateTOTPSecret()
+	if err != nil {
+		return domain.TwoFactorEnrollment{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to generate two-factor secret"}
+	}
+
+	// the secret only becomes active once the user proves their app produces valid codes
+	user.PendingTwoFactorSecret = secret
+	err = u.UserRepo.UpdateUser(context.Background(), user.ID, domain.UserChange{
+		Set:   map[string]interface{}{"pending_two_factor_secret": secret},
+		Where: map[string]interface{}{"two_factor_enabled": false},
+	})
+	if err == mongo.ErrNoDocuments {
+		return domain.TwoFactorEnrollment{}, domain.ErrorResponse{StatusCode: 400, Message: "Two-factor authentication is already enabled"}
+	}
+	if err != nil {
+		return domain.TwoFactorEnrollment{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to update user"}
+	}
+
+	return domain.TwoFactorEnrollment{
+		Secret:     secret,
+		OtpAuthURI: infrastracture.TOTPURI(totpIssuer, user.Email, secret),
+	}, domain.ErrorResponse{}
+}
+
+func (u *UserUsecase) ConfirmTwoFactor(userID, code string) ([]string, domain.ErrorResponse) {
+	user, err := u.UserRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, domain.ErrorResponse{StatusCode: 400, Message: "User not found"}
+	}
+
+	if user.PendingTwoFactorSecret == "" {
+		return nil, domain.ErrorResponse{StatusCode: 400, Message: "Start two-factor enrollment first"}
+	}
+
+	step, ok := infrastracture.ValidateTOTP(user.PendingTwoFactorSecret, code, time.Now())
+	if !ok {
+		return nil, domain.ErrorResponse{StatusCode: 400, Message: "Invalid two-factor code"}
+	}
+
+	recoveryCodes, err := infrastracture.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, domain.ErrorResponse{StatusCode: 500, Message: "Failed to generate recovery codes"}
+	}
+
+	hashedCodes := make([]string, 0, len(recoveryCodes))
+	for _, recoveryCode := range recoveryCodes {
+		hashedCodes = append(hashedCodes, infrastracture.HashRecoveryCode(recoveryCode))
+	}
+
+	// the code was checked against this pending secret; a newer enrollment replaces it
+	err = u.UserRepo.UpdateUser(context.Background(), user.ID, domain.UserChange{
+		Set: map[string]interface{}{
+			"two_factor_enabled":        true,
+			"two_factor_secret":         user.PendingTwoFactorSecret,
+			"pending_two_factor_secret": "",
+			"recovery_codes":            hashedCodes,
+			"last_totp_step":            step,
+		},
+		Where: map[string]interface{}{"two_factor_enabled": false, "pending_two_factor_secret": user.PendingTwoFactorSecret},
+	})
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrorResponse{StatusCode: 409, Message: "Two-factor enrollment changed meanwhile, please start again"}
+	}
+	if err != nil {
+		return nil, domain.ErrorResponse{StatusCode: 500, Message: "Failed to update user"}
+	}
+
+	u.LogRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Two-Factor Authentication",
+		Details:   "User " + user.Email + " enabled two-factor authentication",
+	})
+
+	return recoveryCodes, domain.ErrorResponse{}
+}
+
+func (u *UserUsecase) DisableTwoFactor(userID, code string) domain.ErrorResponse {
+	user, err := u.UserRepo.GetUserByID(userID)
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 400, Message: "User not found"}
+	}
+
+	if !user.TwoFactorEnabled {
+		return domain.ErrorResponse{StatusCode: 400, Message: "Two-factor authentication is not enabled"}
+	}
+
+	if !u.checkSecondFactor(user, code, "") {
+		return domain.ErrorResponse{StatusCode: 400, Message: "Invalid two-factor code"}
+	}
+
+	err = u.UserRepo.UpdateUser(context.Background(), user.ID, domain.UserChange{
+		Set: map[string]interface{}{
+			"two_factor_enabled": false,
+			"two_factor_secret":  "",
+			"recovery_codes":     nil,
+			"last_totp_step":     int64(0),
+		},
+		Where: map[string]interface{}{"two_factor_enabled": true},
+	})
+	if err == mongo.ErrNoDocuments {
+		return domain.ErrorResponse{StatusCode: 400, Message: "Two-factor authentication is not enabled"}
+	}
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to update user"}
+	}
+
+	u.LogRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Two-Factor Authentication",
+		Details:   "User " + user.Email + " disabled two-factor authentication",
+	})
+
+	return domain.ErrorResponse{}
+}
+
+func (u *UserUsecase) VerifyTwoFactorLogin(request domain.TwoFactorLoginRequest, deviceID, clientIP string) (domain.LogInResponse, domain.ErrorResponse) {
+	if request.ChallengeToken == "" || (request.Code == "" && request.RecoveryCode == "") {
+		return domain.LogInResponse{}, domain.ErrorResponse{StatusCode: 400, Message: "Challenge token and a code are required"}
+	}
+
+	userID, err := u.TokenGen.VerifyChallengeToken(request.ChallengeToken)
+	if err != nil {
+		return domain.LogInResponse{}, domain.ErrorResponse{StatusCode: 401, Message: "Invalid or expired challenge token"}
+	}
+
+	user, err := u.UserRepo.GetUserByID(userID)
+	if err != nil || !user.TwoFactorEnabled {
+		return domain.LogInResponse{}, domain.ErrorResponse{StatusCode: 401, Message: "Invalid or expired challenge token"}
+	}
+
+	// the second factor is throttled like the password so codes can't be brute-forced within a challenge
+	if errResp := u.checkLoginThrottle(user.Email, clientIP); errResp.Message != "" {
+		return domain.LogInResponse{}, errResp
+	}
+
+	if !u.checkSecondFactor(user, request.Code, request.RecoveryCode) {
+		u.LogRepo.CreateLog(domain.SystemLog{
+			Timestamp: time.Now().String(),
+			Event:     "Login Attempt",
+			Details:   "Failed two-factor verification for user " + user.Email,
+		})
+		u.registerLoginFailure(user.Email, clientIP, true)
+		return domain.LogInResponse{}, domain.ErrorResponse{StatusCode: 400, Message: "Invalid two-factor code"}
+	}
+
+	u.LogRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Login Attempt",
+		Details:   "User " + user.Email + " completed two-factor verification",
+	})
+
+	return u.issueTokens(&user, deviceID)
+}
+
+// checkSecondFactor validates either a TOTP code or a recovery code and marks it as used. The code
+// is consumed with a conditional update, so of two requests presenting the same code only one passes.
+func (u *UserUsecase) checkSecondFactor(user domain.User, code, recoveryCode string) bool {
+	if code != "" {
+		step, ok := infrastracture.ValidateTOTP(user.TwoFactorSecret, code, time.Now())
+		// a code can't be replayed within its validity window
+		if !ok || step <= user.LastTOTPStep {
+			return false
+		}
+		return u.UserRepo.ConsumeTOTPStep(user.ID, step) == nil
+	}
+
+	if recoveryCode == "" {
+		return false
+	}
+	return u.UserRepo.ConsumeRecoveryCode(user.ID, infrastracture.HashRecoveryCode(recoveryCode)) == nil
+}
@@ -1,25 +1,43 @@
 package usecase
 
 import (
+	"context"
+	"loan-tracker-api/config"
 	"loan-tracker-api/domain"
 	"loan-tracker-api/infrastracture"
 	"log"
+	"math"
+	"strconv"
+	"strings"
 	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type UserUsecase struct {
-	UserRepo       domain.UserRepository
-	TokenGen       domain.TokenGenerator
-	PasswordSvc    domain.PasswordService
-	LogRepo        domain.LogRepository
+	UserRepo        domain.UserRepository
+	TokenGen        domain.TokenGenerator
+	PasswordSvc     domain.PasswordService
+	LogRepo         domain.LogRepository
+	RevocationStore domain.TokenRevocationStore
+	LoginThrottle   domain.LoginThrottle
+	Notifier        domain.NotificationUsecase
+	OAuthClient     domain.OAuthClient
+	Transactor      domain.Transactor
 }
 
-func NewUserUsecase(userRepo domain.UserRepository, tokenGen domain.TokenGenerator, passwordSvc domain.PasswordService,LogRepo domain.LogRepository ) domain.UserUsecase {
+func NewUserUsecase(userRepo domain.UserRepository, tokenGen domain.TokenGenerator, passwordSvc domain.PasswordService,LogRepo domain.LogRepository, revocationStore domain.TokenRevocationStore, loginThrottle domain.LoginThrottle, notifier domain.NotificationUsecase, oauthClient domain.OAuthClient, transactor domain.Transactor) domain.UserUsecase {
 	return &UserUsecase{
-		UserRepo:    userRepo,
-		TokenGen:    tokenGen,
-		PasswordSvc: passwordSvc,
-		LogRepo:     LogRepo,
+		UserRepo:        userRepo,
+		TokenGen:        tokenGen,
+		PasswordSvc:     passwordSvc,
+		LogRepo:         LogRepo,
+		RevocationStore: revocationStore,
+		LoginThrottle:   loginThrottle,
+		Notifier:        notifier,
+		OAuthClient:     oauthClient,
+		Transactor:      transactor,
 
 
 	}
@@ -57,22 +75,21 @@ func (u *UserUsecase) Register(user domain.User) domain.ErrorResponse {
 	}
 
 	user.Password = hashedPassword
-	user.ActivationToken = token
+	user.PreferredLanguage = infrastracture.NormalizeLocale(user.PreferredLanguage)
+	user.ActivationToken = infrastracture.HashToken(token)
 	user.TokenCreatedAt = time.Now()
 
-	// Create user account in the database
-	err = u.UserRepo.Register(user)
-	if err != nil {
-		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to create user account"}
-	}
-
-	// Send activation email or link to the user
-	err = infrastracture.SendActivationEmail(user.Email, token)
-	if err != nil {
-		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to send activation email"}
-	}
-
-	return domain.ErrorResponse{}
+	// The account and its activation email are saved in one transaction, so an account never exists
+	// without a way to activate it. The outbox worker delivers the email, so a mail outage doesn't fail registration.
+	return inTransaction(u.Transactor, func(ctx context.Context) error {
+		if err := u.UserRepo.Register(ctx, user); err != nil {
+			return abortWith(500, "Failed to create user account", err)
+		}
+		if err := u.Notifier.SendEmail(ctx, user, domain.EmailActivation, map[string]interface{}{"Token": token}); err != nil {
+			return abortWith(500, "Failed to create user account", err)
+		}
+		return nil
+	})
 }
 
 
@@ -82,15 +99,18 @@ func (u *UserUsecase) AccountActivation(email, token string) domain.ErrorRespons
 		return domain.ErrorResponse{StatusCode: 400, Message: "User not found"}
 	}
 
-	if user.ActivationToken != token {
+	if !infrastracture.TokenHashMatches(token, user.ActivationToken) {
 		return domain.ErrorResponse{StatusCode: 400, Message: "Invalid activation token"}
 	}
 
-	if time.Since(user.TokenCreatedAt).Minutes() > 30 {
+	if time.Since(user.TokenCreatedAt) > tokenExpiry(config.EnvConfigs.ActivationTokenExpiryMinutes) {
 		return domain.ErrorResponse{StatusCode: 400, Message: "Activation token has expired"}
 	}
 
-	err = u.UserRepo.AccountActivation(email)
+	err = u.UserRepo.AccountActivation(email, user.ActivationToken)
+	if err == mongo.ErrNoDocuments {
+		return domain.ErrorResponse{StatusCode: 400, Message: "Invalid activation token"}
+	}
 	if err != nil {
 		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to activate account"}
 	}
@@ -98,12 +118,72 @@ func (u *UserUsecase) AccountActivation(email, token string) domain.ErrorRespons
 	return domain.ErrorResponse{}
 }
 
-func (u *UserUsecase) Login(user *domain.User, deviceID string) (domain.LogInResponse, domain.ErrorResponse) {
+// activationResendResponseTime is the least time ResendActivationEmail takes to answer. It is well
+// above the time reissuing a link takes, so the response time doesn't depend on whether one was.
+const activationResendResponseTime = 500 * time.Millisecond
+
+// ResendActivationEmail issues a new activation link. Every valid request gets the same answer
+// after the same time, so neither tells whether the address belongs to an inactive account;
+// the email itself goes through the outbox and never delays the answer.
+func (u *UserUsecase) ResendActivationEmail(email string) domain.ErrorResponse {
+	if !infrastracture.IsValidEmail(email) {
+		return domain.ErrorResponse{StatusCode: 400, Message: "Invalid email address"}
+	}
+
+	start := time.Now()
+	errResp := u.reissueActivationToken(email, start)
+	time.Sleep(activationResendResponseTime - time.Since(start))
+
+	// a 429 also covers addresses without an inactive account, so it isn't passed on
+	if errResp.StatusCode == 429 {
+		return domain.ErrorResponse{}
+	}
+	return errResp
+}
+
+// reissueActivationToken replaces the activation token of an inactive account, which invalidates
+// any earlier link, and queues an email with the new one. Reissues are limited by a per-account
+// cooldown and a cap per 24 hours; a 429 means the account doesn't qualify for another link.
+func (u *UserUsecase) reissueActivationToken(email string, now time.Time) domain.ErrorResponse {
+	cooldown := time.Duration(config.EnvConfigs.ActivationResendCooldownSeconds) * time.Second
+	if cooldown <= 0 {
+		cooldown = time.Minute
+	}
+	dailyLimit := config.EnvConfigs.ActivationResendDailyLimit
+	if dailyLimit <= 0 {
+		dailyLimit = 5
+	}
+
+	token, err := infrastracture.GenerateActivationToken()
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to generate activation token"}
+	}
+
+	return inTransaction(u.Transactor, func(ctx context.Context) error {
+		user, err := u.UserRepo.ReissueActivationToken(ctx, email, infrastracture.HashToken(token), now, cooldown, dailyLimit)
+		if err == mongo.ErrNoDocuments {
+			return abortWith(429, "No inactive account, or an activation email was sent recently or too often today", err)
+		}
+		if err != nil {
+			return abortWith(500, "Failed to update user", err)
+		}
+		if err := u.Notifier.SendEmail(ctx, user, domain.EmailActivation, map[string]interface{}{"Token": token}); err != nil {
+			return abortWith(500, "Failed to send activation email", err)
+		}
+		return nil
+	})
+}
+
+func (u *UserUsecase) Login(user *domain.User, deviceID, clientIP string) (domain.LogInResponse, domain.ErrorResponse) {
     if u.UserRepo == nil || u.PasswordSvc == nil || u.TokenGen == nil {
         log.Fatal("Necessary services are nil")
         return domain.LogInResponse{}, domain.ErrorResponse{StatusCode: 500, Message: "Internal server error"}
     }
 
+    if errResp := u.checkLoginThrottle(user.Email, clientIP); errResp.Message != "" {
+        return domain.LogInResponse{}, errResp
+    }
+
     existingUser, err := u.UserRepo.Login(user)
     if err != nil {
         // Log failed login attempt
@@ -112,6 +192,7 @@ func (u *UserUsecase) Login(user *domain.User, deviceID string) (domain.LogInRes
             Event:     "Login Attempt",
             Details:   "Failed login attempt for user " + user.Email,
         })
+        u.registerLoginFailure(user.Email, clientIP, false)
         return domain.LogInResponse{}, domain.ErrorResponse{StatusCode: 400, Message: "Invalid credentials"}
     }
 
@@ -122,9 +203,14 @@ func (u *UserUsecase) Login(user *domain.User, deviceID string) (domain.LogInRes
             Event:     "Login Attempt",
             Details:   "Failed login attempt for user " + user.Email,
         })
+        u.registerLoginFailure(existingUser.Email, clientIP, true)
         return domain.LogInResponse{}, domain.ErrorResponse{StatusCode: 400, Message: "Invalid credentials"}
     }
 
+    if errResp := accountBlocked(*existingUser); errResp.Message != "" {
+        return domain.LogInResponse{}, errResp
+    }
+
     // Log successful login attempt
     u.LogRepo.CreateLog(domain.SystemLog{
         Timestamp: time.Now().String(),
@@ -133,31 +219,116 @@ func (u *UserUsecase) Login(user *domain.User, deviceID string) (domain.LogInRes
     })
 
     if !existingUser.IsActive {
-        token, err := infrastracture.GenerateActivationToken()
-        if err != nil {
-            return domain.LogInResponse{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to generate activation token"}
+        // a fresh link goes out with the same limits as the resend endpoint; hitting them just means no new email
+        errResp := u.reissueActivationToken(existingUser.Email, time.Now())
+        if errResp.Message != "" && errResp.StatusCode != 429 {
+            return domain.LogInResponse{}, errResp
         }
 
-        existingUser, err := u.UserRepo.GetUserByEmail(user.Email)
+        return domain.LogInResponse{}, domain.ErrorResponse{StatusCode: 400, Message: "Account is not activated yet. Please check your email for activation link."}
+    }
+
+    if existingUser.TwoFactorEnabled {
+        challengeToken, err := u.TokenGen.GenerateChallengeToken(*existingUser)
         if err != nil {
-            return domain.LogInResponse{}, domain.ErrorResponse{StatusCode: 400, Message: "User not found"}
+            return domain.LogInResponse{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to generate challenge token"}
         }
 
-        existingUser.ActivationToken = token
-        existingUser.TokenCreatedAt = time.Now()
+        return domain.LogInResponse{
+            TwoFactorRequired: true,
+            ChallengeToken:    challengeToken,
+        }, domain.ErrorResponse{}
+    }
 
-        err = u.UserRepo.UpdateUser(&existingUser)
-        if err != nil {
-            return domain.LogInResponse{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to create user account"}
-        }
+    return u.issueTokens(existingUser, deviceID)
+}
 
-        // Send activation email or link to the user
-        err = infrastracture.SendActivationEmail(user.Email, token)
-        if err != nil {
-            return domain.LogInResponse{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to send activation email"}
-        }
+// checkLoginThrottle rejects the attempt while the account or client address is locked out or delayed.
+func (u *UserUsecase) checkLoginThrottle(email, clientIP string) domain.ErrorResponse {
+	wait, locked, err := u.LoginThrottle.Check(email, clientIP)
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 500, Message: "Internal server error"}
+	}
 
-        return domain.LogInResponse{}, domain.ErrorResponse{StatusCode: 400, Message: "Account is not activated yet. Please check your email for activation link."}
+	retryAfter := strconv.Itoa(int(math.Ceil(wait.Seconds())))
+	if locked {
+		return domain.ErrorResponse{StatusCode: 423, Message: "Too many failed login attempts. Login is locked, try again in " + retryAfter + " seconds."}
+	}
+	if wait > 0 {
+		return domain.ErrorResponse{StatusCode: 429, Message: "Too many failed login attempts. Try again in " + retryAfter + " seconds."}
+	}
+
+	return domain.ErrorResponse{}
+}
+
+// registerLoginFailure counts a failed attempt and, when it locks a real account, tells its owner.
+func (u *UserUsecase) registerLoginFailure(email, clientIP string, accountExists bool) {
+	lockedUntil, err := u.LoginThrottle.RegisterFailure(email, clientIP)
+	if err != nil {
+		log.Printf("Error recording failed login for %s: %v", email, err)
+		return
+	}
+
+	if lockedUntil.IsZero() || !accountExists {
+		return
+	}
+
+	u.LogRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Account Locked",
+		Details:   "Account " + email + " locked until " + lockedUntil.Format(time.RFC3339) + " after repeated failed logins from " + clientIP,
+	})
+
+	user, err := u.UserRepo.GetUserByEmail(email)
+	if err != nil {
+		log.Printf("Error loading locked account %s: %v", email, err)
+		return
+	}
+	if err := u.Notifier.SendEmail(context.Background(), user, domain.EmailAccountLocked, map[string]interface{}{"LockedUntil": lockedUntil}); err != nil {
+		log.Printf("Error sending lockout notice to %s: %v", email, err)
+	}
+}
+
+func (u *UserUsecase) UnlockUser(adminID, userID string) domain.ErrorResponse {
+	user, err := u.UserRepo.GetUserByID(userID)
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 400, Message: "User not found"}
+	}
+
+	if err := u.LoginThrottle.Unlock(user.Email); err != nil {
+		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to unlock user"}
+	}
+
+	u.LogRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Account Unlocked",
+		Details:   "Admin " + adminID + " unlocked account " + user.Email,
+	})
+
+	return domain.ErrorResponse{}
+}
+
+// accountBlocked rejects accounts an admin has suspended or sent through a forced password reset.
+func accountBlocked(user domain.User) domain.ErrorResponse {
+	if user.Suspended {
+		return domain.ErrorResponse{StatusCode: 403, Message: "Account is suspended"}
+	}
+	if user.PasswordResetRequired {
+		return domain.ErrorResponse{StatusCode: 403, Message: "A password reset is required. Please check your email for a reset link."}
+	}
+	return domain.ErrorResponse{}
+}
+
+// issueTokens starts a session for the device and returns a fresh access/refresh token pair.
+func (u *UserUsecase) issueTokens(existingUser *domain.User, deviceID string) (domain.LogInResponse, domain.ErrorResponse) {
+    if errResp := accountBlocked(*existingUser); errResp.Message != "" {
+        return domain.LogInResponse{}, errResp
+    }
+
+    // failures are only forgotten once every factor has passed; a correct password alone must not
+    // reset the count that limits second-factor guesses
+    if err := u.LoginThrottle.RegisterSuccess(existingUser.Email); err != nil {
+        return domain.LogInResponse{}, domain.ErrorResponse{StatusCode: 500, Message: "Internal server error"}
     }
 
     refreshToken, err := u.TokenGen.GenerateRefreshToken(*existingUser)
@@ -165,23 +336,17 @@ func (u *UserUsecase) Login(user *domain.User, deviceID string) (domain.LogInRes
         return domain.LogInResponse{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to generate refresh token"}
     }
 
+    // only the hash is stored; each login starts a new token family
     newRefreshToken := domain.RefreshToken{
-        Token:     refreshToken,
-        DeviceID:  deviceID,
-        CreatedAt: time.Now(),
-    }
-
-    for i, rt := range existingUser.RefreshTokens {
-        if rt.DeviceID == deviceID {
-            existingUser.RefreshTokens = append(existingUser.RefreshTokens[:i], existingUser.RefreshTokens[i+1:]...)
-            break
-        }
+        Token:         infrastracture.HashToken(refreshToken),
+        FamilyID:      primitive.NewObjectID().Hex(),
+        RotatedTokens: []string{},
+        DeviceID:      deviceID,
+        CreatedAt:     time.Now(),
+        LastUsedAt:    time.Now(),
     }
 
-    existingUser.RefreshTokens = append(existingUser.RefreshTokens, newRefreshToken)
-
-    err = u.UserRepo.UpdateUser(existingUser)
-    if err != nil {
+    if err := u.UserRepo.AddRefreshToken(existingUser.ID, newRefreshToken); err != nil {
         return domain.LogInResponse{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to update user"}
     }
 
@@ -192,7 +357,7 @@ func (u *UserUsecase) Login(user *domain.User, deviceID string) (domain.LogInRes
 
     return domain.LogInResponse{
         AccessToken:  accessToken,
-        RefreshToken: newRefreshToken.Token,
+        RefreshToken: refreshToken,
         User: domain.ReturnUser{
             ID:        existingUser.ID,
             Username:  existingUser.Username,
@@ -203,46 +368,213 @@ func (u *UserUsecase) Login(user *domain.User, deviceID string) (domain.LogInRes
     }, domain.ErrorResponse{}
 }
 
+// maxRotatedTokens bounds how many replaced refresh tokens a session remembers for reuse detection
+const maxRotatedTokens = 50
+
+// RefreshToken trades a refresh token for a new access and refresh token. A token is good for
+// one refresh only; presenting one that was already rotated means it was copied, so the whole
+// token family is revoked and both parties have to log in again.
 func (u *UserUsecase) RefreshToken(userID, deviceID, token string) (domain.RefreshTokenResponse, domain.ErrorResponse) {
-	user, err := u.UserRepo.GetUserByID(userID)
+	tokenUserID, err := u.TokenGen.RefreshToken(token)
+	if err != nil || (userID != "" && userID != tokenUserID) {
+		return domain.RefreshTokenResponse{}, domain.ErrorResponse{StatusCode: 401, Message: "Invalid refresh token"}
+	}
+
+	user, err := u.UserRepo.GetUserByID(tokenUserID)
 	if err != nil {
-		return domain.RefreshTokenResponse{}, domain.ErrorResponse{StatusCode: 400, Message: "Invalid refresh token"}
+		return domain.RefreshTokenResponse{}, domain.ErrorResponse{StatusCode: 401, Message: "Invalid refresh token"}
 	}
 
-	for i, rt := range user.RefreshTokens {
-		if rt.Token == token && rt.DeviceID == deviceID {
-			user.RefreshTokens = append(user.RefreshTokens[:i], user.RefreshTokens[i+1:]...)
+	if errResp := accountBlocked(user); errResp.Message != "" {
+		return domain.RefreshTokenResponse{}, errResp
+	}
 
-			refreshToken, err := u.TokenGen.GenerateRefreshToken(user)
-			if err != nil {
-				return domain.RefreshTokenResponse{}, domain.ErrorResponse{ }
+	tokenHash := infrastracture.HashToken(token)
+	var current *domain.RefreshToken
+	for i, rt := range user.RefreshTokens {
+		if rt.Token == tokenHash {
+			current = &user.RefreshTokens[i]
+			break
+		}
+		for _, rotated := range rt.RotatedTokens {
+			if rotated == tokenHash {
+				return domain.RefreshTokenResponse{}, u.revokeTokenFamily(user, rt, deviceID)
 			}
+		}
+	}
+	if current == nil || current.DeviceID != deviceID {
+		return domain.RefreshTokenResponse{}, domain.ErrorResponse{StatusCode: 401, Message: "You are not logged in."}
+	}
 
-			newRefreshToken := domain.RefreshToken{
-				Token:     refreshToken,
-				DeviceID:  deviceID,
-				CreatedAt: time.Now(),
-			}
+	refreshToken, err := u.TokenGen.GenerateRefreshToken(user)
+	if err != nil {
+		return domain.RefreshTokenResponse{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to generate refresh token"}
+	}
 
-			user.RefreshTokens = append(user.RefreshTokens, newRefreshToken)
-			err = u.UserRepo.UpdateUser(&user)
-			if err != nil {
-				return domain.RefreshTokenResponse{}, domain.ErrorResponse{ StatusCode: 500 ,Message :"Failed to update user"}
-			}
+	rotatedTokens := append(append([]string{}, current.RotatedTokens...), tokenHash)
+	if len(rotatedTokens) > maxRotatedTokens {
+		rotatedTokens = rotatedTokens[len(rotatedTokens)-maxRotatedTokens:]
+	}
+	// the session keeps its original creation time across rotations
+	next := domain.RefreshToken{
+		Token:         infrastracture.HashToken(refreshToken),
+		FamilyID:      current.FamilyID,
+		RotatedTokens: rotatedTokens,
+		DeviceID:      deviceID,
+		CreatedAt:     current.CreatedAt,
+		LastUsedAt:    time.Now(),
+	}
 
-			accessToken, err := u.TokenGen.GenerateToken(user)
-			if err != nil {
-				return domain.RefreshTokenResponse{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to Generate Token"}
-			}
+	err = u.UserRepo.RotateRefreshToken(user.ID, tokenHash, next)
+	if err == mongo.ErrNoDocuments {
+		// a concurrent request redeemed the same token first
+		return domain.RefreshTokenResponse{}, u.revokeTokenFamily(user, *current, deviceID)
+	}
+	if err != nil {
+		return domain.RefreshTokenResponse{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to update user"}
+	}
 
-			return domain.RefreshTokenResponse{
-				AccessToken:  accessToken,
-				
-			}, domain.ErrorResponse{}
+	accessToken, err := u.TokenGen.GenerateToken(user)
+	if err != nil {
+		return domain.RefreshTokenResponse{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to Generate Token"}
+	}
+
+	return domain.RefreshTokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, domain.ErrorResponse{}
+}
+
+// revokeTokenFamily ends the session a replayed refresh token came from. Access tokens can't be
+// traced back to a family, so all of the user's current access tokens are revoked as well.
+func (u *UserUsecase) revokeTokenFamily(user domain.User, session domain.RefreshToken, deviceID string) domain.ErrorResponse {
+	if err := u.UserRepo.RevokeRefreshTokenFamily(user.ID, session.FamilyID); err != nil {
+		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to revoke session"}
+	}
+	if err := u.RevocationStore.RevokeUserTokens(user.ID.Hex(), time.Now()); err != nil {
+		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to revoke access tokens"}
+	}
+
+	u.LogRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Refresh Token Reuse",
+		Details:   "Already used refresh token of user " + user.Email + " presented from device " + deviceID + "; revoked session " + session.DeviceID + " (family " + session.FamilyID + ")",
+	})
+
+	return domain.ErrorResponse{StatusCode: 401, Message: "This refresh token has already been used. Please log in again."}
+}
+
+
+func (u *UserUsecase) Logout(userID, deviceID, token, accessTokenID string, accessTokenExpiresAt time.Time) domain.ErrorResponse {
+	user, err := u.UserRepo.GetUserByID(userID)
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 400, Message: "User not found"}
+	}
+
+	// an explicit refresh token wins over the device fingerprint, which changes with the client IP
+	if token != "" {
+		err = u.UserRepo.DeleteRefreshToken(&user, infrastracture.HashToken(token))
+	} else {
+		err = u.UserRepo.DeleteRefreshTokenByDevice(&user, deviceID)
+	}
+	if err == mongo.ErrNoDocuments {
+		return domain.ErrorResponse{StatusCode: 400, Message: "You are not logged in."}
+	}
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to log out"}
+	}
+
+	err = u.RevocationStore.RevokeToken(accessTokenID, accessTokenExpiresAt)
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to revoke access token"}
+	}
+
+	u.LogRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Logout",
+		Details:   "User " + user.Email + " logged out",
+	})
+
+	return domain.ErrorResponse{}
+}
+
+func (u *UserUsecase) LogoutAll(userID string) domain.ErrorResponse {
+	user, err := u.UserRepo.GetUserByID(userID)
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 400, Message: "User not found"}
+	}
+
+	err = u.UserRepo.DeleteAllRefreshTokens(context.Background(), &user)
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to log out"}
+	}
+
+	err = u.RevocationStore.RevokeUserTokens(userID, time.Now())
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to revoke access tokens"}
+	}
+
+	u.LogRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Logout",
+		Details:   "User " + user.Email + " logged out of all devices",
+	})
+
+	return domain.ErrorResponse{}
+}
+
+func (u *UserUsecase) GetSessions(userID, currentDeviceID string) ([]domain.Session, domain.ErrorResponse) {
+	user, err := u.UserRepo.GetUserByID(userID)
+	if err != nil {
+		return []domain.Session{}, domain.ErrorResponse{StatusCode: 400, Message: "User not found"}
+	}
+
+	return userSessions(user, currentDeviceID), domain.ErrorResponse{}
+}
+
+// userSessions lists the devices holding a refresh token for the user.
+func userSessions(user domain.User, currentDeviceID string) []domain.Session {
+	sessions := []domain.Session{}
+	for _, rt := range user.RefreshTokens {
+		lastUsedAt := rt.LastUsedAt
+		if lastUsedAt.IsZero() {
+			lastUsedAt = rt.CreatedAt
 		}
+		sessions = append(sessions, domain.Session{
+			DeviceID:   rt.DeviceID,
+			CreatedAt:  rt.CreatedAt,
+			LastUsedAt: lastUsedAt,
+			Current:    currentDeviceID != "" && rt.DeviceID == currentDeviceID,
+		})
+	}
+	return sessions
+}
+
+func (u *UserUsecase) RevokeSession(userID, deviceID string) domain.ErrorResponse {
+	if deviceID == "" {
+		return domain.ErrorResponse{StatusCode: 400, Message: "Device ID is required"}
+	}
+
+	user, err := u.UserRepo.GetUserByID(userID)
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 400, Message: "User not found"}
+	}
+
+	err = u.UserRepo.DeleteRefreshTokenByDevice(&user, deviceID)
+	if err == mongo.ErrNoDocuments {
+		return domain.ErrorResponse{StatusCode: 404, Message: "Session not found"}
+	}
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to revoke session"}
 	}
 
-	return domain.RefreshTokenResponse{}, domain.ErrorResponse{ StatusCode: 500, Message: "You are not logged in."}
+	u.LogRepo.CreateLog(domain.SystemLog{
+		Timestamp: time.Now().String(),
+		Event:     "Session Revoked",
+		Details:   "User " + user.Email + " revoked session " + deviceID,
+	})
+
+	return domain.ErrorResponse{}
 }
 
 
@@ -252,13 +584,224 @@ func(u *UserUsecase)GetMyProfile (userID string) (domain.ReturnUser, domain.Erro
 		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 400, Message: "User not found"}
 	}
 
-	return domain.ReturnUser{
-		ID:       user.ID,
-		Username: user.Username,
-		Email:    user.Email,
-		Role:     user.Role,
-		CreatedAt: user.CreatedAt,
-	}, domain.ErrorResponse{}
+	return toReturnUser(user), domain.ErrorResponse{}
+}
+
+func (u *UserUsecase) UpdateProfile(userID string, request domain.UpdateProfileRequest) (domain.ReturnUser, domain.ErrorResponse) {
+	if request.Image != nil {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 400, Message: "The profile image can't be set here; upload it with PUT /users/profile/image"}
+	}
+
+	user, err := u.UserRepo.GetUserByID(userID)
+	if err != nil {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 400, Message: "User not found"}
+	}
+
+	if request.Username != nil {
+		username := strings.TrimSpace(*request.Username)
+		if username == "" {
+			return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 400, Message: "Username can't be empty"}
+		}
+		if username != user.Username {
+			if existing, err := u.UserRepo.GetUserByUsername(username); err == nil && existing.ID != user.ID {
+				return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 400, Message: "Username is already taken"}
+			}
+			user.Username = username
+		}
+	}
+
+	user.UpdatedAt = primitive.Timestamp{T: uint32(time.Now().Unix())}
+	err = u.UserRepo.UpdateUser(context.Background(), user.ID, domain.UserChange{Set: map[string]interface{}{
+		"username":  user.Username,
+		"updatedAt": user.UpdatedAt,
+	}})
+	if err != nil {
+		return domain.ReturnUser{}, domain.ErrorResponse{StatusCode: 500, Message: "Failed to update user"}
+	}
+
+	return toReturnUser(user), domain.ErrorResponse{}
+}
+
+func (u *UserUsecase) RequestEmailChange(userID string, request domain.ChangeEmailRequest) domain.ErrorResponse {
+	user, err := u.UserRepo.GetUserByID(userID)
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 400, Message: "User not found"}
+	}
+
+	if !u.PasswordSvc.CheckPasswordHash(request.Password, user.Password) {
+		return domain.ErrorResponse{StatusCode: 400, Message: "Invalid password"}
+	}
+
+	email := strings.TrimSpace(request.Email)
+	if !infrastracture.IsValidEmail(email) {
+		return domain.ErrorResponse{StatusCode: 400, Message: "Invalid email address"}
+	}
+	if email == user.Email {
+		return domain.ErrorResponse{StatusCode: 400, Message: "This is already your email address"}
+	}
+	if _, err := u.UserRepo.GetUserByEmail(email); err == nil {
+		return domain.ErrorResponse{StatusCode: 400, Message: "Email is already in use"}
+	}
+
+	token, err := infrastracture.GenerateActivationToken()
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to generate confirmation token"}
+	}
+
+	// a new request replaces any earlier one, whose link stops working
+	user.PendingEmail = email
+	user.EmailChangeToken = infrastracture.HashToken(token)
+	user.EmailChangeExpiresAt = time.Now().Add(tokenExpiry(config.EnvConfigs.EmailChangeTokenExpiryMinutes))
+
+	// the link goes to the new address, which proves the user can receive mail there
+	recipient := user
+	recipient.Email = email
+	return inTransaction(u.Transactor, func(ctx context.Context) error {
+		// the password was checked against this version of the account
+		err := u.UserRepo.UpdateUser(ctx, user.ID, domain.UserChange{
+			Set: map[string]interface{}{
+				"pending_email":           user.PendingEmail,
+				"email_change_token":      user.EmailChangeToken,
+				"email_change_expires_at": user.EmailChangeExpiresAt,
+			},
+			Where: map[string]interface{}{"email": user.Email, "password": user.Password},
+		})
+		if err == mongo.ErrNoDocuments {
+			return abortWith(409, "Your account changed meanwhile, please try again", err)
+		}
+		if err != nil {
+			return abortWith(500, "Failed to update user", err)
+		}
+		if err := u.Notifier.SendEmail(ctx, recipient, domain.EmailChange, map[string]interface{}{"Token": token}); err != nil {
+			return abortWith(500, "Failed to send confirmation email", err)
+		}
+		return nil
+	})
+}
+
+func (u *UserUsecase) ConfirmEmailChange(token string) domain.ErrorResponse {
+	user, err := u.UserRepo.ConsumeEmailChangeToken(infrastracture.HashToken(token))
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 400, Message: "Invalid confirmation token"}
+	}
+	if time.Now().After(user.EmailChangeExpiresAt) {
+		return domain.ErrorResponse{StatusCode: 400, Message: "Confirmation token has expired"}
+	}
+
+	// someone may have registered the address since the link was sent
+	if _, err := u.UserRepo.GetUserByEmail(user.PendingEmail); err == nil {
+		return domain.ErrorResponse{StatusCode: 409, Message: "Email is already in use"}
+	}
+
+	previous := user
+	now := time.Now()
+	user.Email = user.PendingEmail
+	user.PendingEmail = ""
+	user.EmailChangeToken = ""
+	user.EmailChangeExpiresAt = time.Time{}
+	user.UpdatedAt = primitive.Timestamp{T: uint32(now.Unix())}
+	errResp := inTransaction(u.Transactor, func(ctx context.Context) error {
+		// a newer request made after this link was redeemed is left alone
+		err := u.UserRepo.UpdateUser(ctx, user.ID, domain.UserChange{
+			Set: map[string]interface{}{
+				"email":                   user.Email,
+				"pending_email":           "",
+				"email_change_expires_at": time.Time{},
+				"updatedAt":               user.UpdatedAt,
+			},
+			Where: map[string]interface{}{"email": previous.Email, "pending_email": previous.PendingEmail},
+		})
+		if err == mongo.ErrNoDocuments {
+			return abortWith(400, "Invalid confirmation token", err)
+		}
+		if err != nil {
+			return abortWith(500, "Failed to update user", err)
+		}
+		// the old address hears about it too, in case the account was taken over
+		if err := u.Notifier.SendEmail(ctx, previous, domain.EmailChanged, map[string]interface{}{"NewEmail": user.Email, "ChangedAt": now}); err != nil {
+			return abortWith(500, "Failed to send email change notice", err)
+		}
+		return nil
+	})
+	if errResp.Message != "" {
+		return errResp
+	}
+
+	u.LogRepo.CreateLog(domain.SystemLog{
+		Timestamp: now.String(),
+		Event:     "Email Changed",
+		Details:   "User " + user.ID.Hex() + " changed their email from " + previous.Email + " to " + user.Email,
+	})
+
+	return domain.ErrorResponse{}
+}
+
+// ChangePassword replaces the password of a signed-in user and signs them out everywhere,
+// the same as a reset.
+func (u *UserUsecase) ChangePassword(userID string, request domain.ChangePasswordRequest) domain.ErrorResponse {
+	user, err := u.UserRepo.GetUserByID(userID)
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 400, Message: "User not found"}
+	}
+
+	if !u.PasswordSvc.CheckPasswordHash(request.CurrentPassword, user.Password) {
+		return domain.ErrorResponse{StatusCode: 400, Message: "Current password is incorrect"}
+	}
+	if !infrastracture.IsValidPassword(request.NewPassword) {
+		return domain.ErrorResponse{StatusCode: 400, Message: "Password must be at least 8 characters long and contain upper and lower case letters, a number and a symbol"}
+	}
+	if request.NewPassword == request.CurrentPassword {
+		return domain.ErrorResponse{StatusCode: 400, Message: "New password must be different from the current one"}
+	}
+
+	hashedPassword, err := u.PasswordSvc.HashPassword(request.NewPassword)
+	if err != nil {
+		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to hash password"}
+	}
+
+	now := time.Now()
+	user.UpdatedAt = primitive.Timestamp{T: uint32(now.Unix())}
+	// the current password was checked against this hash; a change made meanwhile wins
+	errResp := u.savePasswordChange(user, domain.UserChange{
+		Set:   map[string]interface{}{"password": hashedPassword, "updatedAt": user.UpdatedAt},
+		Where: map[string]interface{}{"password": user.Password},
+	}, now)
+	if errResp.Message != "" {
+		return errResp
+	}
+
+	if err := u.RevocationStore.RevokeUserTokens(userID, now); err != nil {
+		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to revoke access tokens"}
+	}
+
+	u.LogRepo.CreateLog(domain.SystemLog{
+		Timestamp: now.String(),
+		Event:     "Password Changed",
+		Details:   "User " + user.Email + " changed their password",
+	})
+
+	return domain.ErrorResponse{}
+}
+
+// savePasswordChange stores the new password with change, ends every session and queues the
+// password changed notice in one transaction, so the user always hears about a change that was made.
+func (u *UserUsecase) savePasswordChange(user domain.User, change domain.UserChange, changedAt time.Time) domain.ErrorResponse {
+	return inTransaction(u.Transactor, func(ctx context.Context) error {
+		err := u.UserRepo.UpdateUser(ctx, user.ID, change)
+		if err == mongo.ErrNoDocuments {
+			return abortWith(409, "The password was changed meanwhile, please try again", err)
+		}
+		if err != nil {
+			return abortWith(500, "Failed to update user", err)
+		}
+		if err := u.UserRepo.DeleteAllRefreshTokens(ctx, &user); err != nil {
+			return abortWith(500, "Failed to end sessions", err)
+		}
+		if err := u.Notifier.SendEmail(ctx, user, domain.EmailPasswordChanged, map[string]interface{}{"ChangedAt": changedAt}); err != nil {
+			return abortWith(500, "Failed to send password changed notice", err)
+		}
+		return nil
+	})
 }
 
 
@@ -283,27 +826,6 @@ func (u *UserUsecase) GetUsers(byName, limit , page string) ([]domain.ReturnUser
 }
 
 
-func (u *UserUsecase) DeleteUser(id string) (domain.ReturnUser ,domain.ErrorResponse) {
-	user, err := u.UserRepo.GetUserByID(id)
-	if err != nil {
-		return domain.ReturnUser{},domain.ErrorResponse{StatusCode: 400, Message: "User not found"}
-	}
-
-	_ ,err = u.UserRepo.DeleteUser(id)
-	if err != nil {
-		return domain.ReturnUser{},domain.ErrorResponse{StatusCode: 500, Message: "Failed to delete user"}
-	}
-
-	return domain.ReturnUser{
-		ID: 	 user.ID,
-		Username: user.Username,
-		Email:    user.Email,
-		Role:     user.Role,
-		CreatedAt: user.CreatedAt,
-	}, domain.ErrorResponse{}
-}
-
-
 func (u *UserUsecase) SendPasswordResetLink(email string) domain.ErrorResponse{
 	user, err := u.UserRepo.GetUserByEmail(email)
 	if err != nil {
@@ -314,26 +836,33 @@ func (u *UserUsecase) SendPasswordResetLink(email string) domain.ErrorResponse{
 	if err != nil {
 		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to generate reset token"}
 	}
-	user.PasswordResetToken = resetToken
-	user.TokenCreatedAt = time.Now()
-
-	err = u.UserRepo.UpdateUser(&user)
-	if err != nil {
-		return  domain.ErrorResponse{StatusCode: 500, Message: "Failed to update user"}
-	}
-
-	err = infrastracture.SendResetLink(user.Email, resetToken)
-	if err != nil {
-		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to send reset link"}
-	}
-
-	return domain.ErrorResponse{}
+	user.PasswordResetToken = infrastracture.HashToken(resetToken)
+	user.PasswordResetExpiresAt = time.Now().Add(tokenExpiry(config.EnvConfigs.PasswordResetTokenExpiryMinutes))
+
+	return inTransaction(u.Transactor, func(ctx context.Context) error {
+		err := u.UserRepo.UpdateUser(ctx, user.ID, domain.UserChange{Set: map[string]interface{}{
+			"password_reset_token":      user.PasswordResetToken,
+			"password_reset_expires_at": user.PasswordResetExpiresAt,
+		}})
+		if err != nil {
+			return abortWith(500, "Failed to update user", err)
+		}
+		if err := u.Notifier.SendEmail(ctx, user, domain.EmailPasswordReset, map[string]interface{}{"Token": resetToken}); err != nil {
+			return abortWith(500, "Failed to send reset link", err)
+		}
+		return nil
+	})
 }
 
 
 
 func (u *UserUsecase) ResetPassword(token, newPassword string) domain.ErrorResponse {
-	user, err := u.UserRepo.GetUserByResetToken(token)
+	if !infrastracture.IsValidPassword(newPassword) {
+		return domain.ErrorResponse{StatusCode: 400, Message: "Password must be at least 8 characters long and contain upper and lower case letters, a number and a symbol"}
+	}
+
+	// the token is consumed up front, so a link is dead after its first use even if the reset below fails
+	user, err := u.UserRepo.ConsumePasswordResetToken(infrastracture.HashToken(token))
 	if err != nil {
 
 		u.LogRepo.CreateLog(domain.SystemLog{
@@ -347,6 +876,10 @@ func (u *UserUsecase) ResetPassword(token, newPassword string) domain.ErrorRespo
 		return  domain.ErrorResponse{StatusCode: 400, Message: "Invalid reset token"}
 	}
 
+	if time.Now().After(user.PasswordResetExpiresAt) {
+		return domain.ErrorResponse{StatusCode: 400, Message: "Reset token has expired"}
+	}
+
 	hashedPassword, err := u.PasswordSvc.HashPassword(newPassword)
 	if err != nil {
 
@@ -358,14 +891,21 @@ func (u *UserUsecase) ResetPassword(token, newPassword string) domain.ErrorRespo
 		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to hash password"}
 	}
 
-	user.Password = hashedPassword
-	user.PasswordResetToken = ""
-	user.TokenCreatedAt = time.Time{}
+	// every device has to sign in again with the new password; the reset token was already removed
+	// when it was consumed
+	change := domain.UserChange{Set: map[string]interface{}{
+		"password":                hashedPassword,
+		"password_reset_required": false,
+		"updatedAt":               primitive.Timestamp{T: uint32(time.Now().Unix())},
+	}}
+	if errResp := u.savePasswordChange(user, change, time.Now()); errResp.Message != "" {
+		return errResp
+	}
 
-	err = u.UserRepo.UpdateUser(&user)
+	// tokens issued with the old password must stop working right away
+	err = u.RevocationStore.RevokeUserTokens(user.ID.Hex(), time.Now())
 	if err != nil {
-
-		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to update user"}
+		return domain.ErrorResponse{StatusCode: 500, Message: "Failed to revoke access tokens"}
 	}
 
 	u.LogRepo.CreateLog(domain.SystemLog{
@@ -375,4 +915,12 @@ func (u *UserUsecase) ResetPassword(token, newPassword string) domain.ErrorRespo
 	})
 
 	return domain.ErrorResponse{}
+}
+
+// tokenExpiry converts a configured lifetime in minutes, defaulting to 30 minutes.
+func tokenExpiry(minutes int) time.Duration {
+	if minutes <= 0 {
+		minutes = 30
+	}
+	return time.Duration(minutes) * time.Minute
 }
\ No newline at end of file